@@ -7,3 +7,5 @@ export POSTGRES_DB=db
 export JWT_SECRET=secret
 export ENVIRONMENT=dev
 export DEBUG_ERRORS=true
+export AUTO_MIGRATE=true
+export MAIL_SINK=file
@@ -9,7 +9,9 @@ require (
 	github.com/lib/pq v1.10.9
 	github.com/mvndaai/ctxerr v0.14.0
 	github.com/mvndaai/validjson v0.1.0
+	github.com/oasdiff/yaml v0.0.0-20241210131133-6b86fb107d80
 	github.com/patrickmn/go-cache v2.1.0+incompatible
+	golang.org/x/crypto v0.41.0
 )
 
 require (
@@ -18,9 +20,9 @@ require (
 	github.com/josharian/intern v1.0.0 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
 	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826 // indirect
-	github.com/oasdiff/yaml v0.0.0-20241210131133-6b86fb107d80 // indirect
 	github.com/oasdiff/yaml3 v0.0.0-20241210130736-a94c01f36349 // indirect
 	github.com/perimeterx/marshmallow v1.1.5 // indirect
+	golang.org/x/sys v0.35.0 // indirect
 )
 
 require (
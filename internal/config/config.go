@@ -16,12 +16,29 @@ func init() {
 
 type (
 	Config struct {
-		Env          string `key:"ENVIRONMENT" default:"dev"`
-		Postgres     postgres
-		JWTSecret    string `key:"JWT_SECRET" required:"true"`
+		Env      string `key:"ENVIRONMENT" default:"dev"`
+		Postgres postgres
+		// JWTSecret signs with HS256 when there are no JWT_KEYS, if both are set
+		// HS256 tokens are still accepted so it can be removed after rotating
+		JWTSecret    string `key:"JWT_SECRET"`
+		JWTKeys      string `key:"JWT_KEYS"`
 		DebugErrors  bool   `key:"DEBUG_ERRORS" default:"false"`
+		AutoMigrate  bool   `key:"AUTO_MIGRATE" default:"false"`
 		Formated     formated
 		FrontendPath string `key:"FRONTEND_PATH" default:"./bin/frontend"`
+		PublicURL    string `key:"PUBLIC_URL" default:"http://localhost:8080"`
+		Mail         mail
+		// OIDCProviders is a JSON list of oidc.ProviderConfig
+		OIDCProviders string `key:"OIDC_PROVIDERS"`
+		// CacheInvalidation is how instances tell each other about logouts,
+		// postgres or none for a single instance
+		CacheInvalidation string `key:"CACHE_INVALIDATION" default:"postgres"`
+		// TrustedProxies is a comma separated list of the addresses or CIDRs of
+		// proxies whose X-Forwarded-For is used for the client IP
+		TrustedProxies string `key:"TRUSTED_PROXIES"`
+		// AllowedOrigins is a comma separated list of the origins, like
+		// https://example.com, that browsers can call the API from
+		AllowedOrigins string `key:"ALLOWED_ORIGINS"`
 	}
 
 	postgres struct {
@@ -33,6 +50,16 @@ type (
 		SSLMode  string `key:"POSTGRES_SSLMODE" default:"disable"`
 	}
 
+	mail struct {
+		Sink         string `key:"MAIL_SINK" default:"log"`
+		From         string `key:"MAIL_FROM" default:"noreply@localhost"`
+		Dir          string `key:"MAIL_DIR" default:"./bin/mail"`
+		SMTPHost     string `key:"SMTP_HOST"`
+		SMTPPort     int    `key:"SMTP_PORT" default:"587"`
+		SMTPUser     string `key:"SMTP_USER"`
+		SMTPPassword string `key:"SMTP_PASSWORD"`
+	}
+
 	formated struct {
 		Port int `key:"PORT" default:"8080"`
 	}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+const (
+	tableAPIKeys = "api_keys"
+
+	// apiKeyPrefix makes keys easy to spot, like in leaked code
+	apiKeyPrefix = "ka_"
+
+	// apiKeyLastUsedInterval limits how often last_used is written
+	apiKeyLastUsedInterval = "1 minute"
+)
+
+func scanAPIKey(scanner interface {
+	Scan(dest ...any) error
+}) (types.APIKey, error) {
+	var k types.APIKey
+	err := scanner.Scan(
+		&k.ID,
+		&k.Name,
+		&k.Prefix,
+		NullableScan(func(v string) { k.Scopes = strings.Fields(v) }),
+		NullableScan(func(v time.Time) { k.LastUsed = &v }),
+		NullableScan(func(v time.Time) { k.Expiration = &v }),
+		&k.Created,
+	)
+	return k, err
+}
+
+// newAPIKey returns the key and its prefix, the prefix is part of the key
+func newAPIKey(ctx context.Context) (key, prefix string, err error) {
+	b := make([]byte, 38)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", ctxerr.Wrap(ctx, err, "ec6d574e-ac3e-425e-8f48-067a98477698", "failed to create api key")
+	}
+	prefix = apiKeyPrefix + hex.EncodeToString(b[:6])
+	return prefix + "_" + base64.RawURLEncoding.EncodeToString(b[6:]), prefix, nil
+}
+
+// CreateAPIKey makes a key for the subject. Keys can have any of the
+// delegated scopes.
+func (v *DB) CreateAPIKey(ctx context.Context, ac types.APIKeyCreate) (types.APIKeyCreated, error) {
+	for _, s := range ac.Scopes {
+		if !slices.Contains(jwt.DelegatedScopes, s) {
+			ctx = ctxerr.SetField(ctx, "scope", s)
+			return types.APIKeyCreated{}, ctxerr.NewHTTP(ctx, "0b57ded5-50e8-4801-afc7-1a5bd7be1d31", "api keys can only have the scopes "+strings.Join(jwt.DelegatedScopes, ", "), http.StatusBadRequest, "invalid scope")
+		}
+	}
+
+	key, prefix, err := newAPIKey(ctx)
+	if err != nil {
+		return types.APIKeyCreated{}, ctxerr.QuickWrap(ctx, err)
+	}
+
+	k, err := scanAPIKey(v.db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expiration)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+getSelectFields[types.APIKey]()+`
+	`, jwt.SubjectFromContext(ctx), ac.Name, prefix, hashToken(key), strings.Join(ac.Scopes, " "), ac.Expiration))
+	if err != nil {
+		return types.APIKeyCreated{}, ctxerr.Wrap(ctx, constraintErrorToHTTP(ctx, err), "26db0fe2-3e84-4144-b4a3-0571926ec670", "failed to create api key")
+	}
+	return types.APIKeyCreated{APIKey: k, Key: key}, nil
+}
+
+func (v *DB) ListAPIKeys(ctx context.Context, pagination types.Pagination) ([]types.APIKey, types.PaginationResponse, error) {
+	vs, pg, err := listItems(ctx, v.db, tableAPIKeys, types.APIKeyFilters{UserID: jwt.SubjectFromContext(ctx)}, pagination, nil,
+		func(rows *sql.Rows) (types.APIKey, error) {
+			return scanAPIKey(rows)
+		})
+	return vs, pg, ctxerr.QuickWrap(ctx, err)
+}
+
+// DeleteAPIKey revokes one of the subject's keys
+func (v *DB) DeleteAPIKey(ctx context.Context, id string) error {
+	err := softDeleteByID(ctx, v.db, tableAPIKeys, id, []Wheres{{where: "user_id = ", arg: jwt.SubjectFromContext(ctx)}})
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+func invalidAPIKey(ctx context.Context) error {
+	return ctxerr.NewHTTP(ctx, "210a7c30-987f-4215-b480-04a9cbd27884", "invalid api key", http.StatusUnauthorized, "api key not valid")
+}
+
+// APIKeyClaims turns an active key into claims like a token would have, with
+// the current username and role of its user
+func (v *DB) APIKeyClaims(ctx context.Context, key string) (*jwt.JWTClaims, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, invalidAPIKey(ctx)
+	}
+
+	var id uuid.UUID
+	var scopes string
+	claims := &jwt.JWTClaims{}
+	err := v.db.QueryRowContext(ctx, `
+		SELECT k.id, k.scopes, u.id, u.username, u.role
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = $1
+			AND k.deleted IS FALSE
+			AND (k.expiration IS NULL OR k.expiration > CURRENT_TIMESTAMP)
+			AND u.deleted IS FALSE
+	`, hashToken(key)).Scan(&id, &scopes, &claims.Subject, &claims.Username, &claims.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, invalidAPIKey(ctx)
+	}
+	if err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "61cd1eac-5da1-47a4-b94b-781412fc640b", "failed to get api key")
+	}
+	claims.ID = id.String()
+	claims.Scope = scopes
+	claims.Audience = []string{jwt.AudienceAPI}
+
+	_, err = v.db.ExecContext(ctx, `
+		UPDATE api_keys SET last_used = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (last_used IS NULL OR last_used < CURRENT_TIMESTAMP - $2::interval)
+	`, id, apiKeyLastUsedInterval)
+	if err != nil {
+		// The key is still valid, don't fail the request
+		ctx = ctxerr.SetField(ctx, "api_key_id", id)
+		ctxerr.Handle(ctxerr.Wrap(ctx, err, "fde65828-db70-45f1-bf72-8ce8cc5ac0a0", "failed to set api key last_used"))
+	}
+	return claims, nil
+}
@@ -2,40 +2,161 @@ package db
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/mvndaai/known-anywhere/internal/types"
 	"github.com/patrickmn/go-cache"
 )
 
 const cacheFmt = "%s:%s:%s" //env:type:columnName:columnValue
 const cacheExpire = 5 * time.Minute
 
+// sessionCacheExpire is short in case an invalidation from another instance
+// is missed
+const sessionCacheExpire = 30 * time.Second
+
+// maxCacheItems bounds memory, lookups are not cached when it is full
+const maxCacheItems = 100_000
+
+// Cache holds what is checked on every request. Deletes reach every instance
+// so a logout works everywhere right away.
+//
+// Sets take the Generation from before the value was read from the database,
+// they are skipped when a delete happened since so a stale read is not cached
+// after the delete it raced.
+type Cache interface {
+	Generation() uint64
+	SetJWTRevocation(jwtID uuid.UUID, until time.Time, generation uint64)
+	GetJWTRevocation(jwtID uuid.UUID) (until time.Time, ok bool)
+	DeleteJWTRevocation(jwtID uuid.UUID)
+	SetSession(sessionID uuid.UUID, active bool, generation uint64)
+	GetSession(sessionID uuid.UUID) (active bool, ok bool)
+	DeleteSession(sessionIDs ...uuid.UUID)
+	Close() error
+}
+
+// CacheImpl is an in-process cache, deletes are sent on the bus so the other
+// instances drop the same keys
 type CacheImpl struct {
-	cache *cache.Cache
+	cache    *cache.Cache
+	bus      InvalidationBus
+	maxItems int
+
+	// mu makes checking the generation and setting one step
+	mu         sync.Mutex
+	generation uint64
+}
+
+// newCache creates a cache that listens to the bus, a nil bus is for a single
+// instance
+func newCache(bus InvalidationBus) *CacheImpl {
+	c := &CacheImpl{
+		cache:    cache.New(5*time.Minute, time.Minute),
+		bus:      bus,
+		maxItems: maxCacheItems,
+	}
+	if bus != nil {
+		bus.Subscribe(c.invalidate)
+	}
+	return c
 }
 
-func newCache() *CacheImpl {
-	c := cache.New(5*time.Minute, 10*time.Minute)
-	return &CacheImpl{cache: c}
+// invalidate drops a key deleted by any instance, an empty key means messages
+// may have been missed so everything is dropped
+func (c *CacheImpl) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	if key == "" {
+		c.cache.Flush()
+		return
+	}
+	c.cache.Delete(key)
 }
 
-func logoutKey(userID uuid.UUID) string {
-	return fmt.Sprintf(cacheFmt, "logout", "user_id", userID.String())
+// Generation changes with every delete, from this or another instance
+func (c *CacheImpl) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
 }
-func (c *CacheImpl) SetJWTLogout(userID uuid.UUID, items []types.Logout) {
-	c.cache.Set(logoutKey(userID), items, cacheExpire)
+
+func (c *CacheImpl) set(key string, v any, d time.Duration, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation || d <= 0 || c.cache.ItemCount() >= c.maxItems {
+		return
+	}
+	c.cache.Set(key, v, d)
 }
 
-func (c *CacheImpl) GetJWTLogout(userID uuid.UUID) ([]types.Logout, bool) {
-	items, ok := c.cache.Get(logoutKey(userID))
+func (c *CacheImpl) delete(keys ...string) {
+	c.mu.Lock()
+	c.generation++
+	for _, key := range keys {
+		c.cache.Delete(key)
+	}
+	c.mu.Unlock()
+	if c.bus != nil {
+		c.bus.Publish(keys...)
+	}
+}
+
+func (c *CacheImpl) Close() error {
+	if c.bus == nil {
+		return nil
+	}
+	return c.bus.Close()
+}
+
+func revocationKey(jwtID uuid.UUID) string {
+	return fmt.Sprintf(cacheFmt, "logout", "jwt_id", jwtID.String())
+}
+
+// SetJWTRevocation caches when a logout of the token ends, a zero time is a
+// token that is not logged out. Logouts are cached until they end and other
+// tokens are checked again after cacheExpire.
+func (c *CacheImpl) SetJWTRevocation(jwtID uuid.UUID, until time.Time, generation uint64) {
+	d := cacheExpire
+	if !until.IsZero() {
+		d = time.Until(until)
+	}
+	c.set(revocationKey(jwtID), until, d, generation)
+}
+
+func (c *CacheImpl) GetJWTRevocation(jwtID uuid.UUID) (until time.Time, ok bool) {
+	v, ok := c.cache.Get(revocationKey(jwtID))
 	if !ok {
-		return nil, false
+		return time.Time{}, false
 	}
-	return items.([]types.Logout), true
+	return v.(time.Time), true
+}
+
+func (c *CacheImpl) DeleteJWTRevocation(jwtID uuid.UUID) {
+	c.delete(revocationKey(jwtID))
 }
 
-func (c *CacheImpl) DeleteJWTLogout(userID uuid.UUID) {
-	c.cache.Delete(logoutKey(userID))
+func sessionKey(sessionID uuid.UUID) string {
+	return fmt.Sprintf(cacheFmt, "session", "id", sessionID.String())
+}
+
+func (c *CacheImpl) SetSession(sessionID uuid.UUID, active bool, generation uint64) {
+	c.set(sessionKey(sessionID), active, sessionCacheExpire, generation)
+}
+
+func (c *CacheImpl) GetSession(sessionID uuid.UUID) (active bool, ok bool) {
+	v, ok := c.cache.Get(sessionKey(sessionID))
+	if !ok {
+		return false, false
+	}
+	return v.(bool), true
+}
+
+func (c *CacheImpl) DeleteSession(sessionIDs ...uuid.UUID) {
+	keys := make([]string, len(sessionIDs))
+	for i, id := range sessionIDs {
+		keys[i] = sessionKey(id)
+	}
+	c.delete(keys...)
 }
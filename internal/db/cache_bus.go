@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mvndaai/ctxerr"
+)
+
+// cacheInvalidationChannel is the postgres channel deleted cache keys are sent on
+const cacheInvalidationChannel = "cache_invalidation"
+
+// InvalidationBus sends deleted cache keys between instances
+type InvalidationBus interface {
+	// Publish sends keys to every instance, including this one
+	Publish(keys ...string)
+	// Subscribe calls fn with every published key. An empty key means messages
+	// may have been missed.
+	Subscribe(fn func(key string))
+	Close() error
+}
+
+// pqBus uses postgres LISTEN/NOTIFY so no other service is needed
+type pqBus struct {
+	db       *sql.DB
+	listener *pq.Listener
+}
+
+func newPQBus(db *sql.DB, dataSourceName string) *pqBus {
+	l := pq.NewListener(dataSourceName, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			ctx := ctxerr.SetField(context.Background(), "event", event)
+			ctxerr.Handle(ctxerr.Wrap(ctx, err, "391faea1-62b8-44ae-ad37-9a47ac98c769", "cache invalidation listener"))
+		}
+	})
+	// Listen blocks until it connects, don't hold up starting because of it
+	go func() {
+		if err := l.Listen(cacheInvalidationChannel); err != nil {
+			ctxerr.Handle(ctxerr.Wrap(context.Background(), err, "a004f6b5-cfca-4587-b80a-15a2b0caad7d", "failed to listen for cache invalidations"))
+		}
+	}()
+	return &pqBus{db: db, listener: l}
+}
+
+func (b *pqBus) Publish(keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	ctx := context.Background()
+	_, err := b.db.ExecContext(ctx, `SELECT pg_notify($1, key) FROM unnest($2::text[]) AS key`, cacheInvalidationChannel, pq.Array(keys))
+	if err != nil {
+		ctx = ctxerr.SetField(ctx, "keys", keys)
+		ctxerr.Handle(ctxerr.Wrap(ctx, err, "77f00065-d982-4730-95ea-99da9bda6abb", "failed to publish cache invalidation"))
+	}
+}
+
+// Subscribe must be called once, the listener blocks until its notifications
+// are read
+func (b *pqBus) Subscribe(fn func(key string)) {
+	go func() {
+		for n := range b.listener.Notify {
+			// A nil notification is sent after reconnecting
+			if n == nil {
+				fn("")
+				continue
+			}
+			fn(n.Extra)
+		}
+	}()
+}
+
+func (b *pqBus) Close() error {
+	return b.listener.Close()
+}
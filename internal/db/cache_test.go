@@ -0,0 +1,173 @@
+package db
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryBus delivers published keys to every subscriber right away, like
+// instances sharing postgres
+type memoryBus struct {
+	mu          sync.Mutex
+	subscribers []func(string)
+}
+
+func (b *memoryBus) Publish(keys ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, key := range keys {
+		for _, fn := range b.subscribers {
+			fn(key)
+		}
+	}
+}
+
+func (b *memoryBus) Subscribe(fn func(key string)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, fn)
+}
+
+func (b *memoryBus) Close() error { return nil }
+
+func TestCacheInvalidation(t *testing.T) {
+	bus := &memoryBus{}
+	a := newCache(bus)
+	b := newCache(bus)
+
+	jwtID := uuid.New()
+	sessionIDs := []uuid.UUID{uuid.New(), uuid.New()}
+	for _, c := range []*CacheImpl{a, b} {
+		c.SetJWTRevocation(jwtID, time.Time{}, c.Generation())
+		for _, id := range sessionIDs {
+			c.SetSession(id, true, c.Generation())
+		}
+	}
+
+	a.DeleteJWTRevocation(jwtID)
+	_, ok := b.GetJWTRevocation(jwtID)
+	assert.False(t, ok, "logout lookup still cached on the other instance")
+
+	b.DeleteSession(sessionIDs...)
+	for _, id := range sessionIDs {
+		_, ok := a.GetSession(id)
+		assert.False(t, ok, "session still cached on the other instance")
+	}
+}
+
+func TestCacheInvalidationMissed(t *testing.T) {
+	bus := &memoryBus{}
+	c := newCache(bus)
+	sessionID := uuid.New()
+	c.SetSession(sessionID, true, c.Generation())
+
+	// Reconnecting sends an empty key because deletes may have been missed
+	for _, fn := range bus.subscribers {
+		fn("")
+	}
+	_, ok := c.GetSession(sessionID)
+	assert.False(t, ok)
+}
+
+func TestCacheWithoutBus(t *testing.T) {
+	c := newCache(nil)
+	sessionID := uuid.New()
+	c.SetSession(sessionID, false, c.Generation())
+
+	active, ok := c.GetSession(sessionID)
+	assert.True(t, ok)
+	assert.False(t, active)
+
+	c.DeleteSession(sessionID)
+	_, ok = c.GetSession(sessionID)
+	assert.False(t, ok)
+	assert.NoError(t, c.Close())
+}
+
+func TestCacheJWTRevocation(t *testing.T) {
+	c := newCache(nil)
+
+	allowed := uuid.New()
+	c.SetJWTRevocation(allowed, time.Time{}, c.Generation())
+	until, ok := c.GetJWTRevocation(allowed)
+	assert.True(t, ok)
+	assert.False(t, revoked(until, time.Now()))
+
+	loggedOut := uuid.New()
+	expiration := time.Now().Add(time.Hour)
+	c.SetJWTRevocation(loggedOut, expiration, c.Generation())
+	until, ok = c.GetJWTRevocation(loggedOut)
+	assert.True(t, ok)
+	assert.True(t, revoked(until, time.Now()))
+
+	// A logout that already ended is not worth caching
+	ended := uuid.New()
+	c.SetJWTRevocation(ended, time.Now().Add(-time.Second), c.Generation())
+	_, ok = c.GetJWTRevocation(ended)
+	assert.False(t, ok)
+}
+
+func TestRevoked(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		until    time.Time
+		expected bool
+	}{
+		{name: "no logout", until: time.Time{}, expected: false},
+		{name: "ended", until: now.Add(-time.Nanosecond), expected: false},
+		{name: "ends now", until: now, expected: false},
+		{name: "ends after now", until: now.Add(time.Nanosecond), expected: true},
+		{name: "active", until: now.Add(time.Hour), expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, revoked(tt.until, now))
+		})
+	}
+}
+
+func TestCacheMaxItems(t *testing.T) {
+	c := newCache(nil)
+	c.maxItems = 2
+
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	for _, id := range ids {
+		c.SetSession(id, true, c.Generation())
+	}
+	_, ok := c.GetSession(ids[1])
+	assert.True(t, ok)
+	_, ok = c.GetSession(ids[2])
+	assert.False(t, ok, "cached past the limit")
+}
+
+func TestCacheSetAfterInvalidation(t *testing.T) {
+	bus := &memoryBus{}
+	a := newCache(bus)
+	b := newCache(bus)
+	jwtID := uuid.New()
+	sessionID := uuid.New()
+
+	// b reads that the token and session are fine, then a logs them out before
+	// b caches what it read
+	generation := b.Generation()
+	a.DeleteJWTRevocation(jwtID)
+	a.DeleteSession(sessionID)
+	b.SetJWTRevocation(jwtID, time.Time{}, generation)
+	b.SetSession(sessionID, true, generation)
+
+	_, ok := b.GetJWTRevocation(jwtID)
+	assert.False(t, ok, "cached a read from before the logout")
+	_, ok = b.GetSession(sessionID)
+	assert.False(t, ok, "cached a read from before the logout")
+
+	// Reads after the logout are cached
+	b.SetSession(sessionID, false, b.Generation())
+	active, ok := b.GetSession(sessionID)
+	assert.True(t, ok)
+	assert.False(t, active)
+}
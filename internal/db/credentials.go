@@ -0,0 +1,262 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/mvndaai/known-anywhere/internal/password"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+const (
+	tableCredentials    = "credentials"
+	tablePasswordResets = "password_resets"
+
+	passwordResetTTL = "1 hour"
+)
+
+// dummyHash is verified against when a username does not exist so failed
+// logins take the same time either way
+var dummyHash = sync.OnceValue(func() string {
+	h, _ := password.Hash("not a real password")
+	return h
+})
+
+// Register creates a user and their password credentials together
+func (v *DB) Register(ctx context.Context, r types.Registration) (uuid.UUID, error) {
+	if err := v.UsernameAvalaible(ctx, r.Username); err != nil {
+		return uuid.UUID{}, ctxerr.QuickWrap(ctx, err)
+	}
+
+	hash, err := password.Hash(r.Password)
+	if err != nil {
+		return uuid.UUID{}, ctxerr.Wrap(ctx, err, "87d6146a-08cb-468a-847a-83c848c10ea4", "failed to hash password")
+	}
+
+	tx, err := v.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.UUID{}, ctxerr.Wrap(ctx, err, "3f5c3bb4-6d72-49f9-abfe-fa4f1cc2949d", "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	id, err := insertAndReturnID(ctx, tx, tableUsers, r.UserCreate)
+	if err != nil {
+		return uuid.UUID{}, ctxerr.QuickWrap(ctx, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO credentials (user_id, email, password_hash)
+		VALUES ($1, $2, $3)
+	`, id, r.Email, hash)
+	if err != nil {
+		return uuid.UUID{}, ctxerr.Wrap(ctx, constraintErrorToHTTP(ctx, err), "08635af3-ed3e-4cff-8bfb-185674659956", "failed to create credentials")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return uuid.UUID{}, ctxerr.Wrap(ctx, err, "b921c475-32fc-490d-bfc6-f0c0e650bd9d", "failed to commit registration")
+	}
+	return id, nil
+}
+
+func invalidLogin(ctx context.Context) error {
+	return ctxerr.NewHTTP(ctx, "b7009b67-46f0-4b40-9bd3-b866698c61b0", "invalid username or password", http.StatusUnauthorized, "invalid username or password")
+}
+
+// Login checks the password of a user that is not deleted
+func (v *DB) Login(ctx context.Context, l types.Login) (types.User, error) {
+	ctx = ctxerr.SetField(ctx, "username", l.Username)
+	var u types.User
+	var hash string
+	err := v.db.QueryRowContext(ctx, `
+		SELECT u.id, u.username, u.display_name, u.role, c.password_hash
+		FROM users u
+		JOIN credentials c ON c.user_id = u.id
+		WHERE u.username = $1 AND u.deleted IS FALSE
+	`, l.Username).Scan(
+		&u.ID,
+		NullableScan(func(v string) { u.Username = v }),
+		NullableScan(func(v string) { u.DisplayName = v }),
+		&u.Role,
+		&hash,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, _ = password.Verify(l.Password, dummyHash())
+		return u, invalidLogin(ctx)
+	}
+	if err != nil {
+		return u, ctxerr.Wrap(ctx, err, "f779496b-7bc4-4581-afa0-d742bb0ff7b9", "failed to get credentials")
+	}
+
+	ok, err := password.Verify(l.Password, hash)
+	if err != nil {
+		return u, ctxerr.Wrap(ctx, err, "c5982512-6ff5-4999-9359-c0a45f98beb6", "failed to verify password")
+	}
+	if !ok {
+		return u, invalidLogin(ctx)
+	}
+
+	if password.NeedsRehash(hash) {
+		// Not worth failing the login over
+		if err := setPassword(ctx, v.db, u.ID, l.Password); err != nil {
+			ctxerr.Handle(err)
+		}
+	}
+	return u, nil
+}
+
+// ChangePassword changes the password of the subject when the old one matches
+func (v *DB) ChangePassword(ctx context.Context, pc types.PasswordChange) error {
+	userID := jwt.SubjectFromContext(ctx)
+	var hash string
+	err := v.db.QueryRowContext(ctx, `
+		SELECT password_hash FROM credentials WHERE user_id = $1
+	`, userID).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ctxerr.WrapHTTP(ctx, err, "c508f956-f0cc-4180-af95-c7b9a35f0a46", "no password set", http.StatusNotFound, "credentials not found")
+	}
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "f74877b5-2a3c-44c8-b2f8-47783287f9da", "failed to get credentials")
+	}
+
+	ok, err := password.Verify(pc.OldPassword, hash)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "f6dd3169-47f1-40c2-9cfe-bc86b9786a06", "failed to verify password")
+	}
+	if !ok {
+		return ctxerr.NewHTTP(ctx, "a91cc03e-ff65-400d-a8dd-8e0f8a739b66", "old_password is incorrect", http.StatusForbidden, "old password does not match")
+	}
+	if err := setPassword(ctx, v.db, userID, pc.NewPassword); err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+
+	// Log out everywhere else in case the old password was stolen
+	ids, err := revokeSessions(ctx, v.db, []Wheres{
+		{where: "user_id = ", arg: userID},
+		{where: "id != ", arg: jwt.SessionIDFromContext(ctx)},
+	})
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	v.cache.DeleteSession(ids...)
+	return nil
+}
+
+// setPassword hashes and stores the password, db is a *sql.DB or *sql.Tx
+func setPassword(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}, userID uuid.UUID, pw string) error {
+	hash, err := password.Hash(pw)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "1cfe85fd-f3d5-4658-bfd2-3b725b2392fc", "failed to hash password")
+	}
+	res, err := db.ExecContext(ctx, `
+		UPDATE credentials SET password_hash = $1 WHERE user_id = $2
+	`, hash, userID)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "917fcdc6-5cc1-4a74-8892-4b98434920b7", "failed to update password")
+	}
+	return ctxerr.QuickWrap(ctx, ensureRowAffected(ctx, res, tableCredentials))
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreatePasswordReset returns a single use token for the account with the
+// email. The token is empty when there is no account so callers can respond
+// the same way and not leak which emails have accounts.
+func (v *DB) CreatePasswordReset(ctx context.Context, email string) (string, error) {
+	var userID uuid.UUID
+	err := v.db.QueryRowContext(ctx, `
+		SELECT c.user_id
+		FROM credentials c
+		JOIN users u ON u.id = c.user_id
+		WHERE lower(c.email) = $1 AND u.deleted IS FALSE
+	`, strings.ToLower(email)).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", ctxerr.Wrap(ctx, err, "e10a75aa-b91a-4571-85a1-1282d6af90f1", "failed to get credentials")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", ctxerr.Wrap(ctx, err, "38ffda14-13b3-4a80-8193-277909a83099", "failed to create reset token")
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	tx, err := v.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", ctxerr.Wrap(ctx, err, "7f179182-7e82-4579-ab0d-fd078330eea4", "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	// Only the newest reset email works
+	_, err = tx.ExecContext(ctx, `
+		UPDATE password_resets SET used = true WHERE user_id = $1 AND used IS FALSE
+	`, userID)
+	if err != nil {
+		return "", ctxerr.Wrap(ctx, err, "27d342c4-2666-4578-900b-29d6f6a334a7", "failed to expire old resets")
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO password_resets (user_id, token_hash, expiration)
+		VALUES ($1, $2, CURRENT_TIMESTAMP + $3::interval)
+	`, userID, hashToken(token), passwordResetTTL)
+	if err != nil {
+		return "", ctxerr.Wrap(ctx, err, "aa7a4b27-6549-4098-8ad4-d2be990e3a2e", "failed to create password reset")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", ctxerr.Wrap(ctx, err, "fba44d89-8c1d-42bc-b9fb-b0e2176c32b1", "failed to commit password reset")
+	}
+	return token, nil
+}
+
+// ResetPassword uses a token from CreatePasswordReset to set a new password
+func (v *DB) ResetPassword(ctx context.Context, pr types.PasswordReset) error {
+	tx, err := v.db.BeginTx(ctx, nil)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "0bed3033-a212-4407-98f7-cda88b13be41", "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	var userID uuid.UUID
+	err = tx.QueryRowContext(ctx, `
+		UPDATE password_resets SET used = true
+		WHERE token_hash = $1 AND used IS FALSE AND expiration > CURRENT_TIMESTAMP
+		RETURNING user_id
+	`, hashToken(pr.Token)).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ctxerr.WrapHTTP(ctx, err, "e28adf02-d55f-428b-ad57-69d93215c96d", "invalid or expired token", http.StatusBadRequest, "password reset token not valid")
+	}
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "25a512f2-8884-405b-813e-62980e2c1fa5", "failed to use password reset")
+	}
+
+	if err := setPassword(ctx, tx, userID, pr.Password); err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	ids, err := revokeSessions(ctx, tx, []Wheres{{where: "user_id = ", arg: userID}})
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ctxerr.Wrap(ctx, err, "fc1050bc-bc46-45a0-8147-0119f86125a5", "failed to commit password reset")
+	}
+	v.cache.DeleteSession(ids...)
+	return nil
+}
@@ -0,0 +1,31 @@
+package db
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/mvndaai/known-anywhere/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModeratorOnlyCurates(t *testing.T) {
+	d := testDB(t)
+	ctx := asNewUser(t, d)
+	moderator := jwt.ContextWithClaims(asNewUser(t, d), &jwt.JWTClaims{Role: types.RoleModerator})
+
+	domainID, err := d.CreateDomain(moderator, types.DomainCreate{DisplayName: "example.com"})
+	require.NoError(t, err)
+	linkID, err := d.CreateDomainLink(ctx, types.DomainLinkCreate{DomainID: domainID, Link: "https://example.com/{username}"})
+	require.NoError(t, err)
+	username := "someone"
+	socialID, err := d.CreateSocial(ctx, types.SocialCreate{DomainID: domainID, Username: &username})
+	require.NoError(t, err)
+	groupID, err := d.CreateGroup(ctx, types.GroupCreate{Description: "group"})
+	require.NoError(t, err)
+
+	assert.NoError(t, d.DeleteDomainLink(moderator, linkID.String()))
+	assert.Equal(t, http.StatusNotFound, statusCode(moderator, d.DeleteSocial(moderator, socialID.String())))
+	assert.Equal(t, http.StatusNotFound, statusCode(moderator, d.DeleteGroup(moderator, groupID.String())))
+}
@@ -3,45 +3,54 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"os"
+	"net/http"
 	"reflect"
-	"strconv"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/mvndaai/ctxerr"
 	"github.com/mvndaai/known-anywhere/internal/config"
+	"github.com/mvndaai/known-anywhere/internal/jwt"
 	"github.com/mvndaai/known-anywhere/internal/types"
 )
 
 type DB struct {
 	db    *sql.DB
-	cache *CacheImpl
+	cache Cache
 }
 
 func New(ctx context.Context) (*DB, error) {
-	postgress, err := sql.Open("postgres", config.Get().Postgres.DataSourceName())
+	dsn := config.Get().Postgres.DataSourceName()
+	postgress, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, ctxerr.Wrap(ctx, err, "e94bf5b7-5449-41a6-ae92-2103fa475845", "Failed to connect to postgres")
 	}
-	ret := &DB{
-		db:    postgress,
-		cache: newCache(),
-	}
 
-	// Create tables if they don't exist
-	if bl, _ := strconv.ParseBool(os.Getenv("CREATE_TABLES")); bl {
-		err = ret.CreateTables(ctx)
-		if err != nil {
-			return nil, ctxerr.QuickWrap(ctx, err)
-		}
+	var bus InvalidationBus
+	switch ci := config.Get().CacheInvalidation; ci {
+	case "postgres":
+		bus = newPQBus(postgress, dsn)
+	case "none":
+	default:
+		ctx = ctxerr.SetField(ctx, "cache_invalidation", ci)
+		return nil, ctxerr.New(ctx, "5fd709fc-f505-4c99-a440-f334c20e539b", "CACHE_INVALIDATION must be postgres or none")
 	}
 
+	ret := &DB{
+		db:    postgress,
+		cache: newCache(bus),
+	}
 	return ret, nil
 }
 
 func (v *DB) Close(ctx context.Context) error {
+	if err := v.cache.Close(); err != nil {
+		ctxerr.Handle(ctxerr.Wrap(ctx, err, "07abff40-cb71-40e6-a8ae-94efce299eb9", "Failed to close the cache"))
+	}
+
 	// Close the database connection
 	err := v.db.Close()
 	if err != nil {
@@ -90,6 +99,10 @@ func getSelectFields[T any]() string {
 
 	for i := 0; i < typ.NumField(); i++ {
 		field := typ.Field(i)
+		if field.Tag.Get("db") == "-" {
+			// Not a column, filled in separately
+			continue
+		}
 		if field.Anonymous {
 			// For embedded structs, get their fields
 			embedded := reflect.New(field.Type).Elem().Interface()
@@ -133,23 +146,41 @@ func (wc *whereClause) nextVar() string {
 	return fmt.Sprintf("$%d", wc.varCount)
 }
 
+// addVisible hides deleted rows unless ShowDeleted, and rows waiting on a
+// moderator unless ShowPending
+func (wc *whereClause) addVisible(ctx context.Context, tableName string, show types.Pagination) {
+	if !show.ShowDeleted && tableHasDeleted[tableName] {
+		wc.Add("deleted IS FALSE", nil)
+	}
+	if !show.ShowPending && tableHasPending[tableName] {
+		// Creators see what they submitted while it waits for a moderator
+		if sub := jwt.SubjectFromContext(ctx); sub != uuid.Nil {
+			wc.wheres = append(wc.wheres, "(pending IS FALSE OR creator = "+wc.nextVar()+")")
+			wc.args = append(wc.args, sub)
+		} else {
+			wc.Add("pending IS FALSE", nil)
+		}
+	}
+}
+
 type Wheres struct {
 	where string
 	arg   any
 }
 
 var tableHasDeleted = map[string]bool{
-	tableDomains:   true,
-	tableUsers:     true,
-	"groups":       true,
-	"domain_links": true,
-	"socials":      true,
-	"social_votes": true,
+	tableDomains:     true,
+	tableUsers:       true,
+	tableGroups:      true,
+	tableDomainLinks: true,
+	tableSocials:     true,
+	tableSocialVotes: true,
+	tableAPIKeys:     true,
 }
 
 var tableHasPending = map[string]bool{
-	tableDomains:   true,
-	"domain_links": true,
+	tableDomains:     true,
+	tableDomainLinks: true,
 }
 
 func listItems[T any, F any](
@@ -167,12 +198,7 @@ func listItems[T any, F any](
 	for _, w := range wheres {
 		wc.Add(w.where, w.arg)
 	}
-	if !pagination.ShowDeleted && tableHasDeleted[tableName] {
-		wc.Add("deleted IS FALSE", nil)
-	}
-	if !pagination.ShowPending && tableHasPending[tableName] {
-		wc.Add("pending IS FALSE", nil)
-	}
+	wc.addVisible(ctx, tableName, pagination)
 
 	selectFields := getSelectFields[T]()
 
@@ -240,8 +266,8 @@ func getInsertColumns(item any, additionalColumns ...string) (columns []string,
 	val := reflect.ValueOf(item)
 
 	for i := 0; i < typ.NumField(); i++ {
-		if tag := typ.Field(i).Tag.Get("json"); tag != "" && tag != "id" {
-			columns = append(columns, tag)
+		if name := columnName(typ.Field(i)); name != "" && name != "id" {
+			columns = append(columns, name)
 			args = append(args, val.Field(i).Interface())
 		}
 	}
@@ -252,6 +278,16 @@ func getInsertColumns(item any, additionalColumns ...string) (columns []string,
 	return columns, args
 }
 
+// columnName is the json name of a field without options like omitempty,
+// fields without one or tagged "-" are not columns
+func columnName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
 func getDollarSigns(count int) []string {
 	signs := make([]string, count)
 	for i := range signs {
@@ -265,7 +301,39 @@ type columnValue struct {
 	value any
 }
 
-func insertAndReturnID[T any](ctx context.Context, db *sql.DB, tableName string, item T, additionalCols ...columnValue) (uuid.UUID, error) {
+// creatorColumns make the subject the creator of a new row, an admin acting as
+// them is kept in acting_user_id
+func creatorColumns(ctx context.Context) []columnValue {
+	cols := []columnValue{{name: "creator", value: jwt.SubjectFromContext(ctx)}}
+	if jwt.Impersonating(ctx) {
+		cols = append(cols, columnValue{name: "acting_user_id", value: jwt.ActorFromContext(ctx)})
+	}
+	return cols
+}
+
+// rowQueryer is a *sql.DB or *sql.Tx
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func insertAndReturnID[T any](ctx context.Context, db rowQueryer, tableName string, item T, additionalCols ...columnValue) (uuid.UUID, error) {
+	query, args := insertQuery(tableName, item, additionalCols...)
+	query += "RETURNING id"
+
+	var id uuid.UUID
+	err := db.QueryRowContext(ctx, query, args...).Scan(&id)
+	if err != nil {
+		ctx = ctxerr.SetField(ctx, "body", item)
+		ctx = ctxerr.SetField(ctx, "query", query)
+		return uuid.UUID{}, ctxerr.Wrap(ctx, constraintErrorToHTTP(ctx, err), "c486d504-230e-4fa7-9aea-f267b07fac50")
+	}
+
+	return id, nil
+}
+
+// insertQuery is the INSERT of item and the additional columns, callers add
+// what goes after the values like RETURNING
+func insertQuery(tableName string, item any, additionalCols ...columnValue) (string, []any) {
 	columns, args := getInsertColumns(item)
 
 	// Add additional columns and their values
@@ -275,40 +343,220 @@ func insertAndReturnID[T any](ctx context.Context, db *sql.DB, tableName string,
 	}
 
 	dollars := getDollarSigns(len(columns))
-
-	var id uuid.UUID
 	query := fmt.Sprintf(`
 		INSERT INTO %s (
 			%s
 		) VALUES (%s)
-		RETURNING id
 	`, tableName, strings.Join(columns, ",\n\t\t\t"), strings.Join(dollars, ","))
+	return query, args
+}
 
-	err := db.QueryRowContext(ctx, query, args...).Scan(&id)
-	if err != nil {
-		ctx = ctxerr.SetField(ctx, "body", item)
-		ctx = ctxerr.SetField(ctx, "query", query)
-		return uuid.UUID{}, ctxerr.Wrap(ctx, err, "c486d504-230e-4fa7-9aea-f267b07fac50")
+// constraintErrorToHTTP turns postgres constraint violations into errors with
+// http status codes so they are not returned as internal errors
+func constraintErrorToHTTP(ctx context.Context, err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
 	}
-
-	return id, nil
+	ctx = ctxerr.SetField(ctx, "constraint", pqErr.Constraint)
+	switch pqErr.Code.Name() {
+	case "unique_violation":
+		return ctxerr.WrapHTTP(ctx, err, "4f5b3f0a-d3f3-4989-bc32-9df21a4d0001", "already exists", http.StatusConflict, "unique constraint violated")
+	case "check_violation":
+		return ctxerr.WrapHTTP(ctx, err, "222ef9ee-d0b8-4e0d-9722-e6c68162521c", "invalid values", http.StatusBadRequest, "check constraint violated")
+	case "foreign_key_violation":
+		return ctxerr.WrapHTTP(ctx, err, "7e2e84e0-8d01-4f22-ade7-edd4d5156e85", "referenced item does not exist", http.StatusBadRequest, "foreign key constraint violated")
+	case "not_null_violation":
+		ctx = ctxerr.SetField(ctx, "column", pqErr.Column)
+		return ctxerr.WrapHTTP(ctx, err, "9f62fcb3-93ba-419a-9258-25559973766c", "missing required value", http.StatusBadRequest, "not null constraint violated")
+	}
+	return err
 }
 
+// get reads the row of id, it is not found when listItems would hide it. Only
+// ShowDeleted and ShowPending of show are used.
 func get[T any](
 	ctx context.Context,
 	db *sql.DB,
 	tableName string,
 	id string,
+	show types.Pagination,
 	scan func(scanner interface{ Scan(dest ...any) error }) (T, error),
 ) (T, error) {
+	// Moderators read what is waiting on them to review it
+	if jwt.RoleFromContext(ctx).AtLeast(types.RoleModerator) {
+		show.ShowPending = true
+	}
+	wc := whereClause{}
+	wc.Add("id = ", id)
+	wc.addVisible(ctx, tableName, show)
+	where, args := wc.WhereAndArgs()
+
 	fields := getSelectFields[T]()
 	item, err := scan(db.QueryRowContext(ctx, fmt.Sprintf(`
 		SELECT %s
 		FROM %s
-		WHERE id = $1
-	`, fields, tableName), id))
+		%s
+	`, fields, tableName, where), args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		ctx = ctxerr.SetField(ctx, "id", id)
+		return item, ctxerr.WrapHTTP(ctx, err, "bfdb372b-5aea-49de-aeed-dc1a8e6bb4a0", "not found", http.StatusNotFound, tableName+" not found")
+	}
 	if err != nil {
 		return item, ctxerr.Wrap(ctx, err, "7e644c35-7289-494c-8ee3-856edcc0b5bd")
 	}
 	return item, nil
 }
+
+// ensureRowAffected returns a not found error when an update matched no rows
+func ensureRowAffected(ctx context.Context, res sql.Result, tableName string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "4978d408-b1e0-4d58-9616-13cb6d09266e", "failed to get rows affected")
+	}
+	if n == 0 {
+		return ctxerr.NewHTTP(ctx, "28eb00d9-40a7-41de-88e0-a79964bde6a6", "not found", http.StatusNotFound, tableName+" not found")
+	}
+	return nil
+}
+
+// getUpdateColumns gets the columns of the fields that are set, pointers are
+// set when they are not nil and other fields when they are not zero
+func getUpdateColumns(item any) (columns []string, args []any) {
+	typ := reflect.TypeOf(item)
+	val := reflect.ValueOf(item)
+
+	for i := 0; i < typ.NumField(); i++ {
+		name := columnName(typ.Field(i))
+		if name == "" || name == "id" {
+			continue
+		}
+		field := val.Field(i)
+		if field.IsZero() {
+			continue
+		}
+		if field.Kind() == reflect.Pointer {
+			field = field.Elem()
+		}
+		columns = append(columns, name)
+		args = append(args, field.Interface())
+	}
+	return columns, args
+}
+
+// updateByID updates the set fields of item on a row that is not deleted
+func updateByID[T any](ctx context.Context, db *sql.DB, tableName, id string, item T, wheres []Wheres, additionalCols ...columnValue) error {
+	columns, args := getUpdateColumns(item)
+	if len(columns) == 0 {
+		return ctxerr.NewHTTP(ctx, "50b46ca7-8e34-40eb-b01a-ca9233f9702f", "nothing to update", http.StatusBadRequest, "no fields set to update")
+	}
+	for _, col := range additionalCols {
+		columns = append(columns, col.name)
+		args = append(args, col.value)
+	}
+
+	wc := whereClause{}
+	sets := make([]string, len(columns))
+	for i, col := range columns {
+		sets[i] = col + " = " + wc.nextVar()
+	}
+	wc.args = args
+	wc.Add("id = ", id)
+	if tableHasDeleted[tableName] {
+		wc.Add("deleted IS FALSE", nil)
+	}
+	for _, w := range wheres {
+		wc.Add(w.where, w.arg)
+	}
+	where, args := wc.WhereAndArgs()
+
+	query := fmt.Sprintf(`UPDATE %s SET %s %s`, tableName, strings.Join(sets, ", "), where)
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		ctx = ctxerr.SetField(ctx, "body", item)
+		ctx = ctxerr.SetField(ctx, "query", query)
+		return ctxerr.Wrap(ctx, constraintErrorToHTTP(ctx, err), "8f99d66e-0e6a-4ab0-925e-d4307f6e867a", "failed to update", tableName)
+	}
+	return ctxerr.QuickWrap(ctx, ensureRowAffected(ctx, res, tableName))
+}
+
+// softDeleteByID marks a row as deleted and records who deleted it in
+// delete_audits in the same transaction
+func softDeleteByID(ctx context.Context, db *sql.DB, tableName, id string, wheres []Wheres) error {
+	return ctxerr.QuickWrap(ctx, setDeletedByID(ctx, db, tableName, id, true, wheres))
+}
+
+// restoreByID undoes a soft delete and marks the delete audit as deleted
+func restoreByID(ctx context.Context, db *sql.DB, tableName, id string, wheres []Wheres) error {
+	return ctxerr.QuickWrap(ctx, setDeletedByID(ctx, db, tableName, id, false, wheres))
+}
+
+func setDeletedByID(ctx context.Context, db *sql.DB, tableName, id string, deleted bool, wheres []Wheres) error {
+	ctx = ctxerr.SetField(ctx, "table", tableName)
+	ctx = ctxerr.SetField(ctx, "id", id)
+	if !tableHasDeleted[tableName] {
+		return ctxerr.New(ctx, "526a685d-c5f0-4db5-94b3-17fb9ec3e45c", "table does not support soft deletes")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "3836208f-7caf-414d-8b7f-351f7a3fe477", "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	wc := whereClause{}
+	set := "deleted = " + wc.nextVar()
+	wc.args = []any{deleted}
+	wc.Add("id = ", id)
+	wc.Add(fmt.Sprintf("deleted IS %t", !deleted), nil)
+	for _, w := range wheres {
+		wc.Add(w.where, w.arg)
+	}
+	where, args := wc.WhereAndArgs()
+	query := fmt.Sprintf(`UPDATE %s SET %s %s`, tableName, set, where)
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		ctx = ctxerr.SetField(ctx, "query", query)
+		return ctxerr.Wrap(ctx, err, "87a36167-e4a3-4c2c-bbff-d801bca374c3", "failed to set deleted")
+	}
+	if err := ensureRowAffected(ctx, res, tableName); err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+
+	if deleted {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO delete_audits (table_name, row_id, creator)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (table_name, row_id) DO UPDATE
+			SET creator = EXCLUDED.creator, deleted = false, created = CURRENT_TIMESTAMP
+		`, tableName, id, jwt.ActorFromContext(ctx))
+	} else {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE delete_audits
+			SET deleted = true
+			WHERE table_name = $1 AND row_id = $2
+		`, tableName, id)
+	}
+	if err != nil {
+		return ctxerr.Wrap(ctx, constraintErrorToHTTP(ctx, err), "42a5e1fd-ca32-459b-a2e8-8e284f9c5e24", "failed to write delete audit")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ctxerr.Wrap(ctx, err, "3ae9c621-a572-4d04-8312-c5b802e77f60", "failed to commit delete")
+	}
+	return nil
+}
+
+// creatorWheres limits changes to rows created by the caller
+func creatorWheres(ctx context.Context) []Wheres {
+	return []Wheres{{where: "creator = ", arg: jwt.SubjectFromContext(ctx)}}
+}
+
+// curatorWheres is creatorWheres for the curated domains and domain links,
+// moderators can change any of them
+func curatorWheres(ctx context.Context) []Wheres {
+	if jwt.RoleFromContext(ctx).AtLeast(types.RoleModerator) {
+		return nil
+	}
+	return creatorWheres(ctx)
+}
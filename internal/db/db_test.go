@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+	ctxerrhttp "github.com/mvndaai/ctxerr/http"
+	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/mvndaai/known-anywhere/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDB is the migrated database of the POSTGRES_* config. Tests that need
+// one are skipped unless DB_TESTS is true.
+func testDB(t *testing.T) *DB {
+	t.Helper()
+	if ok, _ := strconv.ParseBool(os.Getenv("DB_TESTS")); !ok {
+		t.Skip("DB_TESTS is not true")
+	}
+	ctx := context.Background()
+	d, err := New(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() { d.Close(ctx) })
+	require.NoError(t, d.MigrateUp(ctx))
+	return d
+}
+
+// asNewUser creates a user and returns a context with them as the subject
+func asNewUser(t *testing.T, d *DB) context.Context {
+	t.Helper()
+	ctx := context.Background()
+	username := "test" + uuid.NewString()[:8]
+	id, err := d.CreateUser(ctx, types.UserCreate{Username: username, DisplayName: username})
+	require.NoError(t, err)
+	return jwt.ContextWithSubject(ctx, id.String())
+}
+
+// statusCode is the status an error would be returned with
+func statusCode(ctx context.Context, err error) int {
+	status, _ := ctxerrhttp.StatusCodeAndResponse(ctxerr.QuickWrap(ctx, err), false, false)
+	return status
+}
+
+func TestGetUpdateColumns(t *testing.T) {
+	name := "name"
+	columns, args := getUpdateColumns(struct {
+		ID       string  `json:"id"`
+		Name     *string `json:"name,omitempty"`
+		Notes    string  `json:"notes"`
+		Internal string  `json:"-"`
+		Untagged string
+	}{ID: "1", Name: &name, Internal: "internal", Untagged: "untagged"})
+	assert.Equal(t, []string{"name"}, columns)
+	assert.Equal(t, []any{"name"}, args)
+
+	columns, _ = getInsertColumns(struct {
+		Name     string `json:"name,omitempty"`
+		Internal string `json:"-"`
+	}{})
+	assert.Equal(t, []string{"name"}, columns)
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+const (
+	tableDomainLinks = "domain_links"
+
+	// maxDomainLinks caps how many links of a domain are loaded to resolve one
+	maxDomainLinks = 250
+)
+
+func scanDomainLink(scanner interface {
+	Scan(dest ...any) error
+}) (types.DomainLink, error) {
+	var l types.DomainLink
+	err := scanner.Scan(
+		&l.ID,
+		&l.DomainID,
+		NullableScan(func(v string) { l.Link = v }),
+		NullableScan(func(v string) { l.CountryCode = v }),
+	)
+	return l, err
+}
+
+func (v *DB) CreateDomainLink(ctx context.Context, l types.DomainLinkCreate) (uuid.UUID, error) {
+	id, err := insertAndReturnID(ctx, v.db, tableDomainLinks, l, creatorColumns(ctx)...)
+	return id, ctxerr.QuickWrap(ctx, err)
+}
+
+func (v *DB) GetDomainLink(ctx context.Context, id string) (types.DomainLink, error) {
+	vs, err := get(ctx, v.db, tableDomainLinks, id, types.Pagination{}, scanDomainLink)
+	return vs, ctxerr.QuickWrap(ctx, err)
+}
+
+func (v *DB) ListDomainLinks(ctx context.Context, filters types.DomainLinkCreate, pagination types.Pagination) ([]types.DomainLink, types.PaginationResponse, error) {
+	vs, pg, err := listItems(ctx, v.db, tableDomainLinks, filters, pagination, nil,
+		func(rows *sql.Rows) (types.DomainLink, error) {
+			return scanDomainLink(rows)
+		})
+	return vs, pg, ctxerr.QuickWrap(ctx, err)
+}
+
+// UpdateDomainLink changes the set fields of a link, only the creator or a
+// moderator can update it and the link goes back to the moderation queue
+func (v *DB) UpdateDomainLink(ctx context.Context, id string, l types.DomainLinkUpdate) error {
+	err := updateByID(ctx, v.db, tableDomainLinks, id, l, curatorWheres(ctx), backToModeration()...)
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+// DeleteDomainLink soft deletes a domain link, only the creator or a
+// moderator can delete it
+func (v *DB) DeleteDomainLink(ctx context.Context, id string) error {
+	err := softDeleteByID(ctx, v.db, tableDomainLinks, id, curatorWheres(ctx))
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+// RestoreDomainLink undoes a delete, only the creator or a moderator can
+// restore it
+func (v *DB) RestoreDomainLink(ctx context.Context, id string) error {
+	err := restoreByID(ctx, v.db, tableDomainLinks, id, curatorWheres(ctx))
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+// ResolveDomainLink finds the best approved link of a domain for the country
+func (v *DB) ResolveDomainLink(ctx context.Context, domainID uuid.UUID, country string) (types.DomainLink, error) {
+	ctx = ctxerr.SetField(ctx, "country", country)
+	links, _, err := v.ListDomainLinks(ctx, types.DomainLinkCreate{DomainID: domainID}, types.Pagination{Limit: maxDomainLinks})
+	if err != nil {
+		return types.DomainLink{}, ctxerr.QuickWrap(ctx, err)
+	}
+	l, ok := types.DomainLinks(links).Resolve(country)
+	if !ok {
+		return l, ctxerr.NewHTTP(ctx, "729aaa57-4f80-4d7c-9c14-4e9a6a95a7ea", "no link for domain", http.StatusNotFound, "no matching domain link")
+	}
+	return l, nil
+}
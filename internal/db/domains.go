@@ -6,7 +6,6 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/mvndaai/ctxerr"
-	"github.com/mvndaai/known-anywhere/internal/jwt"
 	"github.com/mvndaai/known-anywhere/internal/types"
 )
 
@@ -28,13 +27,12 @@ func scanDomain(scanner interface {
 }
 
 func (v *DB) CreateDomain(ctx context.Context, d types.DomainCreate) (uuid.UUID, error) {
-	creator := jwt.SubjectFromContext(ctx)
-	id, err := insertAndReturnID(ctx, v.db, tableDomains, d, columnValue{name: "creator", value: creator})
+	id, err := insertAndReturnID(ctx, v.db, tableDomains, d, creatorColumns(ctx)...)
 	return id, ctxerr.QuickWrap(ctx, err)
 }
 
 func (v *DB) GetDomain(ctx context.Context, id string) (types.Domain, error) {
-	vs, err := get(ctx, v.db, tableDomains, id, scanDomain)
+	vs, err := get(ctx, v.db, tableDomains, id, types.Pagination{}, scanDomain)
 	return vs, ctxerr.QuickWrap(ctx, err)
 }
 
@@ -45,3 +43,24 @@ func (v *DB) ListDomains(ctx context.Context, filters types.DomainCreate, pagina
 		})
 	return vs, pg, ctxerr.QuickWrap(ctx, err)
 }
+
+// UpdateDomain changes the set fields of a domain, only the creator or a
+// moderator can update it and the domain goes back to the moderation queue
+func (v *DB) UpdateDomain(ctx context.Context, id string, d types.DomainUpdate) error {
+	err := updateByID(ctx, v.db, tableDomains, id, d, curatorWheres(ctx), backToModeration()...)
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+// DeleteDomain soft deletes a domain, only the creator or a moderator can
+// delete it
+func (v *DB) DeleteDomain(ctx context.Context, id string) error {
+	err := softDeleteByID(ctx, v.db, tableDomains, id, curatorWheres(ctx))
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+// RestoreDomain undoes a delete, only the creator or a moderator can
+// restore it
+func (v *DB) RestoreDomain(ctx context.Context, id string) error {
+	err := restoreByID(ctx, v.db, tableDomains, id, curatorWheres(ctx))
+	return ctxerr.QuickWrap(ctx, err)
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/mvndaai/known-anywhere/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDeleted(t *testing.T) {
+	d := testDB(t)
+	ctx := asNewUser(t, d)
+
+	groupID, err := d.CreateGroup(ctx, types.GroupCreate{Description: "group"})
+	require.NoError(t, err)
+	_, err = d.GetGroup(ctx, groupID.String())
+	require.NoError(t, err)
+
+	require.NoError(t, d.DeleteGroup(ctx, groupID.String()))
+	_, err = d.GetGroup(ctx, groupID.String())
+	assert.Equal(t, http.StatusNotFound, statusCode(ctx, err))
+
+	require.NoError(t, d.RestoreGroup(ctx, groupID.String()))
+	_, err = d.GetGroup(ctx, groupID.String())
+	assert.NoError(t, err)
+}
+
+func TestGetPending(t *testing.T) {
+	d := testDB(t)
+	creator := asNewUser(t, d)
+	other := asNewUser(t, d)
+	moderator := jwt.ContextWithClaims(asNewUser(t, d), &jwt.JWTClaims{Role: types.RoleModerator})
+
+	domainID, err := d.CreateDomain(creator, types.DomainCreate{DisplayName: "pending.example.com"})
+	require.NoError(t, err)
+	linkID, err := d.CreateDomainLink(creator, types.DomainLinkCreate{DomainID: domainID, Link: "https://pending.example.com/{username}"})
+	require.NoError(t, err)
+
+	for name, ctx := range map[string]context.Context{"creator": creator, "moderator": moderator} {
+		_, err = d.GetDomain(ctx, domainID.String())
+		assert.NoError(t, err, name)
+		_, err = d.GetDomainLink(ctx, linkID.String())
+		assert.NoError(t, err, name)
+	}
+	for name, ctx := range map[string]context.Context{"anonymous": context.Background(), "other": other} {
+		_, err = d.GetDomain(ctx, domainID.String())
+		assert.Equal(t, http.StatusNotFound, statusCode(ctx, err), name)
+		_, err = d.GetDomainLink(ctx, linkID.String())
+		assert.Equal(t, http.StatusNotFound, statusCode(ctx, err), name)
+	}
+
+	require.NoError(t, d.ApproveDomain(moderator, domainID.String()))
+	_, err = d.GetDomain(other, domainID.String())
+	assert.NoError(t, err)
+}
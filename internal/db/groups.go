@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+const (
+	tableGroups = "groups"
+)
+
+func scanGroup(scanner interface {
+	Scan(dest ...any) error
+}) (types.Group, error) {
+	var g types.Group
+	err := scanner.Scan(
+		&g.ID,
+		NullableScan(func(v string) { g.Description = v }),
+		&g.PersonalUserID,
+	)
+	return g, err
+}
+
+func (v *DB) CreateGroup(ctx context.Context, g types.GroupCreate) (uuid.UUID, error) {
+	if g.PersonalUserID != nil && *g.PersonalUserID != jwt.SubjectFromContext(ctx) {
+		return uuid.UUID{}, ctxerr.NewHTTP(ctx, "267f7353-c5ce-4afe-9db5-4ea83334e433", "personal groups can only be created for yourself", http.StatusForbidden, "personal_user_id does not match creator")
+	}
+	id, err := insertAndReturnID(ctx, v.db, tableGroups, g, creatorColumns(ctx)...)
+	return id, ctxerr.QuickWrap(ctx, err)
+}
+
+// checkGroupOwner makes sure socials are only put in groups of the user
+func (v *DB) checkGroupOwner(ctx context.Context, groupID uuid.UUID) error {
+	ctx = ctxerr.SetField(ctx, "group_id", groupID)
+	var creator uuid.UUID
+	err := v.db.QueryRowContext(ctx, "SELECT creator FROM groups WHERE id = $1 AND deleted IS FALSE", groupID).Scan(&creator)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ctxerr.WrapHTTP(ctx, err, "8dfb4fc2-188f-4b21-bced-68bc9eae9f5b", "group not found", http.StatusNotFound, "group not found")
+	}
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "cb2f736a-f1c3-4d0c-90c5-72f949ed33f9", "failed to get group creator")
+	}
+	if creator != jwt.SubjectFromContext(ctx) {
+		return ctxerr.NewHTTP(ctx, "767eff62-1f67-4d2f-a4ea-1f9d317f3d09", "only your own groups can have socials added", http.StatusForbidden, "group is not owned by the user")
+	}
+	return nil
+}
+
+func (v *DB) GetGroup(ctx context.Context, id string) (types.Group, error) {
+	vs, err := get(ctx, v.db, tableGroups, id, types.Pagination{}, scanGroup)
+	return vs, ctxerr.QuickWrap(ctx, err)
+}
+
+func (v *DB) ListGroups(ctx context.Context, filters types.GroupCreate, pagination types.Pagination) ([]types.Group, types.PaginationResponse, error) {
+	vs, pg, err := listItems(ctx, v.db, tableGroups, filters, pagination, nil,
+		func(rows *sql.Rows) (types.Group, error) {
+			return scanGroup(rows)
+		})
+	return vs, pg, ctxerr.QuickWrap(ctx, err)
+}
+
+// UpdateGroup changes the set fields of a group, only the creator can update it
+func (v *DB) UpdateGroup(ctx context.Context, id string, g types.GroupUpdate) error {
+	err := updateByID(ctx, v.db, tableGroups, id, g, creatorWheres(ctx))
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+// DeleteGroup soft deletes a group, only the creator can delete it
+func (v *DB) DeleteGroup(ctx context.Context, id string) error {
+	err := softDeleteByID(ctx, v.db, tableGroups, id, creatorWheres(ctx))
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+// RestoreGroup undoes a delete, only the creator can restore it
+func (v *DB) RestoreGroup(ctx context.Context, id string) error {
+	err := restoreByID(ctx, v.db, tableGroups, id, creatorWheres(ctx))
+	return ctxerr.QuickWrap(ctx, err)
+}
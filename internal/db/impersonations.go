@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+const (
+	tableImpersonations = "impersonations"
+)
+
+func scanImpersonation(scanner interface {
+	Scan(dest ...any) error
+}) (types.Impersonation, error) {
+	var i types.Impersonation
+	err := scanner.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Reason,
+		&i.JWTID,
+		&i.Expiration,
+		&i.Creator,
+		&i.Created,
+	)
+	return i, err
+}
+
+// CreateImpersonation records that the actor is getting a token for the user
+// and returns the user. Admins cannot act as themselves or other admins.
+func (v *DB) CreateImpersonation(ctx context.Context, ic types.ImpersonationCreate) (types.User, error) {
+	ctx = ctxerr.SetField(ctx, "user_id", ic.UserID)
+	actor := jwt.ActorFromContext(ctx)
+	if actor == ic.UserID {
+		return types.User{}, ctxerr.NewHTTP(ctx, "8a9a42bd-2470-4bc2-827e-b08b150770ca", "you cannot act as yourself", http.StatusBadRequest, "impersonating self")
+	}
+
+	tx, err := v.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.User{}, ctxerr.Wrap(ctx, err, "cf603033-a295-4762-bb1a-463dfd5723f9", "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	u, err := scanUser(tx.QueryRowContext(ctx, `
+		SELECT `+getSelectFields[types.User]()+`
+		FROM users
+		WHERE id = $1 AND deleted IS FALSE
+		FOR SHARE
+	`, ic.UserID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.User{}, ctxerr.NewHTTP(ctx, "ee96ecd6-a3b2-4ab8-8250-ed0283bdbc1e", "not found", http.StatusNotFound, tableUsers+" not found")
+	}
+	if err != nil {
+		return types.User{}, ctxerr.Wrap(ctx, err, "ded83990-96d1-4eba-b2c1-49a579017780", "failed to get user")
+	}
+	if u.Role.AtLeast(types.RoleAdmin) {
+		return types.User{}, ctxerr.NewHTTP(ctx, "3d61e287-7817-4f94-a944-6b3808f06864", "admins cannot be impersonated", http.StatusForbidden, "impersonating admin")
+	}
+
+	_, err = insertAndReturnID(ctx, tx, tableImpersonations, ic, columnValue{name: "creator", value: actor})
+	if err != nil {
+		return types.User{}, ctxerr.QuickWrap(ctx, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.User{}, ctxerr.Wrap(ctx, err, "b9d71a62-3509-41c6-b6cd-db05e07d083b", "failed to commit impersonation")
+	}
+	return u, nil
+}
+
+func (v *DB) ListImpersonations(ctx context.Context, filters types.ImpersonationFilters, pagination types.Pagination) ([]types.Impersonation, types.PaginationResponse, error) {
+	vs, pg, err := listItems(ctx, v.db, tableImpersonations, filters, pagination, nil,
+		func(rows *sql.Rows) (types.Impersonation, error) {
+			return scanImpersonation(rows)
+		})
+	return vs, pg, ctxerr.QuickWrap(ctx, err)
+}
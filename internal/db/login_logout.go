@@ -3,7 +3,9 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/mvndaai/ctxerr"
@@ -33,9 +35,13 @@ func scanLogout(scanner interface {
 
 func (v *DB) LogoutCreate(ctx context.Context, l types.Logout) (uuid.UUID, error) {
 	l.UserID = jwt.SubjectFromContext(ctx)
-	v.cache.DeleteJWTLogout(l.UserID)
 	id, err := insertAndReturnID(ctx, v.db, tableLogouts, l)
-	return id, ctxerr.QuickWrap(ctx, err)
+	if err != nil {
+		return id, ctxerr.QuickWrap(ctx, err)
+	}
+	// After the insert so a check in between cannot cache the token as allowed
+	v.cache.DeleteJWTRevocation(l.JWTID)
+	return id, nil
 }
 
 func (v *DB) ListLogout(ctx context.Context, filters types.Logout, pagination types.Pagination) ([]types.Logout, types.PaginationResponse, error) {
@@ -46,35 +52,72 @@ func (v *DB) ListLogout(ctx context.Context, filters types.Logout, pagination ty
 	return vs, pg, ctxerr.QuickWrap(ctx, err)
 }
 
-func (v *DB) JWTAllowed(ctx context.Context, userID, jwtID string) error {
-	userIDUUID, err := uuid.Parse(userID)
+// JWTAllowed checks that a token was not logged out. Tokens from a login are
+// checked against their session, other tokens against logouts.
+func (v *DB) JWTAllowed(ctx context.Context, jwtID, sessionID string) error {
+	if sessionID != "" {
+		id, err := uuid.Parse(sessionID)
+		if err != nil {
+			return ctxerr.WrapHTTP(ctx, err, "1bf8a503-1a97-4507-9551-0a6445bb0b78", "Session ID not a uuid", http.StatusUnauthorized, "session id not uuid")
+		}
+		return ctxerr.QuickWrap(ctx, v.sessionActive(ctx, id))
+	}
+
+	id, err := uuid.Parse(jwtID)
 	if err != nil {
-		return ctxerr.WrapHTTP(ctx, err, "9db70054-dec1-4518-8fa9-37794220931d", "User ID not a uuid", http.StatusBadRequest, "user id not uuid")
+		return ctxerr.WrapHTTP(ctx, err, "a938b89e-5c87-4078-a342-68e6ab643d59", "JWT ID not a uuid", http.StatusBadRequest, "jwt id not uuid")
 	}
-	logouts, ok := v.cache.GetJWTLogout(userIDUUID)
+	until, ok := v.cache.GetJWTRevocation(id)
 	if !ok {
-		var err error
-		logouts, _, err = listItems(ctx, v.db, tableLogouts, types.Logout{UserID: userIDUUID}, types.Pagination{Limit: 100}, []Wheres{{where: "expiration < now()"}},
-			func(rows *sql.Rows) (types.Logout, error) {
-				return scanLogout(rows)
-			})
-		if err != nil {
-			return ctxerr.QuickWrap(ctx, err)
+		generation := v.cache.Generation()
+		err := v.db.QueryRowContext(ctx, `
+			SELECT expiration FROM logouts
+			WHERE jwt_id = $1 AND expiration > CURRENT_TIMESTAMP
+		`, id).Scan(&until)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return ctxerr.Wrap(ctx, err, "f8b99dd7-f15c-49f8-b019-67817696f0f8", "failed to check logout")
 		}
-		v.cache.SetJWTLogout(userIDUUID, logouts)
+		v.cache.SetJWTRevocation(id, until, generation)
 	}
-	if len(logouts) == 0 {
-		return nil
+	if revoked(until, time.Now()) {
+		ctx = ctxerr.SetField(ctx, "jwt_id", id)
+		return ctxerr.NewHTTP(ctx, "e7d0cd66-29f6-45cb-9b4e-a8fbd4d329b8", "jwt logged out", http.StatusUnauthorized, "jwt id logged out")
 	}
+	return nil
+}
+
+// revoked checks if a logout lasting until is still in effect, a zero time
+// means there is no logout
+func revoked(until, now time.Time) bool {
+	return until.After(now)
+}
 
-	jwtIDUUID, err := uuid.Parse(jwtID)
+// PurgeExpiredLogouts deletes logouts of tokens that have expired since
+// they are rejected without them
+func (v *DB) PurgeExpiredLogouts(ctx context.Context) (int64, error) {
+	res, err := v.db.ExecContext(ctx, `DELETE FROM logouts WHERE expiration <= CURRENT_TIMESTAMP`)
 	if err != nil {
-		return ctxerr.WrapHTTP(ctx, err, "a938b89e-5c87-4078-a342-68e6ab643d59", "JWT ID not a uuid", http.StatusBadRequest, "jwt id not uuid")
+		return 0, ctxerr.Wrap(ctx, err, "1b5a333b-48c6-474d-87c2-6e232227fba0", "failed to purge logouts")
 	}
-	for _, lg := range logouts {
-		if lg.JWTID == jwtIDUUID {
-			return ctxerr.NewHTTP(ctx, "e7d0cd66-29f6-45cb-9b4e-a8fbd4d329b8", "jwt logged out", http.StatusUnauthorized, "jwt id logged out")
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, ctxerr.Wrap(ctx, err, "b47048bc-7d98-40ba-a8d5-7030c4f1bd39", "failed to count purged logouts")
+	}
+	return n, nil
+}
+
+// PurgeLogoutsEvery purges expired logouts until the context is done
+func (v *DB) PurgeLogoutsEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := v.PurgeExpiredLogouts(ctx); err != nil {
+				ctxerr.Handle(err)
+			}
 		}
 	}
-	return nil
 }
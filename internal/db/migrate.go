@@ -0,0 +1,207 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/db/migrations"
+)
+
+// migrationLockKey is the advisory lock held while migrating so multiple
+// instances starting at once don't run the same migration
+const migrationLockKey = 7_331_001
+
+type MigrationStatus struct {
+	Version int
+	Name    string
+	Applied *time.Time
+}
+
+// MigrateUp applies all migrations that have not been applied yet
+func (v *DB) MigrateUp(ctx context.Context) error {
+	return ctxerr.QuickWrap(ctx, v.withMigrationLock(ctx, func(conn *sql.Conn, ms []migrations.Migration, applied map[int]time.Time) error {
+		for _, m := range ms {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			log.Printf("applying migration %d_%s\n", m.Version, m.Name)
+			err := runMigration(ctx, conn, m, m.Up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+			if err != nil {
+				return ctxerr.QuickWrap(ctx, err)
+			}
+		}
+		return nil
+	}))
+}
+
+// MigrateDown rolls back the latest applied migrations
+func (v *DB) MigrateDown(ctx context.Context, steps int) error {
+	return ctxerr.QuickWrap(ctx, v.withMigrationLock(ctx, func(conn *sql.Conn, ms []migrations.Migration, applied map[int]time.Time) error {
+		for i := len(ms) - 1; i >= 0 && steps > 0; i-- {
+			m := ms[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			log.Printf("rolling back migration %d_%s\n", m.Version, m.Name)
+			err := runMigration(ctx, conn, m, m.Down, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+			if err != nil {
+				return ctxerr.QuickWrap(ctx, err)
+			}
+			steps--
+		}
+		return nil
+	}))
+}
+
+// MigrationStatus lists every migration and when it was applied
+func (v *DB) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := v.withMigrationLock(ctx, func(conn *sql.Conn, ms []migrations.Migration, applied map[int]time.Time) error {
+		for _, m := range ms {
+			s := MigrationStatus{Version: m.Version, Name: m.Name}
+			if t, ok := applied[m.Version]; ok {
+				s.Applied = &t
+			}
+			statuses = append(statuses, s)
+		}
+		return nil
+	})
+	return statuses, ctxerr.QuickWrap(ctx, err)
+}
+
+func (v *DB) withMigrationLock(ctx context.Context, fn func(*sql.Conn, []migrations.Migration, map[int]time.Time) error) error {
+	ms, err := migrations.All()
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "3da5d071-d1da-438a-8bf2-0665ac0b7cb4", "invalid migrations")
+	}
+
+	// Advisory locks belong to a session so everything has to use the same connection
+	conn, err := v.db.Conn(ctx)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "7f6a639a-9a59-46bc-bd65-ea6eda5c2f4b", "failed to get connection")
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "b7723333-e5ff-4e9d-9a5f-3d82d12442ac", "failed to get migration lock")
+	}
+	defer func() {
+		_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+		if err != nil {
+			ctxerr.Handle(ctxerr.Wrap(ctx, err, "d77a374d-8e6b-411e-b7e1-46b5b060f1fd", "failed to release migration lock"))
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied TIMESTAMP NOT NULL default CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "7653c187-70c3-402e-84fb-dbad2cfe35d6", "failed to create schema_migrations")
+	}
+
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	return fn(conn, ms, applied)
+}
+
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied FROM schema_migrations`)
+	if err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "de7ca338-8dd9-4dd1-8698-03e4451d35bd", "failed to list applied migrations")
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var t time.Time
+		if err := rows.Scan(&version, &t); err != nil {
+			return nil, ctxerr.Wrap(ctx, err, "6efe0cb9-7bf5-4961-90ff-2a803bf616b8", "failed to scan applied migration")
+		}
+		applied[version] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "7d34e975-570c-4602-9847-6292773739db", "failed to read applied migrations")
+	}
+	return applied, nil
+}
+
+// runMigration runs the migration sql and records it in one transaction
+func runMigration(ctx context.Context, conn *sql.Conn, m migrations.Migration, query, record string, recordArgs ...any) error {
+	ctx = ctxerr.SetField(ctx, "migration", fmt.Sprintf("%d_%s", m.Version, m.Name))
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "e596afc5-e1ec-4512-b329-b1b7603c28de", "failed to begin migration transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return ctxerr.Wrap(ctx, err, "f58195c4-7e0d-471b-8530-20f90b937acf", "failed to run migration")
+	}
+	if _, err := tx.ExecContext(ctx, record, recordArgs...); err != nil {
+		return ctxerr.Wrap(ctx, err, "f6d9ad7a-671b-4ec1-8881-4c6b9a1d3f2e", "failed to record migration")
+	}
+	if err := tx.Commit(); err != nil {
+		return ctxerr.Wrap(ctx, err, "98b4c3b1-f8b7-4452-aec3-b147f6e9b3e0", "failed to commit migration")
+	}
+	return nil
+}
+
+// MigrateCommand runs `migrate up`, `migrate down [steps]`, or `migrate status`
+func MigrateCommand(ctx context.Context, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return ctxerr.New(ctx, "65deba77-b4b2-4ee1-a8e3-cfbded79606f", "usage: migrate up|down [steps]|status")
+	}
+
+	v, err := New(ctx)
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	defer v.Close(ctx)
+
+	switch args[0] {
+	case "up":
+		return ctxerr.QuickWrap(ctx, v.MigrateUp(ctx))
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				ctx = ctxerr.SetField(ctx, "steps", args[1])
+				return ctxerr.New(ctx, "68cb758c-37ca-4ea6-a959-18abdf94488c", "steps must be a positive number")
+			}
+		}
+		return ctxerr.QuickWrap(ctx, v.MigrateDown(ctx, steps))
+	case "status":
+		statuses, err := v.MigrationStatus(ctx)
+		if err != nil {
+			return ctxerr.QuickWrap(ctx, err)
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.Applied != nil {
+				applied = s.Applied.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return tw.Flush()
+	}
+	ctx = ctxerr.SetField(ctx, "command", args[0])
+	return ctxerr.New(ctx, "0a0fa57e-f4c9-4173-bff1-9b813ce32431", "unknown migrate command, use up, down, or status")
+}
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS logouts;
+DROP TABLE IF EXISTS social_votes;
+DROP TABLE IF EXISTS socials;
+DROP TABLE IF EXISTS domain_links;
+DROP TABLE IF EXISTS domains;
+DROP TABLE IF EXISTS groups;
+DROP TABLE IF EXISTS delete_audits;
+DROP TABLE IF EXISTS users;
+DROP FUNCTION IF EXISTS update_modified_column();
+DROP FUNCTION IF EXISTS uuidv7();
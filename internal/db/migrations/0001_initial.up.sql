@@ -0,0 +1,136 @@
+-- Initial schema. Everything is IF NOT EXISTS so databases that were set up
+-- before migrations existed can be adopted by running this migration.
+
+-- https://postgresql.verite.pro/blog/2024/07/15/uuid-v7-pure-sql.html
+CREATE OR REPLACE FUNCTION uuidv7() RETURNS uuid
+AS $$
+select encode(
+	substring(int8send(floor(t_ms)::int8) from 3) ||
+	int2send((7<<12)::int2 | ((t_ms-floor(t_ms))*4096)::int2) ||
+	substring(uuid_send(gen_random_uuid()) from 9 for 8)
+	, 'hex')::uuid
+	from (select extract(epoch from clock_timestamp())*1000 as t_ms) s
+$$ LANGUAGE sql volatile;
+
+-- Trigger function to update modified column
+CREATE OR REPLACE FUNCTION update_modified_column()
+RETURNS TRIGGER AS $$
+BEGIN
+	NEW.modified = CURRENT_TIMESTAMP;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TABLE IF NOT EXISTS users (
+	id uuid DEFAULT uuidv7() PRIMARY KEY,
+	username TEXT NOT NULL UNIQUE,
+	display_name TEXT,
+
+	deleted BOOLEAN default false,
+	created TIMESTAMP default CURRENT_TIMESTAMP,
+	modified TIMESTAMP default CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS delete_audits (
+	id uuid DEFAULT uuidv7() PRIMARY KEY,
+	table_name TEXT NOT NULL,
+	row_id uuid NOT NULL,
+
+	creator uuid NOT NULL references users(id),
+	deleted BOOLEAN default false,
+	created TIMESTAMP default CURRENT_TIMESTAMP,
+	modified TIMESTAMP default CURRENT_TIMESTAMP,
+	UNIQUE (table_name, row_id)
+);
+
+CREATE TABLE IF NOT EXISTS groups (
+	id uuid DEFAULT uuidv7() PRIMARY KEY,
+	description TEXT,
+	personal_user_id uuid references users(id),
+
+	deleted BOOLEAN default false,
+	creator uuid NOT NULL references users(id),
+	created TIMESTAMP default CURRENT_TIMESTAMP,
+	modified TIMESTAMP default CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_groups_personal_user_id ON groups (personal_user_id);
+COMMENT ON COLUMN groups.personal_user_id IS 'only filled if group is created by user for their own links';
+
+CREATE TABLE IF NOT EXISTS domains (
+	id uuid DEFAULT uuidv7() PRIMARY KEY,
+	display_name TEXT NOT NULL,
+	description TEXT,
+	notes TEXT,
+
+	deleted BOOLEAN default false,
+	creator uuid NOT NULL references users(id),
+	created TIMESTAMP default CURRENT_TIMESTAMP,
+	modified TIMESTAMP default CURRENT_TIMESTAMP,
+	pending BOOLEAN default true
+);
+
+CREATE TABLE IF NOT EXISTS domain_links (
+	id uuid DEFAULT uuidv7() NOT NULL UNIQUE,
+	domain_id uuid NOT NULL references domains(id),
+	link TEXT NOT NULL,
+	country_code TEXT,
+
+	deleted BOOLEAN default false,
+	creator uuid NOT NULL references users(id),
+	created TIMESTAMP default CURRENT_TIMESTAMP,
+	modified TIMESTAMP default CURRENT_TIMESTAMP,
+	pending BOOLEAN default true,
+	PRIMARY KEY (domain_id, link)
+);
+ALTER TABLE domain_links ADD COLUMN IF NOT EXISTS id uuid DEFAULT uuidv7() NOT NULL UNIQUE;
+COMMENT ON COLUMN domain_links.link IS 'this is an app or url';
+
+CREATE TABLE IF NOT EXISTS socials (
+	id uuid DEFAULT uuidv7() PRIMARY KEY,
+	domain_id uuid NOT NULL references domains(id),
+	username TEXT,
+	user_id TEXT,
+	group_id uuid NOT NULL references groups(id),
+
+	deleted BOOLEAN default false,
+	creator uuid NOT NULL references users(id),
+	created TIMESTAMP default CURRENT_TIMESTAMP,
+	modified TIMESTAMP default CURRENT_TIMESTAMP,
+	constraint either_email check (username is not null or user_id is not null),
+	UNIQUE (domain_id, username, user_id, group_id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_socials_account ON socials (domain_id, group_id, username, user_id) NULLS NOT DISTINCT WHERE deleted IS FALSE;
+CREATE INDEX IF NOT EXISTS idx_socials_group_id ON socials (group_id);
+
+CREATE TABLE IF NOT EXISTS social_votes (
+	id uuid DEFAULT uuidv7() PRIMARY KEY,
+	social_id uuid NOT NULL references socials(id),
+	downvote BOOLEAN,
+
+	deleted BOOLEAN default false,
+	user_id uuid NOT NULL references users(id),
+	created TIMESTAMP default CURRENT_TIMESTAMP,
+	modified TIMESTAMP default CURRENT_TIMESTAMP,
+	UNIQUE (social_id, user_id)
+);
+COMMENT ON COLUMN social_votes.downvote IS 'if false then upvote';
+
+CREATE TABLE IF NOT EXISTS logouts (
+	id uuid DEFAULT uuidv7() PRIMARY KEY,
+	jwt_id uuid NOT NULL,
+	expiration TIMESTAMP NOT NULL,
+
+	user_id uuid NOT NULL references users(id),
+	created TIMESTAMP default CURRENT_TIMESTAMP,
+	modified TIMESTAMP default CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_logout_user_id ON logouts (user_id);
+
+CREATE OR REPLACE TRIGGER update_users_modified BEFORE UPDATE ON users FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+CREATE OR REPLACE TRIGGER update_delete_audits_modified BEFORE UPDATE ON delete_audits FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+CREATE OR REPLACE TRIGGER update_groups_modified BEFORE UPDATE ON groups FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+CREATE OR REPLACE TRIGGER update_domains_modified BEFORE UPDATE ON domains FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+CREATE OR REPLACE TRIGGER update_domain_links_modified BEFORE UPDATE ON domain_links FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+CREATE OR REPLACE TRIGGER update_socials_modified BEFORE UPDATE ON socials FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+CREATE OR REPLACE TRIGGER update_social_votes_modified BEFORE UPDATE ON social_votes FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+CREATE OR REPLACE TRIGGER update_logouts_modified BEFORE UPDATE ON logouts FOR EACH ROW EXECUTE FUNCTION update_modified_column();
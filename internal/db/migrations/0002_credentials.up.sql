@@ -0,0 +1,27 @@
+-- Password logins. Users without credentials can only log in with tokens
+-- from other sources.
+CREATE TABLE IF NOT EXISTS credentials (
+	user_id uuid PRIMARY KEY references users(id),
+	email TEXT NOT NULL,
+	password_hash TEXT NOT NULL,
+
+	created TIMESTAMP default CURRENT_TIMESTAMP,
+	modified TIMESTAMP default CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_credentials_email ON credentials (lower(email));
+
+CREATE TABLE IF NOT EXISTS password_resets (
+	id uuid DEFAULT uuidv7() PRIMARY KEY,
+	user_id uuid NOT NULL references users(id),
+	token_hash TEXT NOT NULL UNIQUE,
+	expiration TIMESTAMP NOT NULL,
+	used BOOLEAN default false,
+
+	created TIMESTAMP default CURRENT_TIMESTAMP,
+	modified TIMESTAMP default CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets (user_id);
+COMMENT ON COLUMN password_resets.token_hash IS 'sha256 of the token that was emailed, the token itself is never stored';
+
+CREATE OR REPLACE TRIGGER update_credentials_modified BEFORE UPDATE ON credentials FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+CREATE OR REPLACE TRIGGER update_password_resets_modified BEFORE UPDATE ON password_resets FOR EACH ROW EXECUTE FUNCTION update_modified_column();
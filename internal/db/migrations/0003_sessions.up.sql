@@ -0,0 +1,31 @@
+-- A session is one login on one device. Its refresh tokens are a family,
+-- each refresh uses up the current token and adds the next one.
+CREATE TABLE IF NOT EXISTS sessions (
+	id uuid DEFAULT uuidv7() PRIMARY KEY,
+	user_id uuid NOT NULL references users(id),
+	user_agent TEXT,
+	ip_address TEXT,
+	last_used TIMESTAMP default CURRENT_TIMESTAMP,
+	expiration TIMESTAMP NOT NULL default CURRENT_TIMESTAMP + interval '30 days',
+	revoked BOOLEAN default false,
+
+	created TIMESTAMP default CURRENT_TIMESTAMP,
+	modified TIMESTAMP default CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id uuid DEFAULT uuidv7() PRIMARY KEY,
+	session_id uuid NOT NULL references sessions(id),
+	token_hash TEXT NOT NULL UNIQUE,
+	expiration TIMESTAMP NOT NULL,
+	used BOOLEAN default false,
+
+	created TIMESTAMP default CURRENT_TIMESTAMP,
+	modified TIMESTAMP default CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens (session_id);
+COMMENT ON COLUMN refresh_tokens.used IS 'a used token being sent again means it was stolen so the whole session is revoked';
+
+CREATE OR REPLACE TRIGGER update_sessions_modified BEFORE UPDATE ON sessions FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+CREATE OR REPLACE TRIGGER update_refresh_tokens_modified BEFORE UPDATE ON refresh_tokens FOR EACH ROW EXECUTE FUNCTION update_modified_column();
@@ -0,0 +1,27 @@
+-- Logins with external OpenID Connect providers
+CREATE TABLE IF NOT EXISTS oidc_states (
+	id uuid DEFAULT uuidv7() PRIMARY KEY,
+	provider TEXT NOT NULL,
+	state TEXT NOT NULL UNIQUE,
+	nonce TEXT NOT NULL,
+	code_verifier TEXT NOT NULL,
+	expiration TIMESTAMP NOT NULL default CURRENT_TIMESTAMP + interval '10 minutes',
+
+	created TIMESTAMP default CURRENT_TIMESTAMP
+);
+COMMENT ON TABLE oidc_states IS 'logins waiting on the provider callback, rows are deleted when used';
+
+CREATE TABLE IF NOT EXISTS user_identities (
+	id uuid DEFAULT uuidv7() PRIMARY KEY,
+	user_id uuid NOT NULL references users(id),
+	provider TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	email TEXT,
+
+	created TIMESTAMP default CURRENT_TIMESTAMP,
+	modified TIMESTAMP default CURRENT_TIMESTAMP,
+	UNIQUE (provider, subject)
+);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
+
+CREATE OR REPLACE TRIGGER update_user_identities_modified BEFORE UPDATE ON user_identities FOR EACH ROW EXECUTE FUNCTION update_modified_column();
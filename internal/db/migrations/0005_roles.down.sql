@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS role_audits;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
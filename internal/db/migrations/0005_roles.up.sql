@@ -0,0 +1,16 @@
+-- Roles for moderation and admin. Every change is kept in role_audits.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user'
+	CONSTRAINT users_role_check CHECK (role IN ('user', 'moderator', 'admin'));
+
+CREATE TABLE IF NOT EXISTS role_audits (
+	id uuid DEFAULT uuidv7() PRIMARY KEY,
+	user_id uuid NOT NULL references users(id),
+	old_role TEXT NOT NULL,
+	new_role TEXT NOT NULL,
+	reason TEXT,
+
+	creator uuid references users(id),
+	created TIMESTAMP default CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_role_audits_user_id ON role_audits (user_id);
+COMMENT ON COLUMN role_audits.creator IS 'null when the role was changed with the role command';
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS notifications;
+
+DROP INDEX IF EXISTS idx_domain_links_pending;
+ALTER TABLE domain_links DROP COLUMN IF EXISTS moderated;
+ALTER TABLE domain_links DROP COLUMN IF EXISTS moderator;
+ALTER TABLE domain_links DROP COLUMN IF EXISTS moderation_reason;
+ALTER TABLE domain_links DROP COLUMN IF EXISTS rejected;
+
+DROP INDEX IF EXISTS idx_domains_pending;
+ALTER TABLE domains DROP COLUMN IF EXISTS moderated;
+ALTER TABLE domains DROP COLUMN IF EXISTS moderator;
+ALTER TABLE domains DROP COLUMN IF EXISTS moderation_reason;
+ALTER TABLE domains DROP COLUMN IF EXISTS rejected;
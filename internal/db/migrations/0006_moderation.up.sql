@@ -0,0 +1,31 @@
+-- Moderators approve or reject pending domains and domain links. Rejected
+-- rows stay pending so they are never shown, and leave the queue until the
+-- creator changes them.
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS rejected BOOLEAN default false;
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS moderation_reason TEXT;
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS moderator uuid references users(id);
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS moderated TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_domains_pending ON domains (id) WHERE pending IS TRUE AND rejected IS FALSE AND deleted IS FALSE;
+
+ALTER TABLE domain_links ADD COLUMN IF NOT EXISTS rejected BOOLEAN default false;
+ALTER TABLE domain_links ADD COLUMN IF NOT EXISTS moderation_reason TEXT;
+ALTER TABLE domain_links ADD COLUMN IF NOT EXISTS moderator uuid references users(id);
+ALTER TABLE domain_links ADD COLUMN IF NOT EXISTS moderated TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_domain_links_pending ON domain_links (id) WHERE pending IS TRUE AND rejected IS FALSE AND deleted IS FALSE;
+
+CREATE TABLE IF NOT EXISTS notifications (
+	id uuid DEFAULT uuidv7() PRIMARY KEY,
+	user_id uuid NOT NULL references users(id),
+	type TEXT NOT NULL,
+	item_type TEXT NOT NULL,
+	item_id uuid NOT NULL,
+	message TEXT,
+	read BOOLEAN NOT NULL default false,
+
+	created TIMESTAMP default CURRENT_TIMESTAMP,
+	modified TIMESTAMP default CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications (user_id);
+COMMENT ON COLUMN notifications.item_type IS 'the table of item_id';
+
+CREATE OR REPLACE TRIGGER update_notifications_modified BEFORE UPDATE ON notifications FOR EACH ROW EXECUTE FUNCTION update_modified_column();
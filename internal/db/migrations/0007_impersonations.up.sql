@@ -0,0 +1,14 @@
+-- Admins can act as another user for support, every token they get is kept
+CREATE TABLE IF NOT EXISTS impersonations (
+	id uuid DEFAULT uuidv7() PRIMARY KEY,
+	user_id uuid NOT NULL references users(id),
+	reason TEXT NOT NULL,
+	jwt_id uuid NOT NULL UNIQUE,
+	expiration TIMESTAMP NOT NULL,
+
+	creator uuid NOT NULL references users(id),
+	created TIMESTAMP default CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_impersonations_user_id ON impersonations (user_id);
+CREATE INDEX IF NOT EXISTS idx_impersonations_creator ON impersonations (creator);
+COMMENT ON COLUMN impersonations.creator IS 'the admin acting as user_id';
@@ -0,0 +1,21 @@
+-- API keys for integrations that cannot log in. Only a hash of the key is
+-- kept, the prefix is shown so people can tell their keys apart.
+CREATE TABLE IF NOT EXISTS api_keys (
+	id uuid DEFAULT uuidv7() PRIMARY KEY,
+	user_id uuid NOT NULL references users(id),
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL UNIQUE,
+	key_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	last_used TIMESTAMP,
+	expiration TIMESTAMP,
+
+	deleted BOOLEAN default false,
+	created TIMESTAMP default CURRENT_TIMESTAMP,
+	modified TIMESTAMP default CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys (user_id);
+COMMENT ON COLUMN api_keys.scopes IS 'space separated like the jwt scope claim';
+COMMENT ON COLUMN api_keys.expiration IS 'null keys do not expire';
+
+CREATE OR REPLACE TRIGGER update_api_keys_modified BEFORE UPDATE ON api_keys FOR EACH ROW EXECUTE FUNCTION update_modified_column();
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_logouts_expiration;
+DROP INDEX IF EXISTS idx_logouts_jwt_id;
@@ -0,0 +1,4 @@
+-- Logouts are looked up by the token id and expired ones are purged
+DELETE FROM logouts a USING logouts b WHERE a.jwt_id = b.jwt_id AND a.id > b.id;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_logouts_jwt_id ON logouts (jwt_id);
+CREATE INDEX IF NOT EXISTS idx_logouts_expiration ON logouts (expiration);
@@ -0,0 +1 @@
+ALTER TABLE socials ADD CONSTRAINT socials_domain_id_username_user_id_group_id_key UNIQUE (domain_id, username, user_id, group_id);
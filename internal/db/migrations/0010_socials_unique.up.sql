@@ -0,0 +1,6 @@
+-- Only socials that are not deleted have to be unique so a deleted social can
+-- be added again. The index is made again here instead of trusting the one
+-- from 0001. NULLS NOT DISTINCT needs postgres 15 or later.
+ALTER TABLE socials DROP CONSTRAINT IF EXISTS socials_domain_id_username_user_id_group_id_key;
+DROP INDEX IF EXISTS idx_socials_account;
+CREATE UNIQUE INDEX idx_socials_account ON socials (domain_id, group_id, username, user_id) NULLS NOT DISTINCT WHERE deleted IS FALSE;
@@ -0,0 +1,4 @@
+ALTER TABLE socials DROP COLUMN IF EXISTS acting_user_id;
+ALTER TABLE domain_links DROP COLUMN IF EXISTS acting_user_id;
+ALTER TABLE domains DROP COLUMN IF EXISTS acting_user_id;
+ALTER TABLE groups DROP COLUMN IF EXISTS acting_user_id;
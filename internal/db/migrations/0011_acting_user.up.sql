@@ -0,0 +1,10 @@
+-- Rows made while an admin acts as a user belong to the user, the admin is
+-- kept separately
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS acting_user_id uuid references users(id);
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS acting_user_id uuid references users(id);
+ALTER TABLE domain_links ADD COLUMN IF NOT EXISTS acting_user_id uuid references users(id);
+ALTER TABLE socials ADD COLUMN IF NOT EXISTS acting_user_id uuid references users(id);
+COMMENT ON COLUMN groups.acting_user_id IS 'the admin acting as the creator, null when the creator made it';
+COMMENT ON COLUMN domains.acting_user_id IS 'the admin acting as the creator, null when the creator made it';
+COMMENT ON COLUMN domain_links.acting_user_id IS 'the admin acting as the creator, null when the creator made it';
+COMMENT ON COLUMN socials.acting_user_id IS 'the admin acting as the creator, null when the creator made it';
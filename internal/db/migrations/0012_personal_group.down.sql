@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_groups_personal_user;
@@ -0,0 +1,21 @@
+-- A user has one personal group. Extra ones made by requests that raced are
+-- deleted and their socials moved to the oldest.
+WITH ranked AS (
+	SELECT id, first_value(id) OVER (PARTITION BY personal_user_id ORDER BY created, id) AS keep
+	FROM groups
+	WHERE personal_user_id IS NOT NULL AND deleted IS FALSE
+)
+UPDATE socials SET group_id = ranked.keep
+FROM ranked
+WHERE socials.group_id = ranked.id AND ranked.id <> ranked.keep;
+
+WITH ranked AS (
+	SELECT id, first_value(id) OVER (PARTITION BY personal_user_id ORDER BY created, id) AS keep
+	FROM groups
+	WHERE personal_user_id IS NOT NULL AND deleted IS FALSE
+)
+UPDATE groups SET deleted = true
+FROM ranked
+WHERE groups.id = ranked.id AND ranked.id <> ranked.keep;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_groups_personal_user ON groups (personal_user_id) WHERE deleted IS FALSE;
@@ -0,0 +1,113 @@
+// Package migrations holds the versioned database schema changes.
+//
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql where
+// the version is a number. Versions must start at 1 and have no gaps so every
+// database applies the same changes in the same order.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// All returns the embedded migrations in order
+func All() ([]Migration, error) {
+	return Load(files)
+}
+
+// Load reads and validates the migrations in the root of fsys
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".sql" {
+			continue
+		}
+		version, name, direction, err := parseFilename(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		b, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", e.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names %q and %q", version, m.Name, name)
+		}
+		switch direction {
+		case "up":
+			m.Up = string(b)
+		case "down":
+			m.Down = string(b)
+		}
+	}
+
+	ms := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" {
+			return nil, fmt.Errorf("migration %d_%s is missing an up file", m.Version, m.Name)
+		}
+		if strings.TrimSpace(m.Down) == "" {
+			return nil, fmt.Errorf("migration %d_%s is missing a down file", m.Version, m.Name)
+		}
+		ms = append(ms, *m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	for i, m := range ms {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be sequential, expected %d got %d", i+1, m.Version)
+		}
+	}
+	return ms, nil
+}
+
+// parseFilename splits 0001_initial.up.sql into 1, initial, up
+func parseFilename(filename string) (version int, name, direction string, err error) {
+	base := strings.TrimSuffix(filename, ".sql")
+	base, direction, ok := cutLast(base, ".")
+	if !ok || (direction != "up" && direction != "down") {
+		return 0, "", "", fmt.Errorf("migration %s must end in .up.sql or .down.sql", filename)
+	}
+	v, name, ok := strings.Cut(base, "_")
+	if !ok || name == "" {
+		return 0, "", "", fmt.Errorf("migration %s must be named <version>_<name>", filename)
+	}
+	version, err = strconv.Atoi(v)
+	if err != nil || version < 1 {
+		return 0, "", "", fmt.Errorf("migration %s has an invalid version %q", filename, v)
+	}
+	return version, name, direction, nil
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
@@ -0,0 +1,91 @@
+package migrations_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/mvndaai/known-anywhere/internal/db/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAll(t *testing.T) {
+	ms, err := migrations.All()
+	require.NoError(t, err)
+	require.NotEmpty(t, ms)
+	assert.Equal(t, 1, ms[0].Version)
+	assert.Equal(t, "initial", ms[0].Name)
+}
+
+func TestLoad(t *testing.T) {
+	file := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+
+	tests := []struct {
+		name          string
+		fs            fstest.MapFS
+		expected      []int
+		errorContains string
+	}{
+		{
+			name: "ordered",
+			fs: fstest.MapFS{
+				"0002_b.up.sql":   file("b"),
+				"0002_b.down.sql": file("-b"),
+				"0001_a.up.sql":   file("a"),
+				"0001_a.down.sql": file("-a"),
+				"readme.md":       file("ignored"),
+			},
+			expected: []int{1, 2},
+		},
+		{
+			name:          "missing down",
+			fs:            fstest.MapFS{"0001_a.up.sql": file("a")},
+			errorContains: "missing a down file",
+		},
+		{
+			name: "gap",
+			fs: fstest.MapFS{
+				"0001_a.up.sql":   file("a"),
+				"0001_a.down.sql": file("-a"),
+				"0003_c.up.sql":   file("c"),
+				"0003_c.down.sql": file("-c"),
+			},
+			errorContains: "must be sequential",
+		},
+		{
+			name: "duplicate version",
+			fs: fstest.MapFS{
+				"0001_a.up.sql":   file("a"),
+				"0001_b.down.sql": file("-b"),
+			},
+			errorContains: "has two names",
+		},
+		{
+			name:          "bad direction",
+			fs:            fstest.MapFS{"0001_a.sideways.sql": file("a")},
+			errorContains: ".up.sql or .down.sql",
+		},
+		{
+			name:          "bad version",
+			fs:            fstest.MapFS{"first_a.up.sql": file("a")},
+			errorContains: "invalid version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms, err := migrations.Load(tt.fs)
+			if tt.errorContains != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorContains)
+				return
+			}
+			require.NoError(t, err)
+			var versions []int
+			for _, m := range ms {
+				versions = append(versions, m.Version)
+			}
+			assert.Equal(t, tt.expected, versions)
+		})
+	}
+}
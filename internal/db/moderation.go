@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+const (
+	tableNotifications = "notifications"
+)
+
+// moderationQueueWheres are the rows waiting on a moderator
+func moderationQueueWheres() []Wheres {
+	return []Wheres{
+		{where: "pending IS TRUE"},
+		{where: "rejected IS FALSE"},
+	}
+}
+
+// backToModeration puts a changed row back in the moderation queue
+func backToModeration() []columnValue {
+	return []columnValue{
+		{name: "pending", value: true},
+		{name: "rejected", value: false},
+	}
+}
+
+func (v *DB) ListPendingDomains(ctx context.Context, pagination types.Pagination) ([]types.Domain, types.PaginationResponse, error) {
+	pagination.ShowPending = true
+	vs, pg, err := listItems(ctx, v.db, tableDomains, types.DomainCreate{}, pagination, moderationQueueWheres(),
+		func(rows *sql.Rows) (types.Domain, error) {
+			return scanDomain(rows)
+		})
+	return vs, pg, ctxerr.QuickWrap(ctx, err)
+}
+
+func (v *DB) ListPendingDomainLinks(ctx context.Context, pagination types.Pagination) ([]types.DomainLink, types.PaginationResponse, error) {
+	pagination.ShowPending = true
+	vs, pg, err := listItems(ctx, v.db, tableDomainLinks, types.DomainLinkCreate{}, pagination, moderationQueueWheres(),
+		func(rows *sql.Rows) (types.DomainLink, error) {
+			return scanDomainLink(rows)
+		})
+	return vs, pg, ctxerr.QuickWrap(ctx, err)
+}
+
+func (v *DB) ApproveDomain(ctx context.Context, id string) error {
+	return ctxerr.QuickWrap(ctx, v.moderate(ctx, tableDomains, id, nil))
+}
+
+func (v *DB) RejectDomain(ctx context.Context, id string, r types.Rejection) error {
+	return ctxerr.QuickWrap(ctx, v.moderate(ctx, tableDomains, id, &r))
+}
+
+func (v *DB) ApproveDomainLink(ctx context.Context, id string) error {
+	return ctxerr.QuickWrap(ctx, v.moderate(ctx, tableDomainLinks, id, nil))
+}
+
+func (v *DB) RejectDomainLink(ctx context.Context, id string, r types.Rejection) error {
+	return ctxerr.QuickWrap(ctx, v.moderate(ctx, tableDomainLinks, id, &r))
+}
+
+// moderate approves the pending row, or rejects it when there is a rejection,
+// and notifies the creator
+func (v *DB) moderate(ctx context.Context, tableName, id string, rejection *types.Rejection) error {
+	ctx = ctxerr.SetField(ctx, "table", tableName)
+	ctx = ctxerr.SetField(ctx, "id", id)
+	if !tableHasPending[tableName] {
+		return ctxerr.New(ctx, "ff3defac-5467-4254-ab5d-f67471b6e446", "table does not support moderation")
+	}
+
+	notification := types.Notification{Type: types.NotificationApproved, ItemType: tableName}
+	var reason *string
+	if rejection != nil {
+		notification.Type = types.NotificationRejected
+		notification.Message = rejection.Reason
+		reason = &rejection.Reason
+	}
+
+	tx, err := v.db.BeginTx(ctx, nil)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "9477fd67-d936-4bb1-a5d2-832882bfc97b", "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	var creator uuid.UUID
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`
+		UPDATE %s
+		SET pending = $2, rejected = $3, moderation_reason = $4, moderator = $5, moderated = CURRENT_TIMESTAMP
+		WHERE id = $1 AND pending IS TRUE AND rejected IS FALSE AND deleted IS FALSE
+		RETURNING id, creator
+	`, tableName), id, rejection != nil, rejection != nil, reason, jwt.ActorFromContext(ctx)).Scan(&notification.ItemID, &creator)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ctxerr.NewHTTP(ctx, "1b21cf33-6906-4a3f-b631-ab5bc2107349", "not found", http.StatusNotFound, tableName+" not pending")
+	}
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "ee8ab012-3fa1-4de8-bb66-2197b8a88e7d", "failed to moderate")
+	}
+
+	err = addNotification(ctx, tx, creator, notification)
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ctxerr.Wrap(ctx, err, "6f01b6f6-c182-4917-a7bd-7145be74824e", "failed to commit moderation")
+	}
+	return nil
+}
+
+func scanNotification(scanner interface {
+	Scan(dest ...any) error
+}) (types.Notification, error) {
+	var n types.Notification
+	err := scanner.Scan(
+		&n.ID,
+		&n.Type,
+		&n.ItemType,
+		&n.ItemID,
+		NullableScan(func(v string) { n.Message = v }),
+		&n.Read,
+		&n.Created,
+	)
+	return n, err
+}
+
+func addNotification(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}, userID uuid.UUID, n types.Notification) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO notifications (user_id, type, item_type, item_id, message)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+	`, userID, n.Type, n.ItemType, n.ItemID, n.Message)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "83e23879-d276-43ee-b44d-aa4815f0d19a", "failed to create notification")
+	}
+	return nil
+}
+
+// ListNotifications lists the notifications of the subject
+func (v *DB) ListNotifications(ctx context.Context, filters types.NotificationFilters, pagination types.Pagination) ([]types.Notification, types.PaginationResponse, error) {
+	filters.UserID = jwt.SubjectFromContext(ctx)
+	vs, pg, err := listItems(ctx, v.db, tableNotifications, filters, pagination, nil,
+		func(rows *sql.Rows) (types.Notification, error) {
+			return scanNotification(rows)
+		})
+	return vs, pg, ctxerr.QuickWrap(ctx, err)
+}
+
+// ReadNotification marks one of the subject's notifications as read
+func (v *DB) ReadNotification(ctx context.Context, id string) error {
+	res, err := v.db.ExecContext(ctx, `
+		UPDATE notifications SET read = true
+		WHERE id = $1 AND user_id = $2
+	`, id, jwt.SubjectFromContext(ctx))
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "39824d86-8a09-4894-946a-8a66b9cae0f0", "failed to read notification")
+	}
+	return ctxerr.QuickWrap(ctx, ensureRowAffected(ctx, res, tableNotifications))
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+const (
+	tableOIDCStates     = "oidc_states"
+	tableUserIdentities = "user_identities"
+
+	usernameAttempts = 5
+	// usernameSuffixLength is a dash and 6 hex characters
+	usernameSuffixLength = 7
+)
+
+// CreateOIDCState stores a started provider login until its callback
+func (v *DB) CreateOIDCState(ctx context.Context, s types.OIDCState) error {
+	// Logins that were never finished are cleaned up as new ones start
+	_, err := v.db.ExecContext(ctx, `DELETE FROM oidc_states WHERE expiration < CURRENT_TIMESTAMP`)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "e0124c68-f956-44dc-8dc5-14d67dd4cdfc", "failed to delete expired oidc states")
+	}
+
+	_, err = insertAndReturnID(ctx, v.db, tableOIDCStates, s)
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+// ConsumeOIDCState gets and deletes the login for the callback state so it
+// can only be used once
+func (v *DB) ConsumeOIDCState(ctx context.Context, provider, state string) (types.OIDCState, error) {
+	s := types.OIDCState{Provider: provider, State: state}
+	var expired bool
+	err := v.db.QueryRowContext(ctx, `
+		DELETE FROM oidc_states
+		WHERE provider = $1 AND state = $2
+		RETURNING nonce, code_verifier, expiration < CURRENT_TIMESTAMP
+	`, provider, state).Scan(&s.Nonce, &s.CodeVerifier, &expired)
+	if errors.Is(err, sql.ErrNoRows) || expired {
+		ctx = ctxerr.SetField(ctx, "provider", provider)
+		return s, ctxerr.NewHTTP(ctx, "1de5dc95-e72e-42a8-812c-830eb3f2bd89", "login expired, please try again", http.StatusBadRequest, "oidc state not found")
+	}
+	if err != nil {
+		return s, ctxerr.Wrap(ctx, err, "ec109418-4427-48f4-9a1b-5e25a09fac6f", "failed to get oidc state")
+	}
+	return s, nil
+}
+
+// UserForIdentity gets the user linked to the provider identity, creating one
+// the first time the identity logs in. Existing accounts are not linked by
+// email because providers do not all verify emails the same way.
+func (v *DB) UserForIdentity(ctx context.Context, identity types.Identity) (types.User, error) {
+	ctx = ctxerr.SetField(ctx, "provider", identity.Provider)
+	var u types.User
+	var deleted bool
+	err := v.db.QueryRowContext(ctx, `
+		SELECT u.id, u.username, u.display_name, u.role, u.deleted
+		FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.provider = $1 AND i.subject = $2
+	`, identity.Provider, identity.Subject).Scan(
+		&u.ID,
+		NullableScan(func(v string) { u.Username = v }),
+		NullableScan(func(v string) { u.DisplayName = v }),
+		&u.Role,
+		&deleted,
+	)
+	if err == nil {
+		if deleted {
+			return u, ctxerr.NewHTTP(ctx, "b33264c1-a448-40bc-a89e-7a862cc6dce6", "account deleted", http.StatusForbidden, "identity user deleted")
+		}
+		return u, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return u, ctxerr.Wrap(ctx, err, "1f0689b9-bb3e-48b2-93c6-8b958624b96e", "failed to get identity")
+	}
+
+	u.Username, err = v.availableUsername(ctx, identity.Username())
+	if err != nil {
+		return u, ctxerr.QuickWrap(ctx, err)
+	}
+	u.DisplayName = identity.Name
+	u.Role = types.RoleUser
+
+	tx, err := v.db.BeginTx(ctx, nil)
+	if err != nil {
+		return u, ctxerr.Wrap(ctx, err, "4e7c5798-ff45-4295-b7c8-e3613adeac73", "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	u.ID, err = insertAndReturnID(ctx, tx, tableUsers, u.UserCreate)
+	if err != nil {
+		return u, ctxerr.QuickWrap(ctx, err)
+	}
+	_, err = insertAndReturnID(ctx, tx, tableUserIdentities, identity, columnValue{name: "user_id", value: u.ID})
+	if err != nil {
+		return u, ctxerr.QuickWrap(ctx, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return u, ctxerr.Wrap(ctx, err, "c5b7a59a-b91d-4cb5-a9aa-3e80368af7e7", "failed to commit identity")
+	}
+	return u, nil
+}
+
+// availableUsername adds a random suffix when the username is taken, the
+// username is shortened so it still fits with the suffix
+func (v *DB) availableUsername(ctx context.Context, username string) (string, error) {
+	candidate := username
+	base := username
+	if maxBase := types.MaxUsernameLength - usernameSuffixLength; len(base) > maxBase {
+		base = strings.TrimRight(base[:maxBase], "._-")
+	}
+	for range usernameAttempts {
+		taken, err := v.usernameTaken(ctx, candidate)
+		if err != nil {
+			return "", ctxerr.QuickWrap(ctx, err)
+		}
+		if !taken {
+			return candidate, nil
+		}
+
+		b := make([]byte, 3)
+		if _, err := rand.Read(b); err != nil {
+			return "", ctxerr.Wrap(ctx, err, "f33af8c3-137d-44aa-b5ef-de2d605c6c34", "failed to create username suffix")
+		}
+		candidate = base + "-" + hex.EncodeToString(b)
+	}
+	ctx = ctxerr.SetField(ctx, "username", username)
+	return "", ctxerr.New(ctx, "b22236c1-ba0a-4325-8524-11309c028745", "could not find an available username")
+}
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/known-anywhere/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvailableUsernameFits(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+
+	// A taken username as long as they can be gets a suffix without going over
+	username := strings.Repeat("a", types.MaxUsernameLength-8) + uuid.NewString()[:8]
+	_, err := d.CreateUser(ctx, types.UserCreate{Username: username, DisplayName: username})
+	require.NoError(t, err)
+
+	got, err := d.availableUsername(ctx, username)
+	require.NoError(t, err)
+	assert.NotEqual(t, username, got)
+	assert.LessOrEqual(t, len(got), types.MaxUsernameLength)
+	assert.True(t, strings.HasPrefix(got, username[:types.MaxUsernameLength-usernameSuffixLength]))
+}
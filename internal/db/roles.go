@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+const (
+	tableRoleAudits = "role_audits"
+)
+
+func scanRoleAudit(scanner interface {
+	Scan(dest ...any) error
+}) (types.RoleAudit, error) {
+	var a types.RoleAudit
+	err := scanner.Scan(
+		&a.ID,
+		&a.UserID,
+		&a.OldRole,
+		&a.NewRole,
+		NullableScan(func(v string) { a.Reason = v }),
+		NullableScan(func(v uuid.UUID) { a.Creator = &v }),
+		&a.Created,
+	)
+	return a, err
+}
+
+// SetUserRole changes the role of a user and records who changed it. The
+// user's sessions are revoked because their tokens still carry the old role.
+func (v *DB) SetUserRole(ctx context.Context, id string, rc types.RoleChange) (types.RoleAudit, error) {
+	ctx = ctxerr.SetField(ctx, "user_id", id)
+	var creator *uuid.UUID
+	if actor := jwt.ActorFromContext(ctx); actor != uuid.Nil {
+		if actor.String() == id || jwt.SubjectFromContext(ctx).String() == id {
+			return types.RoleAudit{}, ctxerr.NewHTTP(ctx, "28e61c18-7e67-4926-9c3b-9d2a6ee75804", "you cannot change your own role", http.StatusForbidden, "role change of the subject")
+		}
+		creator = &actor
+	}
+
+	tx, err := v.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.RoleAudit{}, ctxerr.Wrap(ctx, err, "24e84016-e038-4b35-94c3-8ebf6a824bbf", "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	var oldRole types.Role
+	err = tx.QueryRowContext(ctx, `SELECT role FROM users WHERE id = $1 AND deleted IS FALSE FOR UPDATE`, id).Scan(&oldRole)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.RoleAudit{}, ctxerr.NewHTTP(ctx, "fc3b7e8d-403b-4168-b650-6007006a86ec", "not found", http.StatusNotFound, tableUsers+" not found")
+	}
+	if err != nil {
+		return types.RoleAudit{}, ctxerr.Wrap(ctx, err, "e03dcf95-c841-4097-8698-0b2821d601ab", "failed to get user role")
+	}
+	if oldRole == rc.Role {
+		ctx = ctxerr.SetField(ctx, "role", rc.Role)
+		return types.RoleAudit{}, ctxerr.NewHTTP(ctx, "daea6f7a-bfd6-488c-93fa-062f803b63b7", "user already has that role", http.StatusConflict, "role unchanged")
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET role = $2 WHERE id = $1`, id, rc.Role); err != nil {
+		return types.RoleAudit{}, ctxerr.Wrap(ctx, constraintErrorToHTTP(ctx, err), "48e1866c-ac9f-41d5-b58b-0279ea7a930c", "failed to update role")
+	}
+
+	a, err := scanRoleAudit(tx.QueryRowContext(ctx, `
+		INSERT INTO role_audits (user_id, old_role, new_role, reason, creator)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		RETURNING `+getSelectFields[types.RoleAudit]()+`
+	`, id, oldRole, rc.Role, rc.Reason, creator))
+	if err != nil {
+		return types.RoleAudit{}, ctxerr.Wrap(ctx, err, "d91971e1-aadc-4839-9f11-9be09045ef64", "failed to create role audit")
+	}
+
+	sessionIDs, err := revokeSessions(ctx, tx, []Wheres{{where: "user_id = ", arg: id}})
+	if err != nil {
+		return types.RoleAudit{}, ctxerr.QuickWrap(ctx, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.RoleAudit{}, ctxerr.Wrap(ctx, err, "4c7cdcc6-a1d9-44b7-a5f9-7c0b5bc0f72d", "failed to commit role change")
+	}
+	v.cache.DeleteSession(sessionIDs...)
+	return a, nil
+}
+
+func (v *DB) ListRoleAudits(ctx context.Context, filters types.RoleAuditFilters, pagination types.Pagination) ([]types.RoleAudit, types.PaginationResponse, error) {
+	vs, pg, err := listItems(ctx, v.db, tableRoleAudits, filters, pagination, nil,
+		func(rows *sql.Rows) (types.RoleAudit, error) {
+			return scanRoleAudit(rows)
+		})
+	return vs, pg, ctxerr.QuickWrap(ctx, err)
+}
+
+// RoleCommand runs `role <username> <role> [reason]`, it is how the first
+// admin is made
+func RoleCommand(ctx context.Context, args []string, w io.Writer) error {
+	if len(args) < 2 {
+		return ctxerr.New(ctx, "b06e2e2a-bf89-431f-aa63-9aec241aed2b", "usage: role <username> user|moderator|admin [reason]")
+	}
+
+	rc := types.RoleChange{Role: types.Role(args[1]), Reason: strings.Join(args[2:], " ")}
+	rc.Normalize()
+	if err := rc.Validate(ctx); err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+
+	v, err := New(ctx)
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	defer v.Close(ctx)
+
+	users, _, err := v.ListUsers(ctx, types.UserCreate{Username: args[0]}, types.Pagination{Limit: 1})
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	if len(users) == 0 {
+		ctx = ctxerr.SetField(ctx, "username", args[0])
+		return ctxerr.New(ctx, "900af16e-380f-4a6d-a972-5fc29a52c888", "user not found")
+	}
+
+	a, err := v.SetUserRole(ctx, users[0].ID.String(), rc)
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	fmt.Fprintf(w, "%s is now %s (was %s)\n", users[0].Username, a.NewRole, a.OldRole)
+	return nil
+}
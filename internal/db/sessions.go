@@ -0,0 +1,270 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+const (
+	tableSessions      = "sessions"
+	tableRefreshTokens = "refresh_tokens"
+
+	// refreshTokenTTL slides forward every refresh so active sessions stay
+	// logged in
+	refreshTokenTTL = "30 days"
+)
+
+func scanSession(scanner interface {
+	Scan(dest ...any) error
+}) (types.Session, error) {
+	var s types.Session
+	err := scanner.Scan(
+		&s.ID,
+		NullableScan(func(v string) { s.UserAgent = v }),
+		NullableScan(func(v string) { s.IPAddress = v }),
+		&s.LastUsed,
+		&s.Expiration,
+		&s.Created,
+	)
+	return s, err
+}
+
+func newRefreshToken(ctx context.Context) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", ctxerr.Wrap(ctx, err, "62bf16b1-29fe-48e2-bf05-9a4235f3b52b", "failed to create refresh token")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// addRefreshToken adds the next token of the session family and slides the
+// session expiration to match it
+func addRefreshToken(ctx context.Context, tx *sql.Tx, sessionID uuid.UUID) (types.Session, string, error) {
+	token, err := newRefreshToken(ctx)
+	if err != nil {
+		return types.Session{}, "", ctxerr.QuickWrap(ctx, err)
+	}
+
+	s, err := scanSession(tx.QueryRowContext(ctx, `
+		UPDATE sessions
+		SET expiration = CURRENT_TIMESTAMP + $2::interval, last_used = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING `+getSelectFields[types.Session]()+`
+	`, sessionID, refreshTokenTTL))
+	if err != nil {
+		return types.Session{}, "", ctxerr.Wrap(ctx, err, "bb3a2178-aec9-464c-975b-2a08ba0f09ad", "failed to update session")
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (session_id, token_hash, expiration)
+		VALUES ($1, $2, $3)
+	`, sessionID, hashToken(token), s.Expiration)
+	if err != nil {
+		return types.Session{}, "", ctxerr.Wrap(ctx, err, "278549bb-2990-47ac-940f-a59fcb25a95d", "failed to create refresh token")
+	}
+	return s, token, nil
+}
+
+// CreateSession starts a session for a login and returns its first refresh token
+func (v *DB) CreateSession(ctx context.Context, sc types.SessionCreate) (types.Session, string, error) {
+	tx, err := v.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.Session{}, "", ctxerr.Wrap(ctx, err, "bd54003a-db55-4d7f-8cd4-d71afc22af0d", "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	id, err := insertAndReturnID(ctx, tx, tableSessions, sc)
+	if err != nil {
+		return types.Session{}, "", ctxerr.QuickWrap(ctx, err)
+	}
+
+	s, token, err := addRefreshToken(ctx, tx, id)
+	if err != nil {
+		return types.Session{}, "", ctxerr.QuickWrap(ctx, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.Session{}, "", ctxerr.Wrap(ctx, err, "51012b25-bfcf-4b00-b4b4-9a827968f420", "failed to commit session")
+	}
+	s.Current = true
+	return s, token, nil
+}
+
+func invalidRefreshToken(ctx context.Context) error {
+	return ctxerr.NewHTTP(ctx, "e26f6bac-9901-48c5-b732-ea172fbc7ed3", "invalid refresh token", http.StatusUnauthorized, "refresh token not valid")
+}
+
+// RefreshSession swaps a refresh token for the next one in its family. A token
+// that was already used revokes the session because either the client or an
+// attacker has a stolen copy.
+func (v *DB) RefreshSession(ctx context.Context, token string) (types.User, types.Session, string, error) {
+	var u types.User
+	tx, err := v.db.BeginTx(ctx, nil)
+	if err != nil {
+		return u, types.Session{}, "", ctxerr.Wrap(ctx, err, "3b7a8dce-9f59-4283-b81e-b4d77425b83f", "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	var tokenID, sessionID uuid.UUID
+	var used, revoked, expired bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT rt.id, rt.session_id, rt.used, s.revoked OR u.deleted, rt.expiration <= CURRENT_TIMESTAMP,
+			u.id, u.username, u.display_name, u.role
+		FROM refresh_tokens rt
+		JOIN sessions s ON s.id = rt.session_id
+		JOIN users u ON u.id = s.user_id
+		WHERE rt.token_hash = $1
+		FOR UPDATE OF rt, s
+	`, hashToken(token)).Scan(
+		&tokenID, &sessionID, &used, &revoked, &expired,
+		&u.ID,
+		NullableScan(func(v string) { u.Username = v }),
+		NullableScan(func(v string) { u.DisplayName = v }),
+		&u.Role,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, types.Session{}, "", invalidRefreshToken(ctx)
+	}
+	if err != nil {
+		return u, types.Session{}, "", ctxerr.Wrap(ctx, err, "70a09881-f9a3-4b75-a4dc-2dc306df8259", "failed to get refresh token")
+	}
+	ctx = ctxerr.SetField(ctx, "session_id", sessionID)
+
+	if used && !revoked {
+		if _, err := revokeSessions(ctx, tx, []Wheres{{where: "id = ", arg: sessionID}}); err != nil {
+			return u, types.Session{}, "", ctxerr.QuickWrap(ctx, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return u, types.Session{}, "", ctxerr.Wrap(ctx, err, "6f0ad786-4d66-467f-b19a-a80e164339a9", "failed to commit session revoke")
+		}
+		v.cache.DeleteSession(sessionID)
+		return u, types.Session{}, "", ctxerr.NewHTTP(ctx, "1696add0-83b9-484d-b776-1b6b5f12c583", "invalid refresh token", http.StatusUnauthorized, "refresh token reused, session revoked")
+	}
+	if used || revoked || expired {
+		return u, types.Session{}, "", invalidRefreshToken(ctx)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE refresh_tokens SET used = true WHERE id = $1`, tokenID)
+	if err != nil {
+		return u, types.Session{}, "", ctxerr.Wrap(ctx, err, "9f3f348d-9dc3-4f97-9c46-e4cc4f295f80", "failed to use refresh token")
+	}
+
+	s, next, err := addRefreshToken(ctx, tx, sessionID)
+	if err != nil {
+		return u, types.Session{}, "", ctxerr.QuickWrap(ctx, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return u, types.Session{}, "", ctxerr.Wrap(ctx, err, "5a05b5ba-7a58-4ffe-a89c-e73fa1d98738", "failed to commit refresh")
+	}
+	s.Current = true
+	return u, s, next, nil
+}
+
+// ListSessions lists the active sessions of the subject
+func (v *DB) ListSessions(ctx context.Context, pagination types.Pagination) ([]types.Session, types.PaginationResponse, error) {
+	current := jwt.SessionIDFromContext(ctx)
+	vs, pg, err := listItems(ctx, v.db, tableSessions, types.SessionFilters{UserID: jwt.SubjectFromContext(ctx)}, pagination, activeSessionWheres(),
+		func(rows *sql.Rows) (types.Session, error) {
+			s, err := scanSession(rows)
+			s.Current = s.ID == current
+			return s, err
+		})
+	return vs, pg, ctxerr.QuickWrap(ctx, err)
+}
+
+func activeSessionWheres() []Wheres {
+	return []Wheres{
+		{where: "revoked IS FALSE"},
+		{where: "expiration > CURRENT_TIMESTAMP"},
+	}
+}
+
+// RevokeSession logs out one of the subject's sessions
+func (v *DB) RevokeSession(ctx context.Context, id string) error {
+	ids, err := revokeSessions(ctx, v.db, []Wheres{
+		{where: "id = ", arg: id},
+		{where: "user_id = ", arg: jwt.SubjectFromContext(ctx)},
+	})
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	if len(ids) == 0 {
+		ctx = ctxerr.SetField(ctx, "id", id)
+		return ctxerr.NewHTTP(ctx, "0a802aad-81e6-4880-afec-e02bf78d19ed", "not found", http.StatusNotFound, tableSessions+" not found")
+	}
+	v.cache.DeleteSession(ids...)
+	return nil
+}
+
+// RevokeAllSessions logs the subject out everywhere
+func (v *DB) RevokeAllSessions(ctx context.Context) error {
+	ids, err := revokeSessions(ctx, v.db, []Wheres{{where: "user_id = ", arg: jwt.SubjectFromContext(ctx)}})
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	v.cache.DeleteSession(ids...)
+	return nil
+}
+
+// revokeSessions revokes the active sessions matching wheres, db is a *sql.DB
+// or *sql.Tx
+func revokeSessions(ctx context.Context, db interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}, wheres []Wheres) ([]uuid.UUID, error) {
+	wc := whereClause{}
+	for _, w := range append(wheres, activeSessionWheres()...) {
+		wc.Add(w.where, w.arg)
+	}
+	where, args := wc.WhereAndArgs()
+	rows, err := db.QueryContext(ctx, `UPDATE sessions SET revoked = true `+where+` RETURNING id`, args...)
+	if err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "7ab0a272-c9a5-4cf4-9e4c-36fbf5a3f2b3", "failed to revoke sessions")
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, ctxerr.Wrap(ctx, err, "e6ce6798-2d64-4e9f-9a61-8ea306f7e34a", "failed to scan revoked session")
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "729a59ee-1730-4485-ace3-96f37f5bb581", "failed to revoke sessions")
+	}
+	return ids, nil
+}
+
+// sessionActive checks that a session is not revoked or expired
+func (v *DB) sessionActive(ctx context.Context, sessionID uuid.UUID) error {
+	active, ok := v.cache.GetSession(sessionID)
+	if !ok {
+		generation := v.cache.Generation()
+		err := v.db.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM sessions
+				WHERE id = $1 AND revoked IS FALSE AND expiration > CURRENT_TIMESTAMP
+			)
+		`, sessionID).Scan(&active)
+		if err != nil {
+			return ctxerr.Wrap(ctx, err, "4c09772e-d745-4683-a930-1be98ac3636a", "failed to check session")
+		}
+		v.cache.SetSession(sessionID, active, generation)
+	}
+	if !active {
+		ctx = ctxerr.SetField(ctx, "session_id", sessionID)
+		return ctxerr.NewHTTP(ctx, "a68e1138-33c1-49d5-98cb-e04d05767bfa", "session logged out", http.StatusUnauthorized, "session not active")
+	}
+	return nil
+}
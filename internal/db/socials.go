@@ -0,0 +1,242 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+const (
+	tableSocials = "socials"
+)
+
+func scanSocial(scanner interface {
+	Scan(dest ...any) error
+}) (types.Social, error) {
+	var s types.Social
+	err := scanner.Scan(
+		&s.ID,
+		&s.DomainID,
+		&s.Username,
+		&s.UserID,
+		&s.GroupID,
+	)
+	return s, err
+}
+
+// CreateSocial adds an account to a group, if no group is given the account
+// is attached to the creator's personal group
+func (v *DB) CreateSocial(ctx context.Context, s types.SocialCreate) (uuid.UUID, error) {
+	if s.GroupID == uuid.Nil {
+		groupID, err := v.personalGroupID(ctx, jwt.SubjectFromContext(ctx))
+		if err != nil {
+			return uuid.UUID{}, ctxerr.QuickWrap(ctx, err)
+		}
+		s.GroupID = groupID
+	} else if err := v.checkGroupOwner(ctx, s.GroupID); err != nil {
+		return uuid.UUID{}, ctxerr.QuickWrap(ctx, err)
+	}
+	id, err := insertAndReturnID(ctx, v.db, tableSocials, s, creatorColumns(ctx)...)
+	return id, ctxerr.QuickWrap(ctx, err)
+}
+
+// personalGroupID finds the user's personal group, creating it if needed. A
+// user has one personal group so when two requests create it at once the one
+// that loses reads the group of the other.
+func (v *DB) personalGroupID(ctx context.Context, userID uuid.UUID) (uuid.UUID, error) {
+	groups, _, err := v.ListGroups(ctx, types.GroupCreate{PersonalUserID: &userID}, types.Pagination{Limit: 1})
+	if err != nil {
+		return uuid.UUID{}, ctxerr.QuickWrap(ctx, err)
+	}
+	if len(groups) > 0 {
+		return groups[0].ID, nil
+	}
+
+	g := types.GroupCreate{Description: "Personal group", PersonalUserID: &userID}
+	query, args := insertQuery(tableGroups, g, creatorColumns(ctx)...)
+	query += "ON CONFLICT DO NOTHING RETURNING id"
+	var id uuid.UUID
+	err = v.db.QueryRowContext(ctx, query, args...).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err := v.db.QueryRowContext(ctx, "SELECT id FROM groups WHERE personal_user_id = $1 AND deleted IS FALSE", userID).Scan(&id)
+		if err != nil {
+			return uuid.UUID{}, ctxerr.Wrap(ctx, err, "c6772d15-c635-4b4b-9033-d9eb015a98e2", "failed to get personal group")
+		}
+		return id, nil
+	}
+	if err != nil {
+		ctx = ctxerr.SetField(ctx, "query", query)
+		return uuid.UUID{}, ctxerr.Wrap(ctx, constraintErrorToHTTP(ctx, err), "14a5f7cd-3450-4ae0-bb2e-37aada8ee9a6", "failed to create personal group")
+	}
+	return id, nil
+}
+
+func (v *DB) GetSocial(ctx context.Context, id string) (types.Social, error) {
+	vs, err := get(ctx, v.db, tableSocials, id, types.Pagination{}, scanSocial)
+	if err != nil {
+		return vs, ctxerr.QuickWrap(ctx, err)
+	}
+	totals, err := v.voteTotals(ctx, []uuid.UUID{vs.ID})
+	if err != nil {
+		return vs, ctxerr.QuickWrap(ctx, err)
+	}
+	vs.Votes = totals[vs.ID]
+	return vs, nil
+}
+
+// ListSocials lists socials with their votes. Sorting by score is only allowed
+// within a group.
+func (v *DB) ListSocials(ctx context.Context, filters types.SocialFilters, pagination types.Pagination, sortBy string) ([]types.Social, types.PaginationResponse, error) {
+	if sortBy == types.SocialSortScore {
+		vs, pg, err := v.listSocialsByScore(ctx, filters, pagination)
+		return vs, pg, ctxerr.QuickWrap(ctx, err)
+	}
+
+	vs, pg, err := listItems(ctx, v.db, tableSocials, filters, pagination, nil,
+		func(rows *sql.Rows) (types.Social, error) {
+			return scanSocial(rows)
+		})
+	if err != nil {
+		return vs, pg, ctxerr.QuickWrap(ctx, err)
+	}
+	if err := v.addVotes(ctx, vs); err != nil {
+		return vs, pg, ctxerr.QuickWrap(ctx, err)
+	}
+	return vs, pg, nil
+}
+
+// scoreCursor is where a page sorted by score ends, the next page starts after
+// it in (score desc, id) order
+type scoreCursor struct {
+	score int
+	id    uuid.UUID
+}
+
+func (c scoreCursor) String() string { return fmt.Sprintf("%d_%s", c.score, c.id) }
+
+func parseScoreCursor(ctx context.Context, cursor string) (scoreCursor, error) {
+	score, id, _ := strings.Cut(cursor, "_")
+	var c scoreCursor
+	var err error
+	if c.score, err = strconv.Atoi(score); err == nil {
+		c.id, err = uuid.Parse(id)
+	}
+	if err != nil {
+		ctx = ctxerr.SetField(ctx, "cursor", cursor)
+		return c, ctxerr.WrapHTTP(ctx, err, "ba57528e-682b-4690-b151-535375d43868", "invalid cursor", http.StatusBadRequest, "invalid score cursor")
+	}
+	return c, nil
+}
+
+// listSocialsByScore pages through socials from the highest score, the score
+// is totaled in the query so every page can be reached
+func (v *DB) listSocialsByScore(ctx context.Context, filters types.SocialFilters, pagination types.Pagination) ([]types.Social, types.PaginationResponse, error) {
+	pagination.Normalize()
+	pr := types.PaginationResponse{}
+
+	wc := whereClause{}
+	if !pagination.ShowDeleted {
+		wc.Add("s.deleted IS FALSE", nil)
+	}
+	if filters.GroupID != uuid.Nil {
+		wc.Add("s.group_id = ", filters.GroupID)
+	}
+	if filters.DomainID != uuid.Nil {
+		wc.Add("s.domain_id = ", filters.DomainID)
+	}
+	if filters.Username != "" {
+		wc.Add("s.username = ", filters.Username)
+	}
+	where, args := wc.WhereAndArgs()
+	err := v.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM socials s "+where, args...).Scan(&pr.Total)
+	if err != nil {
+		return nil, pr, ctxerr.Wrap(ctx, err, "cde6b047-2a97-4df9-b648-7b544d232ea8", "failed to count socials")
+	}
+
+	page := ""
+	if pagination.Cursor != "" {
+		c, err := parseScoreCursor(ctx, pagination.Cursor)
+		if err != nil {
+			return nil, pr, ctxerr.QuickWrap(ctx, err)
+		}
+		page = fmt.Sprintf("WHERE score < %s OR (score = %s AND id > %s)", wc.nextVar(), wc.nextVar(), wc.nextVar())
+		args = append(args, c.score, c.score, c.id)
+	}
+	limit := wc.nextVar()
+	args = append(args, pagination.Limit)
+
+	query := fmt.Sprintf(`
+		SELECT id, domain_id, username, user_id, group_id, up, down, up - down AS score
+		FROM (
+			SELECT s.id, s.domain_id, s.username, s.user_id, s.group_id,
+				COUNT(sv.id) FILTER (WHERE sv.downvote IS FALSE) AS up,
+				COUNT(sv.id) FILTER (WHERE sv.downvote IS TRUE) AS down
+			FROM socials s
+			LEFT JOIN social_votes sv ON sv.social_id = s.id AND sv.deleted IS FALSE
+			%s
+			GROUP BY s.id
+		) scored
+		%s
+		ORDER BY score DESC, id ASC
+		LIMIT %s
+	`, where, page, limit)
+	rows, err := v.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		ctx = ctxerr.SetField(ctx, "query", query)
+		return nil, pr, ctxerr.Wrap(ctx, err, "9f1ff394-560f-4e6a-baa4-f0c508ea8718", "failed to list socials by score")
+	}
+	defer rows.Close()
+
+	vs := []types.Social{}
+	for rows.Next() {
+		var s types.Social
+		var up, down, score int
+		err := rows.Scan(&s.ID, &s.DomainID, &s.Username, &s.UserID, &s.GroupID, &up, &down, &score)
+		if err != nil {
+			return nil, pr, ctxerr.Wrap(ctx, err, "b5cea77b-8fff-47bb-accd-5e90282f2c1b", "failed to scan social")
+		}
+		s.Votes = types.NewVotes(up, down)
+		vs = append(vs, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, pr, ctxerr.Wrap(ctx, err, "9b18067b-e622-4d3d-8f64-f92721b66a9d", "failed to read socials")
+	}
+	if l := len(vs); l > 0 && l == pagination.Limit {
+		last := vs[l-1]
+		pr.Cursor = scoreCursor{score: last.Votes.Score, id: last.ID}.String()
+	}
+	return vs, pr, nil
+}
+
+// UpdateSocial changes the set fields of a social, only the creator can update
+// it and it can only be moved to one of their groups
+func (v *DB) UpdateSocial(ctx context.Context, id string, s types.SocialUpdate) error {
+	if s.GroupID != nil {
+		if err := v.checkGroupOwner(ctx, *s.GroupID); err != nil {
+			return ctxerr.QuickWrap(ctx, err)
+		}
+	}
+	err := updateByID(ctx, v.db, tableSocials, id, s, creatorWheres(ctx))
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+// DeleteSocial soft deletes a social, only the creator can delete it
+func (v *DB) DeleteSocial(ctx context.Context, id string) error {
+	err := softDeleteByID(ctx, v.db, tableSocials, id, creatorWheres(ctx))
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+// RestoreSocial undoes a delete, only the creator can restore it
+func (v *DB) RestoreSocial(ctx context.Context, id string) error {
+	err := restoreByID(ctx, v.db, tableSocials, id, creatorWheres(ctx))
+	return ctxerr.QuickWrap(ctx, err)
+}
@@ -0,0 +1,172 @@
+package db
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/mvndaai/known-anywhere/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateDeletedSocial(t *testing.T) {
+	d := testDB(t)
+	ctx := asNewUser(t, d)
+
+	domainID, err := d.CreateDomain(ctx, types.DomainCreate{DisplayName: "example.com"})
+	require.NoError(t, err)
+	username := "someone"
+	social := types.SocialCreate{DomainID: domainID, Username: &username}
+
+	id, err := d.CreateSocial(ctx, social)
+	require.NoError(t, err)
+	_, err = d.CreateSocial(ctx, social)
+	assert.Error(t, err, "the same account twice")
+
+	require.NoError(t, d.DeleteSocial(ctx, id.String()))
+	recreated, err := d.CreateSocial(ctx, social)
+	require.NoError(t, err)
+	assert.NotEqual(t, id, recreated)
+}
+
+func TestListSocialsByScore(t *testing.T) {
+	d := testDB(t)
+	ctx := asNewUser(t, d)
+
+	domainID, err := d.CreateDomain(ctx, types.DomainCreate{DisplayName: "example.com"})
+	require.NoError(t, err)
+	var ids []uuid.UUID
+	for _, name := range []string{"a", "b", "c"} {
+		id, err := d.CreateSocial(ctx, types.SocialCreate{DomainID: domainID, Username: &name})
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	s, err := d.GetSocial(ctx, ids[0].String())
+	require.NoError(t, err)
+
+	// c has two up votes, a has one down vote and b has none
+	for range 2 {
+		require.NoError(t, d.VoteSocial(asNewUser(t, d), ids[2].String(), types.VoteCreate{Vote: types.VoteUp}))
+	}
+	require.NoError(t, d.VoteSocial(asNewUser(t, d), ids[0].String(), types.VoteCreate{Vote: types.VoteDown}))
+
+	var got []uuid.UUID
+	pagination := types.Pagination{Limit: 1}
+	for range len(ids) + 1 {
+		vs, pr, err := d.ListSocials(ctx, types.SocialFilters{GroupID: s.GroupID}, pagination, types.SocialSortScore)
+		require.NoError(t, err)
+		assert.Equal(t, len(ids), pr.Total)
+		for _, v := range vs {
+			got = append(got, v.ID)
+		}
+		if pr.Cursor == "" {
+			break
+		}
+		pagination.Cursor = pr.Cursor
+	}
+	assert.Equal(t, []uuid.UUID{ids[2], ids[1], ids[0]}, got)
+
+	_, _, err = d.ListSocials(ctx, types.SocialFilters{GroupID: s.GroupID}, types.Pagination{Cursor: "bad"}, types.SocialSortScore)
+	assert.Error(t, err)
+}
+
+func TestMoveSocialToGroup(t *testing.T) {
+	d := testDB(t)
+	ctx := asNewUser(t, d)
+	other := asNewUser(t, d)
+
+	domainID, err := d.CreateDomain(ctx, types.DomainCreate{DisplayName: "example.com"})
+	require.NoError(t, err)
+	username := "someone"
+	id, err := d.CreateSocial(ctx, types.SocialCreate{DomainID: domainID, Username: &username})
+	require.NoError(t, err)
+
+	otherGroup, err := d.CreateGroup(other, types.GroupCreate{Description: "other"})
+	require.NoError(t, err)
+	err = d.UpdateSocial(ctx, id.String(), types.SocialUpdate{GroupID: &otherGroup})
+	assert.Equal(t, http.StatusForbidden, statusCode(ctx, err))
+	_, err = d.CreateSocial(ctx, types.SocialCreate{DomainID: domainID, Username: &username, GroupID: otherGroup})
+	assert.Equal(t, http.StatusForbidden, statusCode(ctx, err))
+
+	missing := uuid.New()
+	err = d.UpdateSocial(ctx, id.String(), types.SocialUpdate{GroupID: &missing})
+	assert.Equal(t, http.StatusNotFound, statusCode(ctx, err))
+
+	ownGroup, err := d.CreateGroup(ctx, types.GroupCreate{Description: "own"})
+	require.NoError(t, err)
+	require.NoError(t, d.DeleteGroup(ctx, ownGroup.String()))
+	err = d.UpdateSocial(ctx, id.String(), types.SocialUpdate{GroupID: &ownGroup})
+	assert.Equal(t, http.StatusNotFound, statusCode(ctx, err))
+
+	require.NoError(t, d.RestoreGroup(ctx, ownGroup.String()))
+	require.NoError(t, d.UpdateSocial(ctx, id.String(), types.SocialUpdate{GroupID: &ownGroup}))
+	s, err := d.GetSocial(ctx, id.String())
+	require.NoError(t, err)
+	assert.Equal(t, ownGroup, s.GroupID)
+}
+
+func TestCreateSocialActingAsUser(t *testing.T) {
+	d := testDB(t)
+	ctx := asNewUser(t, d)
+	admin := jwt.SubjectFromContext(asNewUser(t, d))
+	acting := jwt.ContextWithActor(ctx, admin.String())
+
+	domainID, err := d.CreateDomain(ctx, types.DomainCreate{DisplayName: "example.com"})
+	require.NoError(t, err)
+	username := "someone"
+	id, err := d.CreateSocial(acting, types.SocialCreate{DomainID: domainID, Username: &username})
+	require.NoError(t, err)
+
+	var creator uuid.UUID
+	var actingUserID *uuid.UUID
+	err = d.db.QueryRowContext(ctx, "SELECT creator, acting_user_id FROM socials WHERE id = $1", id).Scan(&creator, &actingUserID)
+	require.NoError(t, err)
+	assert.Equal(t, jwt.SubjectFromContext(ctx), creator)
+	if assert.NotNil(t, actingUserID) {
+		assert.Equal(t, admin, *actingUserID)
+	}
+
+	// The social went to the user's personal group and they can change it
+	s, err := d.GetSocial(ctx, id.String())
+	require.NoError(t, err)
+	g, err := d.GetGroup(ctx, s.GroupID.String())
+	require.NoError(t, err)
+	if assert.NotNil(t, g.PersonalUserID) {
+		assert.Equal(t, jwt.SubjectFromContext(ctx), *g.PersonalUserID)
+	}
+	assert.NoError(t, d.DeleteSocial(ctx, id.String()))
+}
+
+func TestConcurrentPersonalGroup(t *testing.T) {
+	d := testDB(t)
+	ctx := asNewUser(t, d)
+
+	domainID, err := d.CreateDomain(ctx, types.DomainCreate{DisplayName: "example.com"})
+	require.NoError(t, err)
+
+	ids := make([]uuid.UUID, 8)
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			username := "someone" + strconv.Itoa(i)
+			id, err := d.CreateSocial(ctx, types.SocialCreate{DomainID: domainID, Username: &username})
+			assert.NoError(t, err)
+			ids[i] = id
+		}()
+	}
+	wg.Wait()
+
+	groups := map[uuid.UUID]bool{}
+	for _, id := range ids {
+		s, err := d.GetSocial(ctx, id.String())
+		require.NoError(t, err)
+		groups[s.GroupID] = true
+	}
+	assert.Len(t, groups, 1)
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/jwt"
 	"github.com/mvndaai/known-anywhere/internal/types"
 )
 
@@ -22,6 +23,7 @@ func scanUser(scanner interface {
 		&u.ID,
 		NullableScan(func(v string) { u.Username = v }),
 		NullableScan(func(v string) { u.DisplayName = v }),
+		&u.Role,
 	)
 	return u, err
 }
@@ -32,7 +34,7 @@ func (v *DB) CreateUser(ctx context.Context, u types.UserCreate) (uuid.UUID, err
 }
 
 func (v *DB) GetUser(ctx context.Context, id string) (types.User, error) {
-	vs, err := get(ctx, v.db, tableUsers, id, scanUser)
+	vs, err := get(ctx, v.db, tableUsers, id, types.Pagination{}, scanUser)
 	return vs, ctxerr.QuickWrap(ctx, err)
 }
 
@@ -45,12 +47,54 @@ func (v *DB) ListUsers(ctx context.Context, filters types.UserCreate, pagination
 }
 
 func (v *DB) UsernameAvalaible(ctx context.Context, username string) error {
-	users, _, err := v.ListUsers(ctx, types.UserCreate{Username: username}, types.Pagination{Limit: 1, ShowDeleted: true})
+	taken, err := v.usernameTaken(ctx, username)
 	if err != nil {
 		return ctxerr.QuickWrap(ctx, err)
 	}
-	if len(users) > 0 {
+	if taken {
 		return ctxerr.NewHTTP(ctx, "33ec3b54-4673-4a0d-8836-cac4e555e6f9", "Username is not avalaible", http.StatusBadRequest, "Username is not avalaible")
 	}
 	return nil
 }
+
+// usernameTaken includes deleted users so their usernames are not reused
+func (v *DB) usernameTaken(ctx context.Context, username string) (bool, error) {
+	users, _, err := v.ListUsers(ctx, types.UserCreate{Username: username}, types.Pagination{Limit: 1, ShowDeleted: true})
+	if err != nil {
+		return false, ctxerr.QuickWrap(ctx, err)
+	}
+	return len(users) > 0, nil
+}
+
+// ensureSelf makes sure users only change their own account, admins can
+// change any account
+func ensureSelf(ctx context.Context, id string) error {
+	if id != jwt.SubjectFromContext(ctx).String() && !jwt.RoleFromContext(ctx).AtLeast(types.RoleAdmin) {
+		return ctxerr.NewHTTP(ctx, "57dbdee8-37d5-4674-9379-029b956d5086", "users can only change themselves", http.StatusForbidden, "user is not the subject")
+	}
+	return nil
+}
+
+func (v *DB) UpdateUser(ctx context.Context, id string, u types.UserUpdate) error {
+	if err := ensureSelf(ctx, id); err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	err := updateByID(ctx, v.db, tableUsers, id, u, nil)
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+func (v *DB) DeleteUser(ctx context.Context, id string) error {
+	if err := ensureSelf(ctx, id); err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	err := softDeleteByID(ctx, v.db, tableUsers, id, nil)
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+func (v *DB) RestoreUser(ctx context.Context, id string) error {
+	if err := ensureSelf(ctx, id); err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	err := restoreByID(ctx, v.db, tableUsers, id, nil)
+	return ctxerr.QuickWrap(ctx, err)
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+const (
+	tableSocialVotes = "social_votes"
+)
+
+// VoteSocial sets the caller's vote on a social, a clear vote soft deletes it
+func (v *DB) VoteSocial(ctx context.Context, socialID string, vote types.VoteCreate) error {
+	userID := jwt.SubjectFromContext(ctx)
+	var downvote *bool
+	switch vote.Vote {
+	case types.VoteUp:
+		downvote = new(bool)
+	case types.VoteDown:
+		downvote = new(bool)
+		*downvote = true
+	}
+	cleared := vote.Vote == types.VoteClear
+
+	res, err := v.db.ExecContext(ctx, `
+		INSERT INTO social_votes (social_id, user_id, downvote, deleted)
+		SELECT id, $2, $3, $4 FROM socials WHERE id = $1 AND deleted IS FALSE
+		ON CONFLICT (social_id, user_id) DO UPDATE
+		SET downvote = EXCLUDED.downvote, deleted = EXCLUDED.deleted
+	`, socialID, userID, downvote, cleared)
+	if err != nil {
+		return ctxerr.Wrap(ctx, constraintErrorToHTTP(ctx, err), "29ad0564-027f-4cdd-8d54-ca9f1a989e11", "failed to vote")
+	}
+	return ctxerr.QuickWrap(ctx, ensureRowAffected(ctx, res, tableSocials))
+}
+
+// voteTotals gets the up and down vote counts for each social
+func (v *DB) voteTotals(ctx context.Context, socialIDs []uuid.UUID) (map[uuid.UUID]types.Votes, error) {
+	totals := map[uuid.UUID]types.Votes{}
+	if len(socialIDs) == 0 {
+		return totals, nil
+	}
+	ids := make([]string, len(socialIDs))
+	for i, id := range socialIDs {
+		ids[i] = id.String()
+	}
+
+	rows, err := v.db.QueryContext(ctx, `
+		SELECT
+			social_id,
+			COUNT(*) FILTER (WHERE downvote IS FALSE),
+			COUNT(*) FILTER (WHERE downvote IS TRUE)
+		FROM social_votes
+		WHERE social_id = ANY($1::uuid[]) AND deleted IS FALSE
+		GROUP BY social_id
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "395855ab-b838-406e-854d-b8f83ea71a17", "failed to total votes")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		var up, down int
+		if err := rows.Scan(&id, &up, &down); err != nil {
+			return nil, ctxerr.Wrap(ctx, err, "3c033908-e9db-4df0-9e5f-4704138d2a8e", "failed to scan vote totals")
+		}
+		totals[id] = types.NewVotes(up, down)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "5a143d05-db7f-4a02-a9e8-7af857889723", "failed to read vote totals")
+	}
+	return totals, nil
+}
+
+// addVotes fills in the vote totals on each social
+func (v *DB) addVotes(ctx context.Context, socials []types.Social) error {
+	ids := make([]uuid.UUID, len(socials))
+	for i, s := range socials {
+		ids[i] = s.ID
+	}
+	totals, err := v.voteTotals(ctx, ids)
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	for i := range socials {
+		socials[i].Votes = totals[socials[i].ID]
+	}
+	return nil
+}
@@ -4,11 +4,17 @@ import (
 	"context"
 
 	"github.com/google/uuid"
+	"github.com/mvndaai/known-anywhere/internal/types"
 )
 
 type contextKey string
 
-const subjectContextKey = contextKey("subject")
+const (
+	subjectContextKey   = contextKey("subject")
+	sessionIDContextKey = contextKey("session_id")
+	claimsContextKey    = contextKey("claims")
+	actorContextKey     = contextKey("actor")
+)
 
 func ContextWithSubject(ctx context.Context, subject string) context.Context {
 	return context.WithValue(ctx, subjectContextKey, subject)
@@ -22,3 +28,58 @@ func SubjectFromContext(ctx context.Context) uuid.UUID {
 	}
 	return uuid.UUID{}
 }
+
+// ContextWithActor sets who is acting as the subject
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey, actor)
+}
+
+// ActorFromContext is who is really making the request. It is the subject
+// unless someone is acting as them.
+func ActorFromContext(ctx context.Context) uuid.UUID {
+	if v, ok := ctx.Value(actorContextKey).(string); ok {
+		if id, err := uuid.Parse(v); err == nil {
+			return id
+		}
+	}
+	return SubjectFromContext(ctx)
+}
+
+// Impersonating checks if the actor is not the subject
+func Impersonating(ctx context.Context) bool {
+	return ActorFromContext(ctx) != SubjectFromContext(ctx)
+}
+
+func ContextWithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionIDContextKey, sessionID)
+}
+
+// SessionIDFromContext is the session of the token, tokens that were not from
+// a login have no session
+func SessionIDFromContext(ctx context.Context) uuid.UUID {
+	if v, ok := ctx.Value(sessionIDContextKey).(string); ok {
+		if id, err := uuid.Parse(v); err == nil {
+			return id
+		}
+	}
+	return uuid.UUID{}
+}
+
+func ContextWithClaims(ctx context.Context, claims *JWTClaims) context.Context {
+	return context.WithValue(ctx, claimsContextKey, claims)
+}
+
+// RoleFromContext is the role from the token claims, it is a user when there
+// are no claims
+func RoleFromContext(ctx context.Context) types.Role {
+	if claims, ok := ClaimsFromContext(ctx); ok && claims.Role != "" {
+		return claims.Role
+	}
+	return types.RoleUser
+}
+
+// ClaimsFromContext gets the claims checked by the jwt middleware
+func ClaimsFromContext(ctx context.Context) (*JWTClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*JWTClaims)
+	return claims, ok && claims != nil
+}
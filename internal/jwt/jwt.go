@@ -4,24 +4,69 @@ import (
 	"context"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/mvndaai/ctxerr"
 	"github.com/mvndaai/known-anywhere/internal/config"
+	"github.com/mvndaai/known-anywhere/internal/types"
 )
 
 const (
 	HeaderAuthorization       = "Authorization"
 	HeaderAuthorizationPrefix = "Bearer "
+	HeaderAPIKey              = "X-Api-Key"
+
+	// AudienceAPI is the audience of tokens from our logins
+	AudienceAPI = "known-anywhere-api"
+)
+
+// Scopes limit what a token can do. Tokens without a scope claim can do
+// everything their role allows.
+const (
+	ScopeAdmin           = "admin"
+	ScopeAccount         = "account"
+	ScopeDomainWrite     = "domain:write"
+	ScopeDomainLinkWrite = "domain_link:write"
+	ScopeUserWrite       = "user:write"
+	ScopeGroupWrite      = "group:write"
+	ScopeSocialWrite     = "social:write"
+	ScopeSocialVote      = "social:vote"
+	ScopeModerate        = "moderate"
 )
 
+// DelegatedScopes are every scope except account and admin. They are for
+// tokens that act for a user without owning the account, like API keys.
+var DelegatedScopes = []string{
+	ScopeDomainWrite,
+	ScopeDomainLinkWrite,
+	ScopeUserWrite,
+	ScopeGroupWrite,
+	ScopeSocialWrite,
+	ScopeSocialVote,
+	ScopeModerate,
+}
+
 type JWTClaims struct {
 	jwt.RegisteredClaims
 	Username string `json:"username"`
-	// TODO should there be a way to act as?
+	// SessionID is set on tokens from a login so they are revoked with the session
+	SessionID string `json:"sid,omitempty"`
+	// Scope is a space separated list of scopes
+	Scope string `json:"scope,omitempty"`
+	// Role is the role of the user when the token was issued
+	Role types.Role `json:"role,omitempty"`
+	// Act is the real user when someone is acting as the subject
+	Act *Actor `json:"act,omitempty"`
+}
+
+// Actor is the RFC 8693 act claim
+type Actor struct {
+	Subject string `json:"sub"`
 }
 
 func issuer() string {
@@ -66,11 +111,10 @@ func (c *JWTClaims) Normalize(ctx context.Context) {
 	}
 }
 
-func (c *JWTClaims) EnsureClaims(ctx context.Context, method, path string, params url.Values, aud string) error {
+func (c *JWTClaims) EnsureClaims(ctx context.Context, method, path string, params url.Values, aud string, scopes []string) error {
 	ctx = ctxerr.SetField(ctx, "method", method)
 	ctx = ctxerr.SetField(ctx, "path", path)
 	ctx = ctxerr.SetField(ctx, "params", params)
-	_ = aud // TODO: use aud
 
 	if c == nil {
 		return ctxerr.New(ctx, "1a071b29-4c11-41ca-b765-7e50bd7227ad", "nil claims")
@@ -86,23 +130,62 @@ func (c *JWTClaims) EnsureClaims(ctx context.Context, method, path string, param
 		return ctxerr.NewHTTP(ctx, "a525f59f-f5e9-40d9-9956-aa089e84ea02", "invalid issuer", http.StatusUnauthorized, "invalid issuer")
 	}
 
+	return ctxerr.QuickWrap(ctx, c.EnsureAccess(ctx, aud, scopes))
+}
+
+// EnsureAccess checks the token is for the audience and has the scopes
+func (c *JWTClaims) EnsureAccess(ctx context.Context, aud string, scopes []string) error {
+	if aud != "" && !slices.ContainsFunc(c.Audience, func(a string) bool { return strings.EqualFold(a, aud) }) {
+		ctx = ctxerr.SetField(ctx, "audienceToken", c.Audience)
+		ctx = ctxerr.SetField(ctx, "audienceRoute", aud)
+		return ctxerr.NewHTTP(ctx, "7a4ae78a-bd04-4a8c-b1ae-8b94d3304e3a", "token not issued for this audience", http.StatusUnauthorized, "invalid audience")
+	}
+
+	if missing := c.MissingScopes(scopes...); len(missing) > 0 {
+		ctx = ctxerr.SetField(ctx, "missingScopes", missing)
+		return ctxerr.NewHTTP(ctx, "35eb3cf4-7e72-47dd-aa59-cc906d950bcb", "token missing scopes: "+strings.Join(missing, " "), http.StatusForbidden, "missing scopes")
+	}
+
 	return nil
 }
 
+// Scopes splits the scope claim
+func (c JWTClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// MissingScopes returns the required scopes the token does not have. An empty
+// scope claim has every scope except admin, which only admins get, and the
+// admin scope has every scope.
+func (c JWTClaims) MissingScopes(required ...string) []string {
+	have := c.Scopes()
+	if slices.Contains(have, ScopeAdmin) {
+		return nil
+	}
+	var missing []string
+	for _, r := range required {
+		if len(have) == 0 && (r != ScopeAdmin || c.Role.AtLeast(types.RoleAdmin)) {
+			continue
+		}
+		if !slices.Contains(have, r) {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
 func GetJWTClaims(r *http.Request) (*JWTClaims, error) {
 	ctx := r.Context()
 	jwtToken := strings.TrimPrefix(r.Header.Get(HeaderAuthorization), HeaderAuthorizationPrefix)
 	if jwtToken == "" {
 		return nil, ctxerr.NewHTTP(ctx, "670a3fb3-1539-4a20-acdd-0bb0f425bf95", "missing auth token", http.StatusUnauthorized, "missing token")
 	}
+	kr, err := DefaultKeyring()
+	if err != nil {
+		return nil, ctxerr.QuickWrap(ctx, err)
+	}
 	claims := &JWTClaims{}
-	_, err := jwt.ParseWithClaims(jwtToken, claims, func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
-		if !ok {
-			return "", ctxerr.NewHTTP(ctx, "e4cd2a10-e084-4186-85a5-1788fcfad945", "", http.StatusUnauthorized, "bad token signing method")
-		}
-		return []byte(config.Get().JWTSecret), nil
-	})
+	_, err = jwt.ParseWithClaims(jwtToken, claims, kr.Keyfunc(time.Now()), jwt.WithValidMethods(kr.ValidMethods()))
 	if err != nil {
 		return nil, ctxerr.WrapHTTP(ctx, err, "a6c3217d-0f6b-4153-8789-128e5cefc43d", err.Error(), http.StatusUnauthorized)
 	}
@@ -113,9 +196,27 @@ func GetJWTClaims(r *http.Request) (*JWTClaims, error) {
 	return claims, nil
 }
 
+// DefaultKeyring is the keyring from config, it is loaded once
+var DefaultKeyring = sync.OnceValues(func() (*Keyring, error) {
+	ctx := context.Background()
+	kcs, err := ParseKeyConfigs(config.Get().JWTKeys)
+	if err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "a4fc9234-8e95-4a9d-8393-e3d7991df5c4", "could not parse jwt keys")
+	}
+	kr, err := NewKeyring(kcs, config.Get().JWTSecret)
+	if err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "e5214619-9a0d-4b0e-bc8f-888e0adb0c23", "could not load jwt keys")
+	}
+	return kr, nil
+})
+
 // GenerateJWT creates a JWT with our claims
 func GenerateJWT(ctx context.Context, claims JWTClaims) (string, error) {
-	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.Get().JWTSecret))
+	kr, err := DefaultKeyring()
+	if err != nil {
+		return "", ctxerr.QuickWrap(ctx, err)
+	}
+	token, err := kr.Sign(claims, time.Now())
 	if err != nil {
 		return "", ctxerr.Wrap(ctx, err, "757b2749-1bea-4d79-91e0-826766773357", "could not sign jwt")
 	}
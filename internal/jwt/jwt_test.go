@@ -0,0 +1,127 @@
+package jwt_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+	ctxerrhttp "github.com/mvndaai/ctxerr/http"
+	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/mvndaai/known-anywhere/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMissingScopes(t *testing.T) {
+	tests := []struct {
+		name     string
+		scope    string
+		role     types.Role
+		required []string
+		expected []string
+	}{
+		{name: "nothing required", scope: "domain:write"},
+		{name: "no scope claim is a full user token", required: []string{jwt.ScopeDomainWrite, jwt.ScopeAccount}},
+		{name: "no scope claim is not admin", required: []string{jwt.ScopeAdmin}, expected: []string{jwt.ScopeAdmin}},
+		{name: "no scope claim is admin for admins", role: types.RoleAdmin, required: []string{jwt.ScopeAdmin}},
+		{name: "narrow admin token", role: types.RoleAdmin, scope: "domain:write", required: []string{jwt.ScopeAdmin}, expected: []string{jwt.ScopeAdmin}},
+		{name: "has scope", scope: "social:vote domain:write", required: []string{jwt.ScopeDomainWrite}},
+		{name: "missing scope", scope: "social:vote", required: []string{jwt.ScopeDomainWrite, jwt.ScopeSocialVote}, expected: []string{jwt.ScopeDomainWrite}},
+		{name: "admin has everything", scope: "admin", required: []string{jwt.ScopeDomainWrite, jwt.ScopeAdmin}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := jwt.JWTClaims{Scope: tt.scope, Role: tt.role}
+			assert.Equal(t, tt.expected, c.MissingScopes(tt.required...))
+		})
+	}
+}
+
+func TestEnsureClaims(t *testing.T) {
+	ctx := context.Background()
+	valid := func() jwt.JWTClaims {
+		c := jwt.JWTClaims{}
+		c.Audience = gojwt.ClaimStrings{jwt.AudienceAPI}
+		c.Normalize(ctx)
+		return c
+	}
+
+	tests := []struct {
+		name          string
+		claims        func() jwt.JWTClaims
+		aud           string
+		scopes        []string
+		status        int
+		errorContains string
+	}{
+		{name: "valid", claims: valid, aud: jwt.AudienceAPI, scopes: []string{jwt.ScopeDomainWrite}},
+		{name: "no audience required", claims: func() jwt.JWTClaims { c := valid(); c.Audience = nil; return c }},
+		{
+			name:          "wrong audience",
+			claims:        func() jwt.JWTClaims { c := valid(); c.Audience = gojwt.ClaimStrings{"other"}; return c },
+			aud:           jwt.AudienceAPI,
+			status:        http.StatusUnauthorized,
+			errorContains: "invalid audience",
+		},
+		{
+			name:          "missing audience",
+			claims:        func() jwt.JWTClaims { c := valid(); c.Audience = nil; return c },
+			aud:           jwt.AudienceAPI,
+			status:        http.StatusUnauthorized,
+			errorContains: "invalid audience",
+		},
+		{
+			name:          "missing scope",
+			claims:        func() jwt.JWTClaims { c := valid(); c.Scope = jwt.ScopeSocialVote; return c },
+			aud:           jwt.AudienceAPI,
+			scopes:        []string{jwt.ScopeDomainWrite},
+			status:        http.StatusForbidden,
+			errorContains: "missing scopes",
+		},
+		{
+			name:          "wrong issuer",
+			claims:        func() jwt.JWTClaims { c := valid(); c.Issuer = "someone"; return c },
+			status:        http.StatusUnauthorized,
+			errorContains: "invalid issuer",
+		},
+		{
+			name:          "missing expiration",
+			claims:        func() jwt.JWTClaims { c := valid(); c.ExpiresAt = nil; return c },
+			status:        http.StatusUnauthorized,
+			errorContains: "exp",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.claims()
+			err := c.EnsureClaims(ctx, http.MethodGet, "/", nil, tt.aud, tt.scopes)
+			if tt.errorContains == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.errorContains)
+			status, _ := ctxerrhttp.StatusCodeAndResponse(ctxerr.QuickWrap(ctx, err), false, false)
+			assert.Equal(t, tt.status, status)
+		})
+	}
+}
+
+func TestActorFromContext(t *testing.T) {
+	subject := uuid.New()
+	actor := uuid.New()
+
+	ctx := context.Background()
+	assert.Equal(t, uuid.Nil, jwt.ActorFromContext(ctx))
+	assert.False(t, jwt.Impersonating(ctx))
+
+	ctx = jwt.ContextWithSubject(ctx, subject.String())
+	assert.Equal(t, subject, jwt.ActorFromContext(ctx))
+	assert.False(t, jwt.Impersonating(ctx))
+
+	ctx = jwt.ContextWithActor(ctx, actor.String())
+	assert.Equal(t, subject, jwt.SubjectFromContext(ctx))
+	assert.Equal(t, actor, jwt.ActorFromContext(ctx))
+	assert.True(t, jwt.Impersonating(ctx))
+}
@@ -0,0 +1,272 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const minRSABits = 2048
+
+// KeyConfig is one signing key from the JWT_KEYS config. A key signs from
+// ActiveFrom until a newer key is active and keeps verifying until RetireAt,
+// so RetireAt should be at least the max token lifetime after the next key
+// is active. Keys are published in the JWKS before they are active so other
+// services already have them when they start being used.
+type KeyConfig struct {
+	ID             string     `json:"kid"`
+	Algorithm      string     `json:"alg"`
+	PrivateKey     string     `json:"private_key"`
+	PrivateKeyFile string     `json:"private_key_file"`
+	ActiveFrom     time.Time  `json:"active_from"`
+	RetireAt       *time.Time `json:"retire_at"`
+}
+
+type signingKey struct {
+	KeyConfig
+	method  jwt.SigningMethod
+	private crypto.Signer
+}
+
+// Keyring signs and verifies our tokens
+type Keyring struct {
+	keys       []signingKey // sorted by ActiveFrom
+	hmacSecret []byte
+}
+
+// JWK is a public key in a JWKS
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// ParseKeyConfigs reads the JSON list of keys
+func ParseKeyConfigs(raw string) ([]KeyConfig, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var kcs []KeyConfig
+	if err := json.Unmarshal([]byte(raw), &kcs); err != nil {
+		return nil, fmt.Errorf("invalid JWT_KEYS: %w", err)
+	}
+	return kcs, nil
+}
+
+// NewKeyring loads the keys. The hmac secret is optional, when it is set HS256
+// tokens are accepted and it signs if no other key is active.
+func NewKeyring(kcs []KeyConfig, hmacSecret string) (*Keyring, error) {
+	kr := &Keyring{}
+	if hmacSecret != "" {
+		kr.hmacSecret = []byte(hmacSecret)
+	}
+
+	for _, kc := range kcs {
+		if kc.ID == "" {
+			return nil, errors.New("jwt key missing kid")
+		}
+		if slices.ContainsFunc(kr.keys, func(k signingKey) bool { return k.ID == kc.ID }) {
+			return nil, fmt.Errorf("jwt key %q: duplicate kid", kc.ID)
+		}
+		if kc.RetireAt != nil && !kc.RetireAt.After(kc.ActiveFrom) {
+			return nil, fmt.Errorf("jwt key %q: retire_at must be after active_from", kc.ID)
+		}
+		k, err := loadKey(kc)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", kc.ID, err)
+		}
+		kr.keys = append(kr.keys, k)
+	}
+	sort.SliceStable(kr.keys, func(i, j int) bool { return kr.keys[i].ActiveFrom.Before(kr.keys[j].ActiveFrom) })
+
+	if len(kr.keys) == 0 && kr.hmacSecret == nil {
+		return nil, errors.New("either JWT_KEYS or JWT_SECRET is required")
+	}
+	return kr, nil
+}
+
+func loadKey(kc KeyConfig) (signingKey, error) {
+	k := signingKey{KeyConfig: kc}
+	data := []byte(kc.PrivateKey)
+	if kc.PrivateKeyFile != "" {
+		var err error
+		data, err = os.ReadFile(kc.PrivateKeyFile)
+		if err != nil {
+			return k, err
+		}
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return k, errors.New("private key is not PEM")
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return k, err
+	}
+
+	switch kc.Algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		rk, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return k, errors.New("RS256 needs an RSA key")
+		}
+		if rk.N.BitLen() < minRSABits {
+			return k, fmt.Errorf("RSA key must be at least %d bits", minRSABits)
+		}
+		k.method, k.private = jwt.SigningMethodRS256, rk
+	case jwt.SigningMethodES256.Alg():
+		ek, ok := parsed.(*ecdsa.PrivateKey)
+		if !ok || ek.Curve != elliptic.P256() {
+			return k, errors.New("ES256 needs a P-256 key")
+		}
+		k.method, k.private = jwt.SigningMethodES256, ek
+	case jwt.SigningMethodEdDSA.Alg():
+		ek, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return k, errors.New("EdDSA needs an Ed25519 key")
+		}
+		k.method, k.private = jwt.SigningMethodEdDSA, ek
+	default:
+		return k, fmt.Errorf("unsupported alg %q", kc.Algorithm)
+	}
+	return k, nil
+}
+
+func (k signingKey) retired(now time.Time) bool {
+	return k.RetireAt != nil && !now.Before(*k.RetireAt)
+}
+
+// signingKey is the newest active key that is not retired
+func (kr *Keyring) signingKey(now time.Time) (signingKey, bool) {
+	for i := len(kr.keys) - 1; i >= 0; i-- {
+		k := kr.keys[i]
+		if !k.ActiveFrom.After(now) && !k.retired(now) {
+			return k, true
+		}
+	}
+	return signingKey{}, false
+}
+
+// Sign signs with the active key, falling back to the hmac secret
+func (kr *Keyring) Sign(claims jwt.Claims, now time.Time) (string, error) {
+	if k, ok := kr.signingKey(now); ok {
+		token := jwt.NewWithClaims(k.method, claims)
+		token.Header["kid"] = k.ID
+		return token.SignedString(k.private)
+	}
+	if kr.hmacSecret != nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(kr.hmacSecret)
+	}
+	return "", errors.New("no active jwt signing key")
+}
+
+// ValidMethods are the algorithms tokens can be signed with
+func (kr *Keyring) ValidMethods() []string {
+	var methods []string
+	for _, k := range kr.keys {
+		if !slices.Contains(methods, k.method.Alg()) {
+			methods = append(methods, k.method.Alg())
+		}
+	}
+	if kr.hmacSecret != nil {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	return methods
+}
+
+// Keyfunc finds the verification key by kid. The alg has to match the key so
+// a public key can never be used as an hmac secret.
+func (kr *Keyring) Keyfunc(now time.Time) jwt.Keyfunc {
+	return func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			if kr.hmacSecret != nil && t.Method == jwt.SigningMethodHS256 {
+				return kr.hmacSecret, nil
+			}
+			return nil, errors.New("token missing kid")
+		}
+		for _, k := range kr.keys {
+			if k.ID != kid {
+				continue
+			}
+			if k.retired(now) {
+				return nil, fmt.Errorf("key %q retired", kid)
+			}
+			if t.Method.Alg() != k.method.Alg() {
+				return nil, fmt.Errorf("key %q is not %s", kid, t.Method.Alg())
+			}
+			return k.private.Public(), nil
+		}
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+}
+
+// JWKS has the public keys that are not retired, including ones that are not
+// active yet
+func (kr *Keyring) JWKS(now time.Time) JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range kr.keys {
+		if k.retired(now) {
+			continue
+		}
+		set.Keys = append(set.Keys, k.jwk())
+	}
+	return set
+}
+
+func (k signingKey) jwk() JWK {
+	b64 := base64.RawURLEncoding.EncodeToString
+	j := JWK{Kid: k.ID, Use: "sig", Alg: k.method.Alg()}
+	switch pub := k.private.Public().(type) {
+	case *rsa.PublicKey:
+		j.Kty = "RSA"
+		j.N = b64(pub.N.Bytes())
+		j.E = b64(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		j.Kty = "EC"
+		j.Crv = pub.Curve.Params().Name
+		j.X = b64(pub.X.FillBytes(make([]byte, size)))
+		j.Y = b64(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		j.Kty = "OKP"
+		j.Crv = "Ed25519"
+		j.X = b64(pub)
+	}
+	return j
+}
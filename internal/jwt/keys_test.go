@@ -0,0 +1,198 @@
+package jwt_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pemKey(t *testing.T, key any) string {
+	b, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}))
+}
+
+func rsaKey(t *testing.T) *rsa.PrivateKey {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return k
+}
+
+func ecKey(t *testing.T) *ecdsa.PrivateKey {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return k
+}
+
+func edKey(t *testing.T) ed25519.PrivateKey {
+	_, k, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return k
+}
+
+func verify(kr *jwt.Keyring, token string, now time.Time) (*gojwt.Token, error) {
+	return gojwt.ParseWithClaims(token, &gojwt.RegisteredClaims{}, kr.Keyfunc(now),
+		gojwt.WithValidMethods(kr.ValidMethods()), gojwt.WithTimeFunc(func() time.Time { return now }))
+}
+
+func TestKeyringAlgorithms(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		alg string
+		key any
+		kty string
+	}{
+		{alg: "RS256", key: rsaKey(t), kty: "RSA"},
+		{alg: "ES256", key: ecKey(t), kty: "EC"},
+		{alg: "EdDSA", key: edKey(t), kty: "OKP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			kr, err := jwt.NewKeyring([]jwt.KeyConfig{{ID: "k1", Algorithm: tt.alg, PrivateKey: pemKey(t, tt.key)}}, "")
+			require.NoError(t, err)
+
+			token, err := kr.Sign(gojwt.RegisteredClaims{Subject: "me"}, now)
+			require.NoError(t, err)
+			parsed, err := verify(kr, token, now)
+			require.NoError(t, err)
+			assert.Equal(t, "k1", parsed.Header["kid"])
+			assert.Equal(t, tt.alg, parsed.Method.Alg())
+
+			jwks := kr.JWKS(now)
+			require.Len(t, jwks.Keys, 1)
+			assert.Equal(t, tt.kty, jwks.Keys[0].Kty)
+			assert.Equal(t, tt.alg, jwks.Keys[0].Alg)
+			assert.Equal(t, "sig", jwks.Keys[0].Use)
+		})
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	oldRetire := start.Add(45 * 24 * time.Hour)
+	kr, err := jwt.NewKeyring([]jwt.KeyConfig{
+		// Out of order on purpose
+		{ID: "new", Algorithm: "ES256", PrivateKey: pemKey(t, ecKey(t)), ActiveFrom: start.Add(30 * 24 * time.Hour)},
+		{ID: "old", Algorithm: "ES256", PrivateKey: pemKey(t, ecKey(t)), ActiveFrom: start, RetireAt: &oldRetire},
+	}, "")
+	require.NoError(t, err)
+
+	kids := func(now time.Time) []string {
+		var ids []string
+		for _, k := range kr.JWKS(now).Keys {
+			ids = append(ids, k.Kid)
+		}
+		return ids
+	}
+	sign := func(now time.Time) string {
+		token, err := kr.Sign(gojwt.RegisteredClaims{}, now)
+		require.NoError(t, err)
+		return token
+	}
+	kid := func(token string) any {
+		parsed, _, err := gojwt.NewParser().ParseUnverified(token, &gojwt.RegisteredClaims{})
+		require.NoError(t, err)
+		return parsed.Header["kid"]
+	}
+
+	// Before rotation the new key is published but not used
+	now := start.Add(24 * time.Hour)
+	oldToken := sign(now)
+	assert.Equal(t, "old", kid(oldToken))
+	assert.Equal(t, []string{"old", "new"}, kids(now))
+
+	// After rotation new tokens use the new key and old ones still verify
+	now = start.Add(31 * 24 * time.Hour)
+	assert.Equal(t, "new", kid(sign(now)))
+	_, err = verify(kr, oldToken, now)
+	assert.NoError(t, err)
+
+	// Once retired the old key is gone
+	now = oldRetire
+	_, err = verify(kr, oldToken, now)
+	assert.ErrorContains(t, err, "retired")
+	assert.Equal(t, []string{"new"}, kids(now))
+}
+
+func TestKeyringHMAC(t *testing.T) {
+	now := time.Now()
+	key := ecKey(t)
+
+	hmacOnly, err := jwt.NewKeyring(nil, "secret")
+	require.NoError(t, err)
+	hmacToken, err := hmacOnly.Sign(gojwt.RegisteredClaims{}, now)
+	require.NoError(t, err)
+	_, err = verify(hmacOnly, hmacToken, now)
+	require.NoError(t, err)
+	assert.Empty(t, hmacOnly.JWKS(now).Keys)
+
+	// Moving to keys still accepts tokens signed with the secret
+	both, err := jwt.NewKeyring([]jwt.KeyConfig{{ID: "k1", Algorithm: "ES256", PrivateKey: pemKey(t, key)}}, "secret")
+	require.NoError(t, err)
+	_, err = verify(both, hmacToken, now)
+	assert.NoError(t, err)
+
+	// Once the secret is removed they are rejected
+	keysOnly, err := jwt.NewKeyring([]jwt.KeyConfig{{ID: "k1", Algorithm: "ES256", PrivateKey: pemKey(t, key)}}, "")
+	require.NoError(t, err)
+	_, err = verify(keysOnly, hmacToken, now)
+	assert.Error(t, err)
+
+	// A public key can not be used as an hmac secret
+	pub, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+	forged := gojwt.NewWithClaims(gojwt.SigningMethodHS256, gojwt.RegisteredClaims{})
+	forged.Header["kid"] = "k1"
+	forgedToken, err := forged.SignedString(pub)
+	require.NoError(t, err)
+	_, err = verify(both, forgedToken, now)
+	assert.Error(t, err)
+}
+
+func TestNewKeyringErrors(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		keys          []jwt.KeyConfig
+		errorContains string
+	}{
+		{name: "nothing", errorContains: "either JWT_KEYS or JWT_SECRET"},
+		{name: "missing kid", keys: []jwt.KeyConfig{{Algorithm: "ES256", PrivateKey: pemKey(t, ecKey(t))}}, errorContains: "missing kid"},
+		{name: "duplicate kid", keys: []jwt.KeyConfig{
+			{ID: "a", Algorithm: "ES256", PrivateKey: pemKey(t, ecKey(t))},
+			{ID: "a", Algorithm: "ES256", PrivateKey: pemKey(t, ecKey(t))},
+		}, errorContains: "duplicate kid"},
+		{name: "not pem", keys: []jwt.KeyConfig{{ID: "a", Algorithm: "ES256", PrivateKey: "nope"}}, errorContains: "not PEM"},
+		{name: "wrong type", keys: []jwt.KeyConfig{{ID: "a", Algorithm: "RS256", PrivateKey: pemKey(t, ecKey(t))}}, errorContains: "needs an RSA key"},
+		{name: "small rsa", keys: []jwt.KeyConfig{{ID: "a", Algorithm: "RS256", PrivateKey: pemKey(t, small)}}, errorContains: "at least 2048 bits"},
+		{name: "unknown alg", keys: []jwt.KeyConfig{{ID: "a", Algorithm: "HS512", PrivateKey: pemKey(t, ecKey(t))}}, errorContains: "unsupported alg"},
+		{name: "retire before active", keys: []jwt.KeyConfig{{ID: "a", Algorithm: "ES256", PrivateKey: pemKey(t, ecKey(t)), ActiveFrom: time.Now(), RetireAt: &past}}, errorContains: "retire_at must be after"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwt.NewKeyring(tt.keys, "")
+			assert.ErrorContains(t, err, tt.errorContains)
+		})
+	}
+}
+
+func TestKeyringNoActiveKey(t *testing.T) {
+	kr, err := jwt.NewKeyring([]jwt.KeyConfig{{ID: "a", Algorithm: "ES256", PrivateKey: pemKey(t, ecKey(t)), ActiveFrom: time.Now().Add(time.Hour)}}, "")
+	require.NoError(t, err)
+	_, err = kr.Sign(gojwt.RegisteredClaims{}, time.Now())
+	assert.ErrorContains(t, err, "no active jwt signing key")
+}
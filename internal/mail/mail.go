@@ -0,0 +1,147 @@
+// Package mail sends account emails like password resets. The sender is
+// picked by config so dev can write to the log or files instead of smtp.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+)
+
+const (
+	SinkLog  = "log"
+	SinkFile = "file"
+	SinkSMTP = "smtp"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers a message
+type Sender interface {
+	Send(ctx context.Context, m Message) error
+}
+
+type Config struct {
+	Sink string
+	From string
+	Dir  string // used by the file sink
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUser     string
+	SMTPPassword string
+}
+
+// New creates the sender for the configured sink
+func New(ctx context.Context, c Config) (Sender, error) {
+	ctx = ctxerr.SetField(ctx, "sink", c.Sink)
+	switch c.Sink {
+	case SinkLog, "":
+		return LogSender{From: c.From}, nil
+	case SinkFile:
+		if c.Dir == "" {
+			return nil, ctxerr.New(ctx, "419abdb7-4486-45ee-afbd-2ca018556884", "mail dir required for file sink")
+		}
+		return &FileSender{From: c.From, Dir: c.Dir}, nil
+	case SinkSMTP:
+		if c.SMTPHost == "" || c.From == "" {
+			return nil, ctxerr.New(ctx, "144aa7fa-a92f-419f-b87d-b2e0946a5cb6", "smtp host and from address required for smtp sink")
+		}
+		return SMTPSender{
+			From:     c.From,
+			Addr:     net.JoinHostPort(c.SMTPHost, strconv.Itoa(c.SMTPPort)),
+			Host:     c.SMTPHost,
+			User:     c.SMTPUser,
+			Password: c.SMTPPassword,
+		}, nil
+	}
+	return nil, ctxerr.New(ctx, "c9a4b585-b269-45ef-8fc7-45b16d60bd48", "unknown mail sink")
+}
+
+// format builds an RFC 5322 message
+func format(from string, m Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", header(from))
+	fmt.Fprintf(&b, "To: %s\r\n", header(m.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", header(m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// header removes line breaks so values cannot add their own headers
+func header(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// LogSender prints messages, only meant for local development
+type LogSender struct {
+	From string
+}
+
+func (s LogSender) Send(ctx context.Context, m Message) error {
+	log.Printf("mail to %s: %s\n%s\n", m.To, m.Subject, m.Body)
+	return nil
+}
+
+// FileSender writes each message to its own .eml file in Dir
+type FileSender struct {
+	From string
+	Dir  string
+
+	once sync.Once
+	err  error
+}
+
+func (s *FileSender) Send(ctx context.Context, m Message) error {
+	s.once.Do(func() { s.err = os.MkdirAll(s.Dir, 0o755) })
+	if s.err != nil {
+		return ctxerr.Wrap(ctx, s.err, "adff540a-2fdb-4026-812e-7dc84642a9b8", "could not create mail dir")
+	}
+
+	name := filepath.Join(s.Dir, uuid.Must(uuid.NewV7()).String()+".eml")
+	if err := os.WriteFile(name, format(s.From, m), 0o600); err != nil {
+		ctx = ctxerr.SetField(ctx, "file", name)
+		return ctxerr.Wrap(ctx, err, "99180195-e691-495b-a223-c65ee0005923", "could not write mail file")
+	}
+	return nil
+}
+
+// SMTPSender sends with plain auth over STARTTLS when the server supports it
+type SMTPSender struct {
+	From     string
+	Addr     string
+	Host     string
+	User     string
+	Password string
+}
+
+func (s SMTPSender) Send(ctx context.Context, m Message) error {
+	var auth smtp.Auth
+	if s.User != "" {
+		auth = smtp.PlainAuth("", s.User, s.Password, s.Host)
+	}
+	if err := smtp.SendMail(s.Addr, auth, s.From, []string{m.To}, format(s.From, m)); err != nil {
+		ctx = ctxerr.SetField(ctx, "addr", s.Addr)
+		return ctxerr.Wrap(ctx, err, "8c2910ce-874a-4871-a3a3-760cf06ea529", "could not send mail")
+	}
+	return nil
+}
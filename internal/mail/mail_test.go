@@ -0,0 +1,61 @@
+package mail_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mvndaai/known-anywhere/internal/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name          string
+		config        mail.Config
+		errorContains string
+	}{
+		{name: "default", config: mail.Config{}},
+		{name: "log", config: mail.Config{Sink: mail.SinkLog}},
+		{name: "file", config: mail.Config{Sink: mail.SinkFile, Dir: t.TempDir()}},
+		{name: "file no dir", config: mail.Config{Sink: mail.SinkFile}, errorContains: "mail dir required"},
+		{name: "smtp", config: mail.Config{Sink: mail.SinkSMTP, SMTPHost: "localhost", SMTPPort: 25, From: "a@b.c"}},
+		{name: "smtp no host", config: mail.Config{Sink: mail.SinkSMTP, From: "a@b.c"}, errorContains: "smtp host"},
+		{name: "unknown", config: mail.Config{Sink: "pigeon"}, errorContains: "unknown mail sink"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := mail.New(ctx, tt.config)
+			if tt.errorContains != "" {
+				assert.ErrorContains(t, err, tt.errorContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, s)
+		})
+	}
+}
+
+func TestFileSender(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "mail")
+	s, err := mail.New(ctx, mail.Config{Sink: mail.SinkFile, Dir: dir, From: "noreply@example.com"})
+	require.NoError(t, err)
+
+	err = s.Send(ctx, mail.Message{To: "user@example.com", Subject: "Hi\r\nBcc: someone@example.com", Body: "line 1\nline 2"})
+	require.NoError(t, err)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	b, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "From: noreply@example.com\r\n")
+	assert.Contains(t, string(b), "To: user@example.com\r\n")
+	assert.Contains(t, string(b), "Subject: HiBcc: someone@example.com\r\n", "line breaks removed from headers")
+	assert.Contains(t, string(b), "\r\n\r\nline 1\r\nline 2")
+}
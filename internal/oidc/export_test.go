@@ -0,0 +1,11 @@
+package oidc
+
+import "time"
+
+// SetJWKSMinRefresh changes how often keys can be refetched and returns a
+// function to put it back
+func SetJWKSMinRefresh(d time.Duration) func() {
+	old := jwksMinRefresh
+	jwksMinRefresh = d
+	return func() { jwksMinRefresh = old }
+}
@@ -0,0 +1,167 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mvndaai/ctxerr"
+)
+
+// jwksMinRefresh stops tokens with made up key ids from making us fetch the
+// provider keys on every request
+var jwksMinRefresh = time.Minute
+
+type (
+	jwk struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		Alg string `json:"alg"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+
+	jwkSet struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	// keySet caches the provider signing keys by key id
+	keySet struct {
+		uri    string
+		client *http.Client
+
+		mu      sync.Mutex
+		keys    map[string]crypto.PublicKey
+		fetched time.Time
+	}
+)
+
+// key gets the public key for the kid, refetching once when the provider
+// rotated to a key that is not cached yet
+func (ks *keySet) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if k, ok := ks.keys[kid]; ok {
+		return k, nil
+	}
+	if time.Since(ks.fetched) < jwksMinRefresh {
+		ctx = ctxerr.SetField(ctx, "kid", kid)
+		return nil, ctxerr.New(ctx, "8bace126-f9af-4a0f-b6e0-ba757f9b6054", "unknown signing key")
+	}
+
+	keys, err := ks.fetch(ctx)
+	if err != nil {
+		return nil, ctxerr.QuickWrap(ctx, err)
+	}
+	ks.keys = keys
+	ks.fetched = time.Now()
+
+	if k, ok := ks.keys[kid]; ok {
+		return k, nil
+	}
+	ctx = ctxerr.SetField(ctx, "kid", kid)
+	return nil, ctxerr.New(ctx, "ca02e38d-9937-4b48-a724-1f574453baf6", "unknown signing key")
+}
+
+func (ks *keySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var set jwkSet
+	if err := getJSON(ctx, ks.client, ks.uri, &set); err != nil {
+		return nil, ctxerr.QuickWrap(ctx, err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			// Skip keys we do not support instead of failing all of them
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("point not on curve")
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func getJSON(ctx context.Context, client *http.Client, uri string, v any) error {
+	ctx = ctxerr.SetField(ctx, "uri", uri)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "194d2c79-24d7-4312-b5d4-4ca0dfd15828", "could not create request")
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "9c8b3e94-bcb9-4456-829e-9d98a32113fe", "could not reach provider")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		ctx = ctxerr.SetField(ctx, "status", resp.StatusCode)
+		return ctxerr.New(ctx, "8d805c1f-6e8f-4eb8-9d3d-29d1c59abf3c", "unexpected provider status")
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return ctxerr.Wrap(ctx, err, "d3869ae6-934f-4254-b092-0bdeb792da0a", "could not decode provider response")
+	}
+	return nil
+}
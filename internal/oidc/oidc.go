@@ -0,0 +1,244 @@
+// Package oidc logs users in with external OpenID Connect providers using the
+// authorization code flow with PKCE
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mvndaai/ctxerr"
+)
+
+const discoveryPath = "/.well-known/openid-configuration"
+
+// ProviderConfig is one provider from the OIDC_PROVIDERS config
+type ProviderConfig struct {
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+	RedirectURL  string   `json:"redirect_url"`
+}
+
+// Claims are the ID token claims used to find or create a user
+type Claims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+}
+
+// Provider is a discovered OIDC provider. Discovery happens on first use so a
+// provider being down does not stop the server from starting.
+type Provider struct {
+	config ProviderConfig
+	client *http.Client
+
+	mu   sync.Mutex
+	meta *metadata
+	keys *keySet
+}
+
+func NewProvider(ctx context.Context, c ProviderConfig, client *http.Client) (*Provider, error) {
+	ctx = ctxerr.SetField(ctx, "provider", c.Name)
+	if c.Name == "" || c.Issuer == "" || c.ClientID == "" || c.RedirectURL == "" {
+		return nil, ctxerr.New(ctx, "94600968-65c4-4d10-9ed7-423649ac45ce", "provider needs name, issuer, client_id and redirect_url")
+	}
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{"openid", "email", "profile"}
+	}
+	if !slices.Contains(c.Scopes, "openid") {
+		c.Scopes = append([]string{"openid"}, c.Scopes...)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{config: c, client: client}, nil
+}
+
+func (p *Provider) Name() string { return p.config.Name }
+
+func (p *Provider) discover(ctx context.Context) (*metadata, *keySet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, p.keys, nil
+	}
+
+	ctx = ctxerr.SetField(ctx, "provider", p.config.Name)
+	var m metadata
+	if err := getJSON(ctx, p.client, strings.TrimSuffix(p.config.Issuer, "/")+discoveryPath, &m); err != nil {
+		return nil, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	if m.Issuer != p.config.Issuer {
+		ctx = ctxerr.SetField(ctx, "issuer", m.Issuer)
+		return nil, nil, ctxerr.New(ctx, "37f7b307-97b0-410d-962c-5f9ad30c5edf", "discovered issuer does not match config")
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, nil, ctxerr.New(ctx, "0ae97965-bf86-410b-8a07-a60c29cbc2fd", "provider discovery missing endpoints")
+	}
+
+	p.meta = &m
+	p.keys = &keySet{uri: m.JWKSURI, client: p.client}
+	return p.meta, p.keys, nil
+}
+
+// randomString is used for state, nonce and the PKCE verifier
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge is the S256 PKCE code challenge of the verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthRequest has the values that must be kept until the callback
+type AuthRequest struct {
+	URL          string
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+// AuthCodeURL starts a login, the state, nonce and verifier must be stored and
+// given back to Exchange
+func (p *Provider) AuthCodeURL(ctx context.Context) (AuthRequest, error) {
+	m, _, err := p.discover(ctx)
+	if err != nil {
+		return AuthRequest{}, ctxerr.QuickWrap(ctx, err)
+	}
+
+	ar := AuthRequest{}
+	for _, s := range []*string{&ar.State, &ar.Nonce, &ar.CodeVerifier} {
+		if *s, err = randomString(); err != nil {
+			return AuthRequest{}, ctxerr.Wrap(ctx, err, "ee64a496-0aee-4e0b-b9cf-1c444d8c930f", "could not create random value")
+		}
+	}
+
+	u, err := url.Parse(m.AuthorizationEndpoint)
+	if err != nil {
+		return AuthRequest{}, ctxerr.Wrap(ctx, err, "ededb012-7e5e-45c3-ab1f-8ce239a3db68", "invalid authorization endpoint")
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.config.ClientID)
+	q.Set("redirect_uri", p.config.RedirectURL)
+	q.Set("scope", strings.Join(p.config.Scopes, " "))
+	q.Set("state", ar.State)
+	q.Set("nonce", ar.Nonce)
+	q.Set("code_challenge", Challenge(ar.CodeVerifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	ar.URL = u.String()
+	return ar, nil
+}
+
+// Exchange trades the callback code for tokens and verifies the ID token
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (Claims, error) {
+	ctx = ctxerr.SetField(ctx, "provider", p.config.Name)
+	m, _, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, ctxerr.QuickWrap(ctx, err)
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, ctxerr.Wrap(ctx, err, "e56d65b4-b8f0-49d4-86a0-b223adf9a0ba", "could not create token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Claims{}, ctxerr.Wrap(ctx, err, "433695f6-06f2-48b2-b66e-72b1d5f8caf5", "could not reach token endpoint")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		ctx = ctxerr.SetField(ctx, "status", resp.StatusCode)
+		return Claims{}, ctxerr.NewHTTP(ctx, "622b5ed8-2edc-49d9-a669-94b9bc63daaa", "provider rejected the login", http.StatusUnauthorized, "token exchange failed")
+	}
+
+	var tr tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return Claims{}, ctxerr.Wrap(ctx, err, "8eda6e2b-ac42-4804-b9b7-e5671d06f082", "could not decode token response")
+	}
+	if tr.IDToken == "" {
+		return Claims{}, ctxerr.NewHTTP(ctx, "b3965c89-e32b-46af-a903-809f2d588d72", "provider did not return an id token", http.StatusUnauthorized, "missing id_token")
+	}
+
+	claims, err := p.VerifyIDToken(ctx, tr.IDToken, nonce)
+	return claims, ctxerr.QuickWrap(ctx, err)
+}
+
+// VerifyIDToken checks the signature against the provider keys and the
+// issuer, audience, expiration and nonce
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (Claims, error) {
+	_, keys, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, ctxerr.QuickWrap(ctx, err)
+	}
+
+	claims := Claims{}
+	_, err = jwt.ParseWithClaims(raw, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return keys.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return Claims{}, ctxerr.WrapHTTP(ctx, err, "326b0724-c66a-4427-aa28-14c7ae9dd577", "invalid id token", http.StatusUnauthorized, err.Error())
+	}
+	if claims.Subject == "" {
+		return Claims{}, ctxerr.NewHTTP(ctx, "03a2c6de-48bc-4871-926f-2d51e8994ead", "invalid id token", http.StatusUnauthorized, "id token missing sub")
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return Claims{}, ctxerr.NewHTTP(ctx, "fbde38a6-c9c7-4fc2-9805-00908e90c876", "invalid id token", http.StatusUnauthorized, "id token nonce does not match")
+	}
+	return claims, nil
+}
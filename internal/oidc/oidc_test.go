@@ -0,0 +1,276 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mvndaai/known-anywhere/internal/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	clientID     = "client"
+	clientSecret = "secret"
+	redirectURL  = "http://localhost/callback"
+)
+
+// fakeProvider is a minimal OIDC provider for tests
+type fakeProvider struct {
+	*httptest.Server
+	t *testing.T
+
+	mu     sync.Mutex
+	kid    string
+	key    *rsa.PrivateKey
+	codes  map[string]pendingCode
+	claims jwt.MapClaims // extra claims for the next id token
+	jwks   int           // times the keys were fetched
+}
+
+type pendingCode struct {
+	challenge string
+	nonce     string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	f := &fakeProvider{t: t, codes: map[string]pendingCode{}}
+	f.rotate("key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.URL,
+			"authorization_endpoint": f.URL + "/authorize",
+			"token_endpoint":         f.URL + "/token",
+			"jwks_uri":               f.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.jwks++
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": f.kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(f.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(f.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", f.token)
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeProvider) rotate(kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(f.t, err)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.kid, f.key = kid, key
+}
+
+// authorize is what the browser redirect would do, it returns the code
+func (f *fakeProvider) authorize(authURL string) string {
+	u, err := url.Parse(authURL)
+	require.NoError(f.t, err)
+	q := u.Query()
+	require.Equal(f.t, "S256", q.Get("code_challenge_method"))
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	code := "code-" + q.Get("state")
+	f.codes[code] = pendingCode{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	return code
+}
+
+func (f *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != clientID || secret != clientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pc, ok := f.codes[r.FormValue("code")]
+	delete(f.codes, r.FormValue("code"))
+	if !ok || oidc.Challenge(r.FormValue("code_verifier")) != pc.challenge || r.FormValue("redirect_uri") != redirectURL {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   f.URL,
+		"sub":   "user-123",
+		"aud":   clientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": pc.nonce,
+		"email": "user@example.com",
+		"name":  "Test User",
+	}
+	for k, v := range f.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = f.kid
+	idToken, err := token.SignedString(f.key)
+	require.NoError(f.t, err)
+	_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+}
+
+func newProvider(t *testing.T, f *fakeProvider) *oidc.Provider {
+	p, err := oidc.NewProvider(context.Background(), oidc.ProviderConfig{
+		Name:         "fake",
+		Issuer:       f.URL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+	}, f.Client())
+	require.NoError(t, err)
+	return p
+}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeProvider(t)
+	p := newProvider(t, f)
+
+	ar, err := p.AuthCodeURL(ctx)
+	require.NoError(t, err)
+	u, err := url.Parse(ar.URL)
+	require.NoError(t, err)
+	assert.Equal(t, f.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	q := u.Query()
+	assert.Equal(t, "code", q.Get("response_type"))
+	assert.Equal(t, clientID, q.Get("client_id"))
+	assert.Equal(t, "openid email profile", q.Get("scope"))
+	assert.Equal(t, ar.State, q.Get("state"))
+	assert.Equal(t, ar.Nonce, q.Get("nonce"))
+	assert.Equal(t, oidc.Challenge(ar.CodeVerifier), q.Get("code_challenge"))
+
+	code := f.authorize(ar.URL)
+	claims, err := p.Exchange(ctx, code, ar.CodeVerifier, ar.Nonce)
+	require.NoError(t, err)
+	assert.Equal(t, "user-123", claims.Subject)
+	assert.Equal(t, "user@example.com", claims.Email)
+	assert.Equal(t, "Test User", claims.Name)
+
+	_, err = p.Exchange(ctx, code, ar.CodeVerifier, ar.Nonce)
+	assert.ErrorContains(t, err, "token exchange failed", "codes only work once")
+}
+
+func TestExchangeErrors(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name          string
+		claims        jwt.MapClaims
+		verifier      func(ar oidc.AuthRequest) string
+		nonce         func(ar oidc.AuthRequest) string
+		errorContains string
+	}{
+		{
+			name:          "wrong verifier",
+			verifier:      func(ar oidc.AuthRequest) string { return "wrong" },
+			errorContains: "token exchange failed",
+		},
+		{
+			name:          "wrong nonce",
+			nonce:         func(ar oidc.AuthRequest) string { return "wrong" },
+			errorContains: "nonce does not match",
+		},
+		{
+			name:          "wrong audience",
+			claims:        jwt.MapClaims{"aud": "someone-else"},
+			errorContains: "aud",
+		},
+		{
+			name:          "wrong issuer",
+			claims:        jwt.MapClaims{"iss": "https://evil.example.com"},
+			errorContains: "iss",
+		},
+		{
+			name:          "expired",
+			claims:        jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()},
+			errorContains: "expired",
+		},
+		{
+			name:          "missing subject",
+			claims:        jwt.MapClaims{"sub": ""},
+			errorContains: "missing sub",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeProvider(t)
+			f.claims = tt.claims
+			p := newProvider(t, f)
+
+			ar, err := p.AuthCodeURL(ctx)
+			require.NoError(t, err)
+			code := f.authorize(ar.URL)
+			verifier, nonce := ar.CodeVerifier, ar.Nonce
+			if tt.verifier != nil {
+				verifier = tt.verifier(ar)
+			}
+			if tt.nonce != nil {
+				nonce = tt.nonce(ar)
+			}
+			_, err = p.Exchange(ctx, code, verifier, nonce)
+			assert.ErrorContains(t, err, tt.errorContains)
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeProvider(t)
+	p := newProvider(t, f)
+
+	login := func() error {
+		ar, err := p.AuthCodeURL(ctx)
+		require.NoError(t, err)
+		_, err = p.Exchange(ctx, f.authorize(ar.URL), ar.CodeVerifier, ar.Nonce)
+		return err
+	}
+
+	require.NoError(t, login())
+	require.NoError(t, login())
+	assert.Equal(t, 1, f.jwks, "keys are cached")
+
+	// Unknown keys are not refetched more than once a minute
+	f.rotate("key-2")
+	assert.ErrorContains(t, login(), "unknown signing key")
+	assert.Equal(t, 1, f.jwks)
+
+	t.Cleanup(oidc.SetJWKSMinRefresh(0))
+	require.NoError(t, login(), "rotated keys are refetched")
+	assert.Equal(t, 2, f.jwks)
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	f := newFakeProvider(t)
+	p, err := oidc.NewProvider(context.Background(), oidc.ProviderConfig{
+		Name:        "fake",
+		Issuer:      f.URL + "/other",
+		ClientID:    clientID,
+		RedirectURL: redirectURL,
+	}, f.Client())
+	require.NoError(t, err)
+
+	_, err = p.AuthCodeURL(context.Background())
+	assert.Error(t, err)
+}
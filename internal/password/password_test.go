@@ -0,0 +1,67 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashAndVerify(t *testing.T) {
+	h, err := Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(h, "$argon2id$v=19$m=65536,t=3,p=2$"), h)
+
+	ok, err := Verify("correct horse battery staple", h)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = Verify("correct horse battery stapler", h)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	again, err := Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.NotEqual(t, h, again, "salt should be random")
+}
+
+func TestVerifyInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoded  string
+		expected error
+	}{
+		{name: "empty", encoded: "", expected: ErrInvalidHash},
+		{name: "bcrypt", encoded: "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", expected: ErrInvalidHash},
+		{name: "version", encoded: "$argon2id$v=16$m=65536,t=3,p=2$c2FsdA$a2V5", expected: ErrIncompatibleVersion},
+		{name: "params", encoded: "$argon2id$v=19$m=x,t=3,p=2$c2FsdA$a2V5", expected: ErrInvalidHash},
+		{name: "salt", encoded: "$argon2id$v=19$m=65536,t=3,p=2$!!$a2V5", expected: ErrInvalidHash},
+		{name: "key", encoded: "$argon2id$v=19$m=65536,t=3,p=2$c2FsdA$", expected: ErrInvalidHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := Verify("password", tt.encoded)
+			assert.ErrorIs(t, err, tt.expected)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	h, err := Hash("password")
+	require.NoError(t, err)
+	assert.False(t, NeedsRehash(h))
+
+	weak := DefaultParams
+	weak.Memory = 8 * 1024
+	h, err = hash("password", weak)
+	require.NoError(t, err)
+	assert.True(t, NeedsRehash(h))
+
+	ok, err := Verify("password", h)
+	require.NoError(t, err)
+	assert.True(t, ok, "old params still verify")
+
+	assert.True(t, NeedsRehash("not a hash"))
+}
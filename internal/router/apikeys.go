@@ -0,0 +1,25 @@
+package router
+
+import (
+	"context"
+
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+// apiKeyCreateHandler returns the key, it cannot be seen again
+func (h *Handler) apiKeyCreateHandler(ctx context.Context, body types.APIKeyCreate) (types.APIKeyCreated, any, error) {
+	k, err := h.db.CreateAPIKey(ctx, body)
+	if err != nil {
+		return types.APIKeyCreated{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return k, nil, nil
+}
+
+func (h *Handler) apiKeyListHandler(ctx context.Context, pagination types.Pagination) ([]types.APIKey, any, error) {
+	keys, pg, err := h.db.ListAPIKeys(ctx, pagination)
+	if err != nil {
+		return nil, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return keys, pg, nil
+}
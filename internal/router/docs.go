@@ -0,0 +1,82 @@
+package router
+
+import (
+	"github.com/getkin/kin-openapi/openapi3"
+	ctxerrhttp "github.com/mvndaai/ctxerr/http"
+	"github.com/mvndaai/known-anywhere/internal/router/server"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+// envelope is Return with the types of its data and meta, only used for docs
+type envelope[D, M any] struct {
+	Success bool                `json:"success"`
+	Data    D                   `json:"data,omitempty"`
+	Error   *ctxerrhttp.Details `json:"error,omitempty"`
+	Meta    M                   `json:"meta,omitempty"`
+}
+
+// Tags group the endpoints in the docs
+var (
+	tagAuth        = []string{"auth"}
+	tagDomains     = []string{"domains"}
+	tagDomainLinks = []string{"domain links"}
+	tagUsers       = []string{"users"}
+	tagGroups      = []string{"groups"}
+	tagSocials     = []string{"socials"}
+	tagAccount     = []string{"account"}
+	tagModeration  = []string{"moderation"}
+	tagAdmin       = []string{"admin"}
+)
+
+// noBody is for endpoints without a body or data
+type noBody = server.NoBody
+
+// requestDoc documents an endpoint that reads Req from a JSON body or query
+// parameters, depending on the method, and returns Data
+func requestDoc[Req, Data any](method string, d server.Doc) server.DocFunc {
+	return withErrorDoc(server.RequestDoc[Req, envelope[Data, server.NoBody]](method, d))
+}
+
+// listDoc documents a list endpoint that reads its filters and pagination
+// from query parameters, Req is usually a types list like types.DomainList
+func listDoc[Req, Item any](d server.Doc) server.DocFunc {
+	return withErrorDoc(withListFormats[Item](server.QueryDoc[Req, envelope[[]Item, types.PaginationResponse]](d)))
+}
+
+// withListFormats adds the NDJSON and CSV a list can also be written as
+func withListFormats[Item any](df server.DocFunc) server.DocFunc {
+	return func() (*openapi3.Operation, error) {
+		op, err := df()
+		if err != nil {
+			return nil, err
+		}
+		item, err := server.Schema[Item]()
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range op.Responses.Map() {
+			if r.Value == nil || r.Value.Content.Get(mediaJSON) == nil {
+				continue
+			}
+			r.Value.Content[mediaNDJSON] = openapi3.NewMediaType().WithSchemaRef(item)
+			r.Value.Content[mediaCSV] = openapi3.NewMediaType().WithSchema(openapi3.NewStringSchema())
+		}
+		return op, nil
+	}
+}
+
+// withErrorDoc adds the error envelope every endpoint can return
+func withErrorDoc(df server.DocFunc) server.DocFunc {
+	return func() (*openapi3.Operation, error) {
+		op, err := df()
+		if err != nil {
+			return nil, err
+		}
+		s, err := server.Schema[envelope[server.NoBody, server.NoBody]]()
+		if err != nil {
+			return nil, err
+		}
+		op.AddResponse(0, openapi3.NewResponse().WithDescription("Error").WithJSONSchemaRef(s))
+		return op, nil
+	}
+}
@@ -0,0 +1,73 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+func (h *Handler) domainLinkCreateHandler(ctx context.Context, body types.DomainLinkCreate) (uuid.UUID, any, error) {
+	l, err := h.db.CreateDomainLink(ctx, body)
+	if err != nil {
+		return uuid.Nil, nil, ctxerr.QuickWrap(ctx, err)
+	}
+
+	setLocation(ctx, "/api/domain_link", l)
+	return l, nil, nil
+}
+
+func (h *Handler) domainLinkGetHandler(ctx context.Context, req idPath) (types.DomainLink, any, error) {
+	l, err := h.db.GetDomainLink(ctx, req.ID.String())
+	if err != nil {
+		return types.DomainLink{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return l, nil, nil
+}
+
+func (h *Handler) domainLinkListHandler(ctx context.Context, list types.DomainLinkList) ([]types.DomainLink, any, error) {
+	links, pagination, err := h.db.ListDomainLinks(ctx, list.Filters, list.Pagination)
+	if err != nil {
+		return nil, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return links, pagination, nil
+}
+
+// domainLinkResolve is the domain and the country asked for, without a
+// country it comes from the Accept-Language header
+type domainLinkResolve struct {
+	ID      uuid.UUID `path:"id" json:"-"`
+	Country string    `json:"country,omitempty"`
+}
+
+func (v *domainLinkResolve) Fill(ctx context.Context, q url.Values) error {
+	c, err := types.RequestCountry(ctx, q, "")
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	v.Country = c
+	return nil
+}
+
+// domainLinkResolveHandler returns the link of a domain that best matches the
+// caller's country from the country param or Accept-Language header
+func (h *Handler) domainLinkResolveHandler(r *http.Request, req domainLinkResolve) (types.DomainLink, any, error) {
+	ctx := r.Context()
+	country := req.Country
+	if country == "" {
+		var err error
+		country, err = types.RequestCountry(ctx, nil, r.Header.Get("Accept-Language"))
+		if err != nil {
+			return types.DomainLink{}, nil, ctxerr.QuickWrap(ctx, err)
+		}
+	}
+
+	l, err := h.db.ResolveDomainLink(ctx, req.ID, country)
+	if err != nil {
+		return types.DomainLink{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return l, nil, nil
+}
@@ -0,0 +1,35 @@
+package router
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+func (h *Handler) groupCreateHandler(ctx context.Context, body types.GroupCreate) (uuid.UUID, any, error) {
+	g, err := h.db.CreateGroup(ctx, body)
+	if err != nil {
+		return uuid.Nil, nil, ctxerr.QuickWrap(ctx, err)
+	}
+
+	setLocation(ctx, "/api/group", g)
+	return g, nil, nil
+}
+
+func (h *Handler) groupGetHandler(ctx context.Context, req idPath) (types.Group, any, error) {
+	g, err := h.db.GetGroup(ctx, req.ID.String())
+	if err != nil {
+		return types.Group{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return g, nil, nil
+}
+
+func (h *Handler) groupListHandler(ctx context.Context, list types.GroupList) ([]types.Group, any, error) {
+	groups, pagination, err := h.db.ListGroups(ctx, list.Filters, list.Pagination)
+	if err != nil {
+		return nil, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return groups, pagination, nil
+}
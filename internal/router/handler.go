@@ -2,13 +2,23 @@ package router
 
 import (
 	"context"
+	"encoding/json"
+	"net/netip"
+	"net/url"
+	"strings"
 
 	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/config"
 	"github.com/mvndaai/known-anywhere/internal/db"
+	"github.com/mvndaai/known-anywhere/internal/mail"
+	"github.com/mvndaai/known-anywhere/internal/oidc"
 )
 
 type Handler struct {
-	db *db.DB
+	db             *db.DB
+	mail           mail.Sender
+	providers      map[string]*oidc.Provider
+	trustedProxies []netip.Prefix
 }
 
 func (h *Handler) Close() error {
@@ -20,5 +30,79 @@ func (h *Handler) Close() error {
 }
 
 func NewHandler(ctx context.Context, db *db.DB) (Handler, error) {
-	return Handler{db: db}, nil
+	c := config.Get().Mail
+	sender, err := mail.New(ctx, mail.Config{
+		Sink:         c.Sink,
+		From:         c.From,
+		Dir:          c.Dir,
+		SMTPHost:     c.SMTPHost,
+		SMTPPort:     c.SMTPPort,
+		SMTPUser:     c.SMTPUser,
+		SMTPPassword: c.SMTPPassword,
+	})
+	if err != nil {
+		return Handler{}, ctxerr.QuickWrap(ctx, err)
+	}
+
+	providers, err := newProviders(ctx, config.Get().OIDCProviders)
+	if err != nil {
+		return Handler{}, ctxerr.QuickWrap(ctx, err)
+	}
+
+	trustedProxies, err := parseTrustedProxies(ctx, config.Get().TrustedProxies)
+	if err != nil {
+		return Handler{}, ctxerr.QuickWrap(ctx, err)
+	}
+	return Handler{db: db, mail: sender, providers: providers, trustedProxies: trustedProxies}, nil
+}
+
+// parseTrustedProxies reads a comma separated list of addresses and CIDRs
+func parseTrustedProxies(ctx context.Context, raw string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, v := range strings.Split(raw, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				ctx = ctxerr.SetField(ctx, "proxy", v)
+				return nil, ctxerr.Wrap(ctx, err, "fcc9512d-a7b6-42fe-a33a-2ececdc0d1dd", "invalid TRUSTED_PROXIES")
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(v)
+		if err != nil {
+			ctx = ctxerr.SetField(ctx, "proxy", v)
+			return nil, ctxerr.Wrap(ctx, err, "e3605e34-b1bf-4ae5-9f76-4b5562732d38", "invalid TRUSTED_PROXIES")
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+// newProviders creates the oidc providers from their JSON config
+func newProviders(ctx context.Context, raw string) (map[string]*oidc.Provider, error) {
+	providers := map[string]*oidc.Provider{}
+	if raw == "" {
+		return providers, nil
+	}
+
+	var configs []oidc.ProviderConfig
+	if err := json.Unmarshal([]byte(raw), &configs); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "783aa3f0-60ad-42fc-99ce-9a0c41b866a1", "invalid OIDC_PROVIDERS")
+	}
+	for _, c := range configs {
+		if c.RedirectURL == "" {
+			c.RedirectURL = config.Get().PublicURL + "/api/oidc/" + url.PathEscape(c.Name) + "/callback"
+		}
+		p, err := oidc.NewProvider(ctx, c, nil)
+		if err != nil {
+			return nil, ctxerr.QuickWrap(ctx, err)
+		}
+		providers[c.Name] = p
+	}
+	return providers, nil
 }
@@ -0,0 +1,61 @@
+package router
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+// impersonationTTL is short so support gets a new token, and a new audit row,
+// for every problem they look into
+const impersonationTTL = 15 * time.Minute
+
+// impersonateHandler gives an admin a token that acts as the user. The token
+// has no refresh token and the admin is in its act claim.
+func (h *Handler) impersonateHandler(ctx context.Context, req idBody[types.ImpersonationRequest]) (types.Token, any, error) {
+	claims := jwt.JWTClaims{
+		Act: &jwt.Actor{Subject: jwt.ActorFromContext(ctx).String()},
+		// Support cannot change passwords, sessions or roles as the user
+		Scope: strings.Join(jwt.DelegatedScopes, " "),
+	}
+	claims.Subject = req.ID.String()
+	claims.Audience = []string{jwt.AudienceAPI}
+	claims.ExpiresAt = gojwt.NewNumericDate(time.Now().Add(impersonationTTL))
+	claims.Normalize(ctx)
+
+	u, err := h.db.CreateImpersonation(ctx, types.ImpersonationCreate{
+		UserID:     req.ID,
+		Reason:     req.Body.Reason,
+		JWTID:      uuid.MustParse(claims.ID),
+		Expiration: claims.ExpiresAt.Time,
+	})
+	if err != nil {
+		return types.Token{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	claims.Username = u.Username
+	claims.Role = u.Role
+
+	token, err := jwt.GenerateJWT(ctx, claims)
+	if err != nil {
+		return types.Token{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return types.Token{
+		AccessToken: token,
+		TokenType:   strings.TrimSpace(jwt.HeaderAuthorizationPrefix),
+		ExpiresAt:   claims.ExpiresAt.Time,
+	}, nil, nil
+}
+
+func (h *Handler) impersonationListHandler(ctx context.Context, list types.ImpersonationList) ([]types.Impersonation, any, error) {
+	impersonations, pagination, err := h.db.ListImpersonations(ctx, list.Filters, list.Pagination)
+	if err != nil {
+		return nil, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return impersonations, pagination, nil
+}
@@ -1,40 +1,188 @@
 package router
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/config"
 	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/mvndaai/known-anywhere/internal/mail"
+	"github.com/mvndaai/known-anywhere/internal/router/server"
 	"github.com/mvndaai/known-anywhere/internal/types"
 )
 
-func loginsHandler(r *http.Request) (data, meta any, status int, _ error) {
-	return nil, nil, http.StatusBadGateway, ctxerr.New(r.Context(), "82bd850e-23aa-4fe0-8b9b-801aab34de0a", "test error")
+// issueToken creates a JWT for the session with the default expiration
+func issueToken(ctx context.Context, u types.User, s types.Session, refreshToken string) (types.Token, error) {
+	claims := jwt.JWTClaims{Username: u.Username, SessionID: s.ID.String(), Role: u.Role}
+	claims.Subject = u.ID.String()
+	claims.Audience = []string{jwt.AudienceAPI}
+	claims.Normalize(ctx)
+
+	token, err := jwt.GenerateJWT(ctx, claims)
+	if err != nil {
+		return types.Token{}, ctxerr.QuickWrap(ctx, err)
+	}
+	return types.Token{
+		AccessToken:      token,
+		TokenType:        strings.TrimSpace(jwt.HeaderAuthorizationPrefix),
+		ExpiresAt:        claims.ExpiresAt.Time,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: s.Expiration,
+	}, nil
+}
+
+// startSession creates a session for the device of the request and its tokens
+func (h *Handler) startSession(r *http.Request, u types.User) (types.Token, error) {
+	ctx := r.Context()
+	s, refreshToken, err := h.db.CreateSession(ctx, types.SessionCreate{
+		UserID:    u.ID,
+		UserAgent: r.UserAgent(),
+		IPAddress: server.ClientIP(r, h.trustedProxies),
+	})
+	if err != nil {
+		return types.Token{}, ctxerr.QuickWrap(ctx, err)
+	}
+	token, err := issueToken(ctx, u, s, refreshToken)
+	return token, ctxerr.QuickWrap(ctx, err)
+}
+
+func (h *Handler) loginHandler(r *http.Request, body types.Login) (types.Token, any, error) {
+	ctx := r.Context()
+	u, err := h.db.Login(ctx, body)
+	if err != nil {
+		return types.Token{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+
+	token, err := h.startSession(r, u)
+	if err != nil {
+		return types.Token{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return token, nil, nil
+}
+
+func (h *Handler) registerHandler(r *http.Request, body types.Registration) (types.Token, any, error) {
+	ctx := r.Context()
+	id, err := h.db.Register(ctx, body)
+	if err != nil {
+		return types.Token{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+
+	token, err := h.startSession(r, types.User{ID: id, UserCreate: body.UserCreate})
+	if err != nil {
+		return types.Token{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return token, nil, nil
+}
+
+func (h *Handler) passwordChangeHandler(ctx context.Context, body types.PasswordChange) (noBody, any, error) {
+	if err := h.db.ChangePassword(ctx, body); err != nil {
+		return noBody{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return noBody{}, nil, nil
 }
 
-func (h *Handler) logoutHandler(r *http.Request) (data, meta any, status int, _ error) {
+// passwordResetRequestHandler emails a reset link. The link is made and sent
+// after responding so the response is the same, and takes as long, whether or
+// not the email has an account.
+func (h *Handler) passwordResetRequestHandler(ctx context.Context, body types.PasswordResetRequest) (noBody, any, error) {
+	go func(ctx context.Context) {
+		if err := h.sendPasswordReset(ctx, body.Email); err != nil {
+			ctxerr.Handle(ctxerr.QuickWrap(ctx, err))
+		}
+	}(context.WithoutCancel(ctx))
+	return noBody{}, nil, nil
+}
+
+// sendPasswordReset emails a reset link when the email has an account
+func (h *Handler) sendPasswordReset(ctx context.Context, email string) error {
+	token, err := h.db.CreatePasswordReset(ctx, email)
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	if token == "" {
+		return nil
+	}
+
+	link := config.Get().PublicURL + "/reset-password?token=" + url.QueryEscape(token)
+	err = h.mail.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Use this link to reset your password. It expires in an hour.\n\n%s\n\nIf you did not ask for this you can ignore this email.\n", link),
+	})
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+func (h *Handler) passwordResetHandler(ctx context.Context, body types.PasswordReset) (noBody, any, error) {
+	if err := h.db.ResetPassword(ctx, body); err != nil {
+		return noBody{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return noBody{}, nil, nil
+}
+
+func (h *Handler) refreshHandler(ctx context.Context, body types.RefreshRequest) (types.Token, any, error) {
+	u, s, refreshToken, err := h.db.RefreshSession(ctx, body.RefreshToken)
+	if err != nil {
+		return types.Token{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+
+	token, err := issueToken(ctx, u, s, refreshToken)
+	if err != nil {
+		return types.Token{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return token, nil, nil
+}
+
+func (h *Handler) sessionListHandler(ctx context.Context, pagination types.Pagination) ([]types.Session, any, error) {
+	sessions, pg, err := h.db.ListSessions(ctx, pagination)
+	if err != nil {
+		return nil, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return sessions, pg, nil
+}
+
+// sessionsDeleteHandler logs out everywhere
+func (h *Handler) sessionsDeleteHandler(ctx context.Context, _ noBody) (noBody, any, error) {
+	if err := h.db.RevokeAllSessions(ctx); err != nil {
+		return noBody{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return noBody{}, nil, nil
+}
+
+func (h *Handler) logoutHandler(r *http.Request, _ noBody) (noBody, any, error) {
 	ctx := r.Context()
 	claims, err := jwt.GetJWTClaims(r)
 	if err != nil {
-		return nil, nil, 0, ctxerr.QuickWrap(ctx, err)
+		return noBody{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+
+	// Tokens from a login are logged out by ending their session
+	if claims.SessionID != "" {
+		if err := h.db.RevokeSession(ctx, claims.SessionID); err != nil {
+			return noBody{}, nil, ctxerr.QuickWrap(ctx, err)
+		}
+		return noBody{}, nil, nil
 	}
 
 	id, err := uuid.Parse(claims.ID)
 	if err != nil {
-		return nil, nil, 0, ctxerr.WrapHTTP(ctx, err, "f57df46c-d870-4ce1-a2c2-86feefe792ae", "JWT ID not a uuid", http.StatusBadRequest, "jwt id not uuid")
+		return noBody{}, nil, ctxerr.WrapHTTP(ctx, err, "f57df46c-d870-4ce1-a2c2-86feefe792ae", "JWT ID not a uuid", http.StatusBadRequest, "jwt id not uuid")
 	}
 	et, err := claims.GetExpirationTime()
 	if err != nil {
-		return nil, nil, 0, ctxerr.WrapHTTP(ctx, err, "a2f2d73d-e1de-4b36-82d7-2bf78abd5033", "JWT expiration time not a valid time", http.StatusBadRequest, "jwt expiration time not valid time")
+		return noBody{}, nil, ctxerr.WrapHTTP(ctx, err, "a2f2d73d-e1de-4b36-82d7-2bf78abd5033", "JWT expiration time not a valid time", http.StatusBadRequest, "jwt expiration time not valid time")
 	}
 	_, err = h.db.LogoutCreate(ctx, types.Logout{
 		JWTID:      id,
 		Expiration: et.Time,
 	})
 	if err != nil {
-		return nil, nil, 0, ctxerr.QuickWrap(ctx, err)
+		return noBody{}, nil, ctxerr.QuickWrap(ctx, err)
 	}
 
-	return nil, nil, http.StatusOK, nil
+	return noBody{}, nil, nil
 }
@@ -1,7 +1,7 @@
 package router
 
 import (
-	"encoding/json"
+	"context"
 	"net/http"
 	"net/url"
 	"strings"
@@ -11,36 +11,96 @@ import (
 	"github.com/mvndaai/known-anywhere/internal/config"
 	"github.com/mvndaai/known-anywhere/internal/db"
 	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/mvndaai/known-anywhere/internal/router/server"
+	"github.com/mvndaai/known-anywhere/internal/types"
 )
 
+// writeError handles the error and writes the same error response as
+// handlers for middleware that stops a request
+func writeError(w http.ResponseWriter, err error) {
+	ctxerr.Handle(err)
+	status, errorResp := errorResponse(err)
+	writeJSON(context.Background(), w, status, errorResp, false)
+}
+
+// errorResponse is the response for an error. Fields are only shown when
+// debugging, except violations so clients can fix their requests.
+func errorResponse(err error) (int, ctxerrhttp.ErrorResponse) {
+	debugErrors := config.Get().DebugErrors
+	status, errorResp := ctxerrhttp.StatusCodeAndResponse(err, debugErrors, debugErrors)
+	if v, ok := ctxerr.AllFields(err)[server.FieldViolations]; ok {
+		if errorResp.Error.Fields == nil {
+			errorResp.Error.Fields = map[string]any{}
+		}
+		errorResp.Error.Fields[server.FieldViolations] = v
+	}
+	return status, errorResp
+}
+
+// checkJWT gets the claims of the request token, or API key, and makes sure
+// the route allows them and the token was not logged out
+func checkJWT(db *db.DB, r *http.Request) (*jwt.JWTClaims, error) {
+	ctx := r.Context()
+	route, _ := server.RouteInfoFromContext(ctx)
+	if key := r.Header.Get(jwt.HeaderAPIKey); key != "" && db != nil {
+		claims, err := db.APIKeyClaims(ctx, key)
+		if err != nil {
+			return nil, ctxerr.QuickWrap(ctx, err)
+		}
+		err = claims.EnsureAccess(ctx, route.Audience, route.Scopes)
+		if err != nil {
+			return nil, ctxerr.WrapHTTP(ctx, err, "75258f94-f494-44a1-a162-861ace97810e", "failed api key claims", http.StatusUnauthorized, "failed to ensure api key access")
+		}
+		return claims, nil
+	}
+
+	claims, err := jwt.GetJWTClaims(r)
+	if err != nil {
+		return nil, ctxerr.WrapHTTP(ctx, err, "2a321992-5c73-4c2f-b55b-6c291984e1f7", "invalid auth token", http.StatusUnauthorized, "invalid token format")
+	}
+	err = claims.EnsureClaims(ctx, r.Method, r.URL.Path, r.URL.Query(), route.Audience, route.Scopes)
+	if err != nil {
+		return nil, ctxerr.WrapHTTP(ctx, err, "d0257175-2fbd-46e8-9ef5-9dc1212c5491", "failed jwt claims", http.StatusUnauthorized, "failed to ensure claims")
+	}
+	if db != nil {
+		err = db.JWTAllowed(ctx, claims.ID, claims.SessionID)
+		if err != nil {
+			return nil, ctxerr.QuickWrap(ctx, err)
+		}
+	}
+	return claims, nil
+}
+
 func JWTMiddleware(db *db.DB) func(http.HandlerFunc) http.HandlerFunc {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
+			// OptionalJWTMiddleware already checked the token for this route
+			if _, ok := jwt.ClaimsFromContext(ctx); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
 
-			err := func() error {
-				claims, err := jwt.GetJWTClaims(r)
-				if err != nil {
-					return ctxerr.WrapHTTP(ctx, err, "2a321992-5c73-4c2f-b55b-6c291984e1f7", "invalid auth token", http.StatusUnauthorized, "invalid token format")
-				}
-				err = claims.EnsureClaims(ctx, r.Method, r.URL.Path, r.URL.Query(), "")
-				if err != nil {
-					return ctxerr.WrapHTTP(ctx, err, "d0257175-2fbd-46e8-9ef5-9dc1212c5491", "failed jwt claims", http.StatusUnauthorized, "failed to ensure claims")
-				}
-				if db != nil {
-					err = db.JWTAllowed(ctx, claims.Subject, claims.ID)
-					if err != nil {
-						return ctxerr.QuickWrap(ctx, err)
-					}
-				}
-				return nil
-			}()
+			claims, err := checkJWT(db, r)
 			if err != nil {
-				ctxerr.Handle(err)
-				debugErrors := config.Get().DebugErrors
-				status, errorResp := ctxerrhttp.StatusCodeAndResponse(err, debugErrors, debugErrors)
-				b, _ := json.Marshal(errorResp)
-				http.Error(w, string(b), status)
+				writeError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(jwt.ContextWithClaims(ctx, claims)))
+		}
+	}
+}
+
+// RequireRole only lets through tokens with at least the role, it goes after
+// JWTMiddleware
+func RequireRole(role types.Role) server.MiddlewareFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if !jwt.RoleFromContext(ctx).AtLeast(role) {
+				ctx = ctxerr.SetField(ctx, "required_role", role)
+				err := ctxerr.NewHTTP(ctx, "8afe347a-e1b2-48ae-8c43-22b10eb7e805", "not allowed", http.StatusForbidden, "role too low")
+				writeError(w, err)
 				return
 			}
 			next.ServeHTTP(w, r)
@@ -48,6 +108,27 @@ func JWTMiddleware(db *db.DB) func(http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// OptionalJWTMiddleware adds the claims and subject of a valid token to the
+// context. Requests without a valid token go through anonymously, endpoints
+// that need a token still use JWTMiddleware.
+func OptionalJWTMiddleware(db *db.DB) server.MiddlewareFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		withSubject := JWTSubjectMiddleware(next)
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(jwt.HeaderAuthorization) == "" && r.Header.Get(jwt.HeaderAPIKey) == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			claims, err := checkJWT(db, r)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			withSubject.ServeHTTP(w, r.WithContext(jwt.ContextWithClaims(r.Context(), claims)))
+		}
+	}
+}
+
 func CleanUpParamsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Clean up the URL parameters
@@ -66,9 +147,17 @@ func CleanUpParamsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 func JWTSubjectMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		claims, err := jwt.GetJWTClaims(r)
+		claims, ok := jwt.ClaimsFromContext(r.Context())
+		var err error
+		if !ok {
+			claims, err = jwt.GetJWTClaims(r)
+		}
 		if err == nil && claims != nil {
 			ctx := jwt.ContextWithSubject(r.Context(), claims.Subject)
+			ctx = jwt.ContextWithSessionID(ctx, claims.SessionID)
+			if claims.Act != nil {
+				ctx = jwt.ContextWithActor(ctx, claims.Act.Subject)
+			}
 			r = r.WithContext(ctx)
 		}
 		next.ServeHTTP(w, r)
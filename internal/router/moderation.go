@@ -0,0 +1,32 @@
+package router
+
+import (
+	"context"
+
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+func (h *Handler) pendingDomainListHandler(ctx context.Context, pagination types.Pagination) ([]types.Domain, any, error) {
+	domains, pg, err := h.db.ListPendingDomains(ctx, pagination)
+	if err != nil {
+		return nil, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return domains, pg, nil
+}
+
+func (h *Handler) pendingDomainLinkListHandler(ctx context.Context, pagination types.Pagination) ([]types.DomainLink, any, error) {
+	links, pg, err := h.db.ListPendingDomainLinks(ctx, pagination)
+	if err != nil {
+		return nil, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return links, pg, nil
+}
+
+func (h *Handler) notificationListHandler(ctx context.Context, list types.NotificationList) ([]types.Notification, any, error) {
+	notifications, pg, err := h.db.ListNotifications(ctx, list.Filters, list.Pagination)
+	if err != nil {
+		return nil, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return notifications, pg, nil
+}
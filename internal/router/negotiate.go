@@ -0,0 +1,311 @@
+package router
+
+import (
+	"context"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+// Media types of responses, NDJSON and CSV are only for lists
+const (
+	mediaJSON   = "application/json"
+	mediaNDJSON = "application/x-ndjson"
+	mediaCSV    = "text/csv"
+)
+
+// mediaTypes maps what clients send in Accept to the media type of the
+// response
+var mediaTypes = map[string]string{
+	"*/*":                mediaJSON,
+	"application/*":      mediaJSON,
+	mediaJSON:            mediaJSON,
+	mediaNDJSON:          mediaNDJSON,
+	"application/ndjson": mediaNDJSON,
+	"application/jsonl":  mediaNDJSON,
+	mediaCSV:             mediaCSV,
+}
+
+// format is how a response is written, JSON without the envelope is only the
+// data with the meta in headers
+type format struct {
+	mediaType string
+	envelope  bool
+}
+
+// acceptedFormats are the formats of an Accept header from most to least
+// preferred. An empty header is JSON, application/json;envelope=false is JSON
+// without the envelope.
+func acceptedFormats(accept string) []format {
+	if strings.TrimSpace(accept) == "" {
+		return []format{{mediaType: mediaJSON, envelope: true}}
+	}
+
+	type weighted struct {
+		format
+		q float64
+	}
+	var formats []weighted
+	for _, v := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+		mediaType, ok := mediaTypes[mt]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		envelope := mediaType == mediaJSON
+		if v, ok := params["envelope"]; ok && envelope {
+			envelope, _ = strconv.ParseBool(v)
+		}
+		formats = append(formats, weighted{format{mediaType: mediaType, envelope: envelope}, q})
+	}
+	slices.SortStableFunc(formats, func(a, b weighted) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+
+	f := make([]format, len(formats))
+	for i, w := range formats {
+		f[i] = w.format
+	}
+	return f
+}
+
+// negotiate is acceptedFormats for a request. Only GET and HEAD can be a list
+// in other formats, the rest are JSON, and with the envelope when Accept has
+// no JSON, so a handler that changes something is never followed by a 406.
+func negotiate(method, accept string) []format {
+	formats := acceptedFormats(accept)
+	if method == http.MethodGet || method == http.MethodHead {
+		return formats
+	}
+	formats = slices.DeleteFunc(formats, func(f format) bool { return f.mediaType != mediaJSON })
+	if len(formats) == 0 {
+		return []format{{mediaType: mediaJSON, envelope: true}}
+	}
+	return formats
+}
+
+// notAcceptable is the error when nothing in Accept can be written
+func notAcceptable(ctx context.Context, accept string) error {
+	ctx = ctxerr.SetField(ctx, "accept", accept)
+	return ctxerr.NewHTTP(ctx, "9b18ced3-c438-48f3-b7c0-81f78f96bb59", "accept application/json, or for lists application/x-ndjson or text/csv", http.StatusNotAcceptable, "no acceptable media type")
+}
+
+// writeFormat writes a successful response in f, false means f cannot write
+// data like CSV for something that is not a list
+func writeFormat(ctx context.Context, w http.ResponseWriter, f format, status int, data, meta any, indent bool) bool {
+	switch f.mediaType {
+	case mediaJSON:
+		if f.envelope {
+			writeJSON(ctx, w, status, Return{Success: true, Data: data, Meta: meta}, indent)
+			return true
+		}
+		setMetaHeaders(w.Header(), meta)
+		writeJSON(ctx, w, status, data, indent)
+		return true
+	case mediaNDJSON:
+		items, ok := listItems(data)
+		if !ok {
+			return false
+		}
+		setMetaHeaders(w.Header(), meta)
+		writeNDJSON(ctx, w, status, items)
+		return true
+	case mediaCSV:
+		items, ok := listItems(data)
+		if !ok {
+			return false
+		}
+		records, ok := csvRecords(items)
+		if !ok {
+			return false
+		}
+		setMetaHeaders(w.Header(), meta)
+		writeCSV(ctx, w, status, records)
+		return true
+	}
+	return false
+}
+
+// setMetaHeaders keeps the pagination of responses without the envelope
+func setMetaHeaders(h http.Header, meta any) {
+	if p, ok := meta.(types.PaginationResponse); ok {
+		h.Set("Pagination-Total", strconv.Itoa(p.Total))
+		h.Set("Pagination-Cursor", p.Cursor)
+	}
+}
+
+func listItems(data any) (reflect.Value, bool) {
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return reflect.Value{}, false
+	}
+	return v, true
+}
+
+// writeNDJSON writes a line of JSON for each item of a list the handler
+// already returned. The status is written first so an item that cannot be
+// encoded is only handled.
+func writeNDJSON(ctx context.Context, w http.ResponseWriter, status int, items reflect.Value) {
+	w.Header().Set("Content-Type", mediaNDJSON)
+	w.WriteHeader(statusOrOK(status))
+	encoder := json.NewEncoder(w)
+	for i := range items.Len() {
+		if err := encoder.Encode(items.Index(i).Interface()); err != nil {
+			ctxerr.Handle(ctxerr.Wrap(ctx, err, "a760c403-a644-403c-8a25-9e00e1629895", "writing ndjson"))
+			return
+		}
+	}
+}
+
+func writeCSV(ctx context.Context, w http.ResponseWriter, status int, records [][]string) {
+	w.Header().Set("Content-Type", mediaCSV+"; charset=utf-8")
+	w.WriteHeader(statusOrOK(status))
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(records); err != nil {
+		ctxerr.Handle(ctxerr.Wrap(ctx, err, "4668a4df-aa1d-4c87-bde6-47b599043b7e", "writing csv"))
+	}
+}
+
+func statusOrOK(status int) int {
+	if status == 0 {
+		return http.StatusOK
+	}
+	return status
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// csvRecords are a header of the json names and a row for each item. Items
+// have to be structs, embedded structs are flattened and values that are not
+// text, like lists, are written as JSON.
+func csvRecords(items reflect.Value) ([][]string, bool) {
+	t := items.Type().Elem()
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) {
+		return nil, false
+	}
+	columns := csvColumns(t, nil)
+
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.name
+	}
+	records := [][]string{header}
+	for i := range items.Len() {
+		item := reflect.Indirect(items.Index(i))
+		row := make([]string, len(columns))
+		if item.IsValid() {
+			for j, c := range columns {
+				f, err := item.FieldByIndexErr(c.index)
+				if err != nil {
+					// A nil embedded pointer
+					continue
+				}
+				row[j] = csvValue(f)
+			}
+		}
+		records = append(records, row)
+	}
+	return records, true
+}
+
+type csvColumn struct {
+	name  string
+	index []int
+}
+
+func csvColumns(t reflect.Type, index []int) []csvColumn {
+	var columns []csvColumn
+	for _, f := range reflect.VisibleFields(t) {
+		if len(f.Index) != 1 || !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		fieldIndex := append(slices.Clone(index), f.Index...)
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			columns = append(columns, csvColumns(ft, fieldIndex)...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		columns = append(columns, csvColumn{name: name, index: fieldIndex})
+	}
+	return columns
+}
+
+func csvValue(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.CanAddr() {
+		v = v.Addr()
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		b, _ := m.MarshalText()
+		return csvText(string(b))
+	}
+	v = reflect.Indirect(v)
+	switch v.Kind() {
+	case reflect.String:
+		return csvText(v.String())
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	}
+	b, _ := json.Marshal(v.Interface())
+	return string(b)
+}
+
+// csvText keeps spreadsheets from running text as a formula by starting text
+// that would be one with a quote
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,148 @@
+package router
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/config"
+	"github.com/mvndaai/known-anywhere/internal/oidc"
+	"github.com/mvndaai/known-anywhere/internal/router/server"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+func (h *Handler) provider(ctx context.Context, name string) (*oidc.Provider, error) {
+	p, ok := h.providers[name]
+	if !ok {
+		ctx = ctxerr.SetField(ctx, "provider", name)
+		return nil, ctxerr.NewHTTP(ctx, "ae562695-cc2f-4ef5-9475-08b42d4e66ea", "unknown login provider", http.StatusNotFound, "oidc provider not configured")
+	}
+	return p, nil
+}
+
+// oidcStateCookie ties a login to the browser that started it so a callback
+// with someone else's state is refused
+const oidcStateCookie = "oidc_state"
+
+// setOIDCStateCookie sets the state for the callback of the provider, an empty
+// state removes it
+func setOIDCStateCookie(ctx context.Context, provider, state string) {
+	c := &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/oidc/" + provider,
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(config.Get().PublicURL, "https://"),
+		// Lax so it is sent when the provider redirects back
+		SameSite: http.SameSiteLaxMode,
+	}
+	if state == "" {
+		c.MaxAge = -1
+	}
+	server.SetResponseHeader(ctx, "Set-Cookie", c.String())
+}
+
+// oidcProvider is the request of the {provider} path parameter
+type oidcProvider struct {
+	Provider string `path:"provider" json:"-"`
+}
+
+// oidcCallback is what the provider redirects back with, error is set instead
+// of code when the login was not completed
+type oidcCallback struct {
+	Provider         string `path:"provider" json:"-"`
+	Code             string `json:"code,omitempty"`
+	State            string `json:"state,omitempty"`
+	Error            string `json:"error,omitempty"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func (v *oidcCallback) Fill(ctx context.Context, q url.Values) error {
+	v.Code = q.Get("code")
+	v.State = q.Get("state")
+	v.Error = q.Get("error")
+	v.ErrorDescription = q.Get("error_description")
+	return nil
+}
+
+// oidcLoginHandler starts a provider login, the client sends the user to the
+// returned url. The state is also set in a cookie for the callback.
+func (h *Handler) oidcLoginHandler(ctx context.Context, req oidcProvider) (types.OIDCLogin, any, error) {
+	p, err := h.provider(ctx, req.Provider)
+	if err != nil {
+		return types.OIDCLogin{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+
+	ar, err := p.AuthCodeURL(ctx)
+	if err != nil {
+		return types.OIDCLogin{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	err = h.db.CreateOIDCState(ctx, types.OIDCState{
+		Provider:     p.Name(),
+		State:        ar.State,
+		Nonce:        ar.Nonce,
+		CodeVerifier: ar.CodeVerifier,
+	})
+	if err != nil {
+		return types.OIDCLogin{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	setOIDCStateCookie(ctx, p.Name(), ar.State)
+	return types.OIDCLogin{AuthorizationURL: ar.URL}, nil, nil
+}
+
+// oidcCallbackHandler finishes a provider login and logs in the linked user
+func (h *Handler) oidcCallbackHandler(r *http.Request, req oidcCallback) (types.Token, any, error) {
+	ctx := r.Context()
+	p, err := h.provider(ctx, req.Provider)
+	if err != nil {
+		return types.Token{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+
+	if req.Error != "" {
+		ctx = ctxerr.SetField(ctx, "error", req.Error)
+		ctx = ctxerr.SetField(ctx, "error_description", req.ErrorDescription)
+		return types.Token{}, nil, ctxerr.NewHTTP(ctx, "782c5d4d-b1cb-4847-b384-732c8dbcdb8e", "login was not completed", http.StatusBadRequest, "oidc provider returned an error")
+	}
+	code, state := req.Code, req.State
+	if code == "" || state == "" {
+		return types.Token{}, nil, ctxerr.NewHTTP(ctx, "110ef7dd-aa3f-48b8-9895-7703577cf86a", "missing code or state", http.StatusBadRequest, "missing code or state")
+	}
+
+	c, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(c.Value), []byte(state)) != 1 {
+		return types.Token{}, nil, ctxerr.NewHTTP(ctx, "15d1d241-f87f-42b0-a01d-d9b990e5004d", "login was started in another browser, please try again", http.StatusBadRequest, "oidc state does not match cookie")
+	}
+	setOIDCStateCookie(ctx, p.Name(), "")
+
+	s, err := h.db.ConsumeOIDCState(ctx, p.Name(), state)
+	if err != nil {
+		return types.Token{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+
+	claims, err := p.Exchange(ctx, code, s.CodeVerifier, s.Nonce)
+	if err != nil {
+		return types.Token{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+
+	u, err := h.db.UserForIdentity(ctx, types.Identity{
+		Provider:          p.Name(),
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	})
+	if err != nil {
+		return types.Token{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+
+	token, err := h.startSession(r, u)
+	if err != nil {
+		return types.Token{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return token, nil, nil
+}
@@ -0,0 +1,57 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/jwt"
+	"github.com/mvndaai/known-anywhere/internal/router/server"
+)
+
+// Requests per second and bursts of the rate limits
+const (
+	apiRate, apiBurst = 10, 100
+	// authRate slows down password guessing and sending mail
+	authRate, authBurst = 1.0 / 6, 10
+	// lookupRate slows down scraping usernames
+	lookupRate, lookupBurst = 1, 30
+	// voteRate slows down brigading
+	voteRate, voteBurst = 1.0 / 3, 20
+)
+
+// rateLimit limits each user, or the client IP for anonymous requests. It
+// goes on routers that have the subject in the context.
+func (h *Handler) rateLimit(rate float64, burst int) *server.RateLimit {
+	return &server.RateLimit{
+		Rate:           rate,
+		Burst:          burst,
+		Key:            h.rateLimitKey,
+		TrustedProxies: h.trustedProxies,
+		Limited:        rateLimited,
+	}
+}
+
+// ipRateLimit limits each client IP even when there is a user, for routes
+// used before logging in
+func (h *Handler) ipRateLimit(rate float64, burst int) *server.RateLimit {
+	return &server.RateLimit{
+		Rate:           rate,
+		Burst:          burst,
+		TrustedProxies: h.trustedProxies,
+		Limited:        rateLimited,
+	}
+}
+
+func (h *Handler) rateLimitKey(r *http.Request) string {
+	if sub := jwt.SubjectFromContext(r.Context()); sub != uuid.Nil {
+		return "user:" + sub.String()
+	}
+	return "ip:" + server.ClientKey(r, h.trustedProxies)
+}
+
+func rateLimited(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx = ctxerr.SetField(ctx, "subject", jwt.SubjectFromContext(ctx))
+	writeError(w, ctxerr.NewHTTP(ctx, "98561c10-385b-40b9-ba22-22380f6b1e1d", "too many requests", http.StatusTooManyRequests, "rate limited"))
+}
@@ -0,0 +1,50 @@
+package router
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+func (h *Handler) roleSetHandler(ctx context.Context, req idBody[types.RoleChange]) (types.RoleAudit, any, error) {
+	a, err := h.db.SetUserRole(ctx, req.ID.String(), req.Body)
+	if err != nil {
+		return types.RoleAudit{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return a, nil, nil
+}
+
+// roleRevoke is the user losing their role and the optional reason
+type roleRevoke struct {
+	ID     uuid.UUID `path:"id" json:"-"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+func (v *roleRevoke) Fill(ctx context.Context, q url.Values) error {
+	v.Reason = q.Get("reason")
+	return nil
+}
+
+// roleRevokeHandler takes away any extra role, the reason is the optional
+// reason query parameter
+func (h *Handler) roleRevokeHandler(ctx context.Context, req roleRevoke) (types.RoleAudit, any, error) {
+	body := types.RoleChange{Role: types.RoleUser, Reason: req.Reason}
+	body.Normalize()
+
+	a, err := h.db.SetUserRole(ctx, req.ID.String(), body)
+	if err != nil {
+		return types.RoleAudit{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return a, nil, nil
+}
+
+func (h *Handler) roleAuditListHandler(ctx context.Context, list types.RoleAuditList) ([]types.RoleAudit, any, error) {
+	audits, pagination, err := h.db.ListRoleAudits(ctx, list.Filters, list.Pagination)
+	if err != nil {
+		return nil, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return audits, pagination, nil
+}
@@ -1,13 +1,16 @@
 package router
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"strconv"
 
+	"github.com/google/uuid"
 	"github.com/mvndaai/ctxerr"
 	ctxerrhttp "github.com/mvndaai/ctxerr/http"
-	"github.com/mvndaai/known-anywhere/internal/config"
+	"github.com/mvndaai/known-anywhere/internal/router/server"
 )
 
 type (
@@ -23,35 +26,128 @@ type (
 
 type GenericHandlerFunc func(r *http.Request) (data, meta any, status int, _ error)
 
+// GenericToHTTP writes what a handler returns in the format asked for in
+// Accept, see negotiate. The format is picked before the handler is called so
+// a change is never made for a response that cannot be written. Errors are
+// always a JSON Return. Handlers can set headers with server.SetResponseHeader,
+// they are written with the status before the body. A Location is dropped when
+// the handler fails since it would point to something that was not made.
 func GenericToHTTP(handler GenericHandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var ret Return
+		ctx := server.ContextWithResponseHeader(r.Context(), w.Header())
+		r = r.WithContext(ctx)
+		w.Header().Add("Vary", "Accept")
+		indent, _ := strconv.ParseBool(r.Header.Get("Indent"))
+
+		accept := r.Header.Get("Accept")
+		formats := negotiate(r.Method, accept)
+		if len(formats) == 0 {
+			writeErrorJSON(ctx, w, notAcceptable(ctx, accept), indent)
+			return
+		}
+
 		data, meta, status, err := handler(r)
 		if err != nil {
-			ctxerr.Handle(err)
-			debugErrors := config.Get().DebugErrors
-			var errorResp ctxerrhttp.ErrorResponse
-			status, errorResp = ctxerrhttp.StatusCodeAndResponse(err, debugErrors, debugErrors)
-			ret.Error = &errorResp.Error
-		} else {
-			ret.Success = true
-			ret.Data = data
-			ret.Meta = meta
+			// Nothing was made so nothing is there
+			w.Header().Del("Location")
+			writeErrorJSON(ctx, w, err, indent)
+			return
 		}
-
-		encoder := json.NewEncoder(w)
-		indent, _ := strconv.ParseBool(r.Header.Get("Indent"))
-		if indent {
-			encoder.SetIndent("", "\t")
+		for _, f := range formats {
+			if writeFormat(ctx, w, f, status, data, meta, indent) {
+				return
+			}
 		}
-		err = encoder.Encode(ret)
-		if err != nil {
-			ctxerr.Handle(ctxerr.Wrap(r.Context(), err, "8e9ba72c-7279-42bd-b01d-7d453b7915a3", "writing response"))
+		writeErrorJSON(ctx, w, notAcceptable(ctx, accept), indent)
+	}
+}
+
+// writeErrorJSON handles the error and writes it in a Return
+func writeErrorJSON(ctx context.Context, w http.ResponseWriter, err error, indent bool) {
+	ctxerr.Handle(err)
+	status, errorResp := errorResponse(err)
+	writeJSON(ctx, w, status, Return{Error: &errorResp.Error}, indent)
+}
+
+// writeJSON writes the status and Content-Type then v. It is encoded first so
+// a value that cannot be encoded is a 500 instead of half a 200.
+func writeJSON(ctx context.Context, w http.ResponseWriter, status int, v any, indent bool) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	if indent {
+		encoder.SetIndent("", "\t")
+	}
+	err := encoder.Encode(v)
+	if err != nil {
+		err = ctxerr.Wrap(ctx, err, "8e9ba72c-7279-42bd-b01d-7d453b7915a3", "encoding response")
+		ctxerr.Handle(err)
+		var errorResp ctxerrhttp.ErrorResponse
+		status, errorResp = errorResponse(err)
+		b.Reset()
+		_ = json.NewEncoder(&b).Encode(Return{Error: &errorResp.Error})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(b.Bytes()); err != nil {
+		ctxerr.Handle(ctxerr.Wrap(ctx, err, "3f9823b6-e548-4521-82bf-ed339f52565f", "writing response"))
+	}
+}
+
+// idPath is the request of endpoints that only read the {id} path parameter
+type idPath struct {
+	ID uuid.UUID `path:"id" json:"-"`
+}
+
+// endpoint adds a handler that gets Req already decoded, normalized and
+// validated, its doc comes from Req and Data
+func endpoint[Req, Data any](rt server.Router[GenericHandlerFunc], path, method string, handler server.TypedHandlerFunc[Req, Data], d server.Doc) {
+	server.Endpoint(rt, path, method, handler, requestDoc[Req, Data](method, d))
+}
+
+// listEndpoint adds a GET handler of a list, it returns the pagination as meta
+func listEndpoint[Req, Item any](rt server.Router[GenericHandlerFunc], path string, handler server.TypedHandlerFunc[Req, []Item], d server.Doc) {
+	server.Endpoint(rt, path, http.MethodGet, handler, listDoc[Req, Item](d))
+}
+
+// requestEndpoint is endpoint for handlers that also need the request, like
+// for headers, cookies or the client address
+func requestEndpoint[Req, Data any](rt server.Router[GenericHandlerFunc], path, method string, handler server.RequestHandlerFunc[Req, Data], d server.Doc) {
+	server.RequestEndpoint(rt, path, method, handler, requestDoc[Req, Data](method, d))
+}
+
+// setLocation points the response to a created resource, path is where it
+// can be read like /api/domain
+func setLocation(ctx context.Context, path string, id uuid.UUID) {
+	server.SetResponseHeader(ctx, "Location", path+"/"+id.String())
+}
+
+// idBody is the request of endpoints that read the {id} path parameter and a
+// JSON body of T
+type idBody[T any] struct {
+	ID   uuid.UUID `path:"id" json:"-"`
+	Body T         `body:"" json:"-"`
+}
+
+// updateHandler applies a partial update of T to the {id} path parameter
+func updateHandler[T any](update func(ctx context.Context, id string, v T) error) server.TypedHandlerFunc[idBody[T], noBody] {
+	return func(ctx context.Context, req idBody[T]) (noBody, any, error) {
+		if err := update(ctx, req.ID.String(), req.Body); err != nil {
+			return noBody{}, nil, ctxerr.QuickWrap(ctx, err)
 		}
+		return noBody{}, nil, nil
+	}
+}
 
-		// TODO figure out why this is always 200
-		if status != 0 && status != http.StatusOK {
-			w.WriteHeader(status)
+// idHandler calls fn with the {id} path parameter, used for deletes and restores
+func idHandler(fn func(ctx context.Context, id string) error) server.TypedHandlerFunc[idPath, noBody] {
+	return func(ctx context.Context, req idPath) (noBody, any, error) {
+		if err := fn(ctx, req.ID.String()); err != nil {
+			return noBody{}, nil, ctxerr.QuickWrap(ctx, err)
 		}
+		return noBody{}, nil, nil
 	}
 }
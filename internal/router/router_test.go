@@ -0,0 +1,306 @@
+package router_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/router"
+	"github.com/mvndaai/known-anywhere/internal/router/server"
+	"github.com/mvndaai/known-anywhere/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenericToHTTP(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler router.GenericHandlerFunc
+		status  int
+		header  http.Header
+		success bool
+		code    string
+	}{
+		{
+			name: "default status",
+			handler: func(r *http.Request) (data, meta any, status int, _ error) {
+				return "ok", nil, 0, nil
+			},
+			status:  http.StatusOK,
+			success: true,
+		},
+		{
+			name: "created with location",
+			handler: func(r *http.Request) (data, meta any, status int, _ error) {
+				server.SetResponseHeader(r.Context(), "Location", "/api/domain/1")
+				return "1", nil, http.StatusCreated, nil
+			},
+			status:  http.StatusCreated,
+			header:  http.Header{"Location": {"/api/domain/1"}},
+			success: true,
+		},
+		{
+			name: "error status",
+			handler: func(r *http.Request) (data, meta any, status int, _ error) {
+				return nil, nil, http.StatusOK, ctxerr.NewHTTP(r.Context(), "af0f4bdd-6bd0-4f73-9b05-72a9f23ad8f2", "not found", http.StatusNotFound, "missing")
+			},
+			status: http.StatusNotFound,
+			code:   "af0f4bdd-6bd0-4f73-9b05-72a9f23ad8f2",
+		},
+		{
+			name: "error headers",
+			handler: func(r *http.Request) (data, meta any, status int, _ error) {
+				server.SetResponseHeader(r.Context(), "Retry-After", "30")
+				return nil, nil, 0, ctxerr.NewHTTP(r.Context(), "0f1b6a2c-4f55-4d5c-a3c6-7d0ffb0c55d8", "try later", http.StatusServiceUnavailable, "unavailable")
+			},
+			status: http.StatusServiceUnavailable,
+			header: http.Header{"Retry-After": {"30"}},
+			code:   "0f1b6a2c-4f55-4d5c-a3c6-7d0ffb0c55d8",
+		},
+		{
+			name: "failed create has no location",
+			handler: func(r *http.Request) (data, meta any, status int, _ error) {
+				server.SetResponseHeader(r.Context(), "Location", "/api/domain/1")
+				return nil, nil, 0, ctxerr.NewHTTP(r.Context(), "3a428348-0e77-413a-b274-1705f1657ab9", "already exists", http.StatusConflict, "conflict")
+			},
+			status: http.StatusConflict,
+			header: http.Header{"Location": nil},
+			code:   "3a428348-0e77-413a-b274-1705f1657ab9",
+		},
+		{
+			name: "error without status",
+			handler: func(r *http.Request) (data, meta any, status int, _ error) {
+				return nil, nil, 0, errors.New("failed")
+			},
+			status: http.StatusInternalServerError,
+		},
+		{
+			name: "unencodable data",
+			handler: func(r *http.Request) (data, meta any, status int, _ error) {
+				return make(chan int), nil, http.StatusCreated, nil
+			},
+			status: http.StatusInternalServerError,
+			code:   "8e9ba72c-7279-42bd-b01d-7d453b7915a3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.GenericToHTTP(tt.handler)(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			for k := range tt.header {
+				assert.Equal(t, tt.header.Get(k), w.Header().Get(k))
+			}
+			var ret router.Return
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ret))
+			assert.Equal(t, tt.success, ret.Success)
+			if !tt.success {
+				require.NotNil(t, ret.Error)
+				assert.Equal(t, tt.code, ret.Error.Code)
+			}
+		})
+	}
+}
+
+func TestMiddlewareErrorStatus(t *testing.T) {
+	h := router.JWTMiddleware(nil)(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be called")
+	})
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.True(t, json.Valid(w.Body.Bytes()))
+}
+
+func TestGenericToHTTPAccept(t *testing.T) {
+	id := uuid.MustParse("9b4c4f5e-5a40-4ad4-9d1b-0d3f1f1c8a11")
+	description := "a, \"quoted\" one"
+	list := func(r *http.Request) (data, meta any, status int, _ error) {
+		return []types.Domain{
+			{ID: id, DomainCreate: types.DomainCreate{DisplayName: "example.com", Description: description}},
+			{ID: id, DomainCreate: types.DomainCreate{DisplayName: "example.org"}},
+		}, types.PaginationResponse{Total: 12, Cursor: "next"}, 0, nil
+	}
+	single := func(r *http.Request) (data, meta any, status int, _ error) {
+		return types.Domain{ID: id}, nil, 0, nil
+	}
+
+	tests := []struct {
+		name        string
+		handler     router.GenericHandlerFunc
+		method      string
+		accept      string
+		status      int
+		contentType string
+		body        string
+		pagination  bool
+	}{
+		{
+			name:        "no accept",
+			handler:     single,
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body:        `{"success":true,"data":{"id":"9b4c4f5e-5a40-4ad4-9d1b-0d3f1f1c8a11","display_name":"","description":"","notes":""}}` + "\n",
+		},
+		{
+			name:        "browser",
+			handler:     single,
+			accept:      "text/html,application/xhtml+xml,*/*;q=0.8",
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body:        `{"success":true,"data":{"id":"9b4c4f5e-5a40-4ad4-9d1b-0d3f1f1c8a11","display_name":"","description":"","notes":""}}` + "\n",
+		},
+		{
+			name:        "without envelope",
+			handler:     list,
+			accept:      "application/json; envelope=false",
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body: `[{"id":"9b4c4f5e-5a40-4ad4-9d1b-0d3f1f1c8a11","display_name":"example.com","description":"a, \"quoted\" one","notes":""},` +
+				`{"id":"9b4c4f5e-5a40-4ad4-9d1b-0d3f1f1c8a11","display_name":"example.org","description":"","notes":""}]` + "\n",
+			pagination: true,
+		},
+		{
+			name:        "ndjson",
+			handler:     list,
+			accept:      "application/x-ndjson",
+			status:      http.StatusOK,
+			contentType: "application/x-ndjson",
+			body: `{"id":"9b4c4f5e-5a40-4ad4-9d1b-0d3f1f1c8a11","display_name":"example.com","description":"a, \"quoted\" one","notes":""}` + "\n" +
+				`{"id":"9b4c4f5e-5a40-4ad4-9d1b-0d3f1f1c8a11","display_name":"example.org","description":"","notes":""}` + "\n",
+			pagination: true,
+		},
+		{
+			name:        "csv",
+			handler:     list,
+			accept:      "text/csv",
+			status:      http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			body: "id,display_name,description,notes\n" +
+				"9b4c4f5e-5a40-4ad4-9d1b-0d3f1f1c8a11,example.com,\"a, \"\"quoted\"\" one\",\n" +
+				"9b4c4f5e-5a40-4ad4-9d1b-0d3f1f1c8a11,example.org,,\n",
+			pagination: true,
+		},
+		{
+			name:        "preferred",
+			handler:     list,
+			accept:      "application/json;q=0.5, text/csv;q=0.9",
+			status:      http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			body: "id,display_name,description,notes\n" +
+				"9b4c4f5e-5a40-4ad4-9d1b-0d3f1f1c8a11,example.com,\"a, \"\"quoted\"\" one\",\n" +
+				"9b4c4f5e-5a40-4ad4-9d1b-0d3f1f1c8a11,example.org,,\n",
+			pagination: true,
+		},
+		{
+			name:        "csv falls back for a single item",
+			handler:     single,
+			accept:      "text/csv, application/json;q=0.1",
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body:        `{"success":true,"data":{"id":"9b4c4f5e-5a40-4ad4-9d1b-0d3f1f1c8a11","display_name":"","description":"","notes":""}}` + "\n",
+		},
+		{
+			name:        "csv of a single item",
+			handler:     single,
+			accept:      "text/csv",
+			status:      http.StatusNotAcceptable,
+			contentType: "application/json",
+		},
+		{
+			name: "not acceptable",
+			handler: func(r *http.Request) (data, meta any, status int, _ error) {
+				t.Error("handler should not be called")
+				return nil, nil, 0, nil
+			},
+			accept:      "application/xml",
+			status:      http.StatusNotAcceptable,
+			contentType: "application/json",
+		},
+		{
+			name: "formulas in csv",
+			handler: func(r *http.Request) (data, meta any, status int, _ error) {
+				return []types.Domain{
+					{ID: id, DomainCreate: types.DomainCreate{DisplayName: "=HYPERLINK(\"http://x\")", Description: "+1", Notes: "@SUM(A1)"}},
+					{ID: id, DomainCreate: types.DomainCreate{DisplayName: "-2", Description: "\tx", Notes: "a=b"}},
+				}, nil, 0, nil
+			},
+			accept:      "text/csv",
+			status:      http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			body: "id,display_name,description,notes\n" +
+				"9b4c4f5e-5a40-4ad4-9d1b-0d3f1f1c8a11,\"'=HYPERLINK(\"\"http://x\"\")\",'+1,'@SUM(A1)\n" +
+				"9b4c4f5e-5a40-4ad4-9d1b-0d3f1f1c8a11,'-2,'\tx,a=b\n",
+		},
+		{
+			name:        "post is json",
+			handler:     list,
+			method:      http.MethodPost,
+			accept:      "text/csv, application/json;q=0.1;envelope=false",
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body: `[{"id":"9b4c4f5e-5a40-4ad4-9d1b-0d3f1f1c8a11","display_name":"example.com","description":"a, \"quoted\" one","notes":""},` +
+				`{"id":"9b4c4f5e-5a40-4ad4-9d1b-0d3f1f1c8a11","display_name":"example.org","description":"","notes":""}]` + "\n",
+			pagination: true,
+		},
+		{
+			name:        "post falls back to json",
+			handler:     single,
+			method:      http.MethodPost,
+			accept:      "text/csv",
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body:        `{"success":true,"data":{"id":"9b4c4f5e-5a40-4ad4-9d1b-0d3f1f1c8a11","display_name":"","description":"","notes":""}}` + "\n",
+		},
+		{
+			name:        "delete of something unknown is json",
+			handler:     single,
+			method:      http.MethodDelete,
+			accept:      "application/xml",
+			status:      http.StatusOK,
+			contentType: "application/json",
+		},
+		{
+			name: "errors are json",
+			handler: func(r *http.Request) (data, meta any, status int, _ error) {
+				return nil, nil, 0, ctxerr.NewHTTP(r.Context(), "6a2f0e36-0b55-4ad4-8d0c-0f0b3c1b8f7e", "bad", http.StatusBadRequest, "bad")
+			},
+			accept:      "text/csv",
+			status:      http.StatusBadRequest,
+			contentType: "application/json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "/", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			router.GenericToHTTP(tt.handler)(w, r)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, "Accept", w.Header().Get("Vary"))
+			if tt.body != "" {
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+			if tt.pagination {
+				assert.Equal(t, "12", w.Header().Get("Pagination-Total"))
+				assert.Equal(t, "next", w.Header().Get("Pagination-Cursor"))
+			}
+		})
+	}
+}
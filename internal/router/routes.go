@@ -2,9 +2,13 @@ package router
 
 import (
 	"context"
+	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/mvndaai/ctxerr"
 	"github.com/mvndaai/known-anywhere/internal/config"
 	"github.com/mvndaai/known-anywhere/internal/db"
@@ -23,12 +27,28 @@ func StartServer() error {
 	}
 	defer db.Close(ctx)
 
+	if config.Get().AutoMigrate {
+		err = db.MigrateUp(ctx)
+		if err != nil {
+			return ctxerr.QuickWrap(ctx, err)
+		}
+	}
+
+	// Fail on start instead of on the first request when keys are bad
+	if _, err := jwt.DefaultKeyring(); err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+
 	h, err := NewHandler(ctx, db)
 	if err != nil {
 		return ctxerr.QuickWrap(ctx, err)
 	}
 	defer h.Close()
 
+	purgeCtx, stopPurge := context.WithCancel(ctx)
+	defer stopPurge()
+	go db.PurgeLogoutsEvery(purgeCtx, time.Hour)
+
 	rootRouter, err := server.New(
 		server.Config[GenericHandlerFunc]{
 			PathPrefix: "/",
@@ -51,22 +71,184 @@ func StartServer() error {
 	// https://codeandlife.com/2022/02/12/combine-golang-and-sveltekit-for-gui/
 	rootRouter.Handle("", http.FileServer(http.Dir(config.Get().FrontendPath)))
 
-	rootRouter.Endpoint("/status", http.MethodGet, statusHandler, nil)
+	endpoint(rootRouter, "/status", http.MethodGet, statusHandler,
+		server.Doc{Summary: "Check the service is up"})
+	rootRouter.Handle("/.well-known/jwks.json", http.HandlerFunc(jwksHandler))
 	apiRouter := rootRouter.Subrouter(server.Config[GenericHandlerFunc]{
 		PathPrefix: "/api",
+		// Public lists show creators their own pending submissions
+		Middleware: []server.MiddlewareFunc{OptionalJWTMiddleware(db)},
+		RateLimit:  h.rateLimit(apiRate, apiBurst),
+		RequestValidation: &server.RequestValidation{
+			Invalid: func(w http.ResponseWriter, r *http.Request, err error) { writeError(w, err) },
+		},
 	})
-	apiRouter.Endpoint("/domain", http.MethodGet, h.domainListHandler, nil)
-	//apiRouter.Endpoint("/domain/{id}", http.MethodGet, h.domainGetHandler, nil)
-	apiRouter.Endpoint("/user", http.MethodGet, h.userListHandler, nil)
+	endpoint(apiRouter, "/refresh", http.MethodPost, h.refreshHandler,
+		server.Doc{Tags: tagAuth, Summary: "Swap a refresh token for new tokens"})
+
+	authRouter := apiRouter.Subrouter(server.Config[GenericHandlerFunc]{RateLimit: h.ipRateLimit(authRate, authBurst)})
+	requestEndpoint(authRouter, "/login", http.MethodPost, h.loginHandler,
+		server.Doc{Tags: tagAuth, Summary: "Log in"})
+	requestEndpoint(authRouter, "/register", http.MethodPost, h.registerHandler,
+		server.Doc{Tags: tagAuth, Summary: "Create an account", Status: http.StatusCreated})
+	endpoint(authRouter, "/oidc/{provider}/login", http.MethodGet, h.oidcLoginHandler,
+		server.Doc{Tags: tagAuth, Summary: "Start a login with an external provider"})
+	requestEndpoint(authRouter, "/oidc/{provider}/callback", http.MethodGet, h.oidcCallbackHandler,
+		server.Doc{Tags: tagAuth, Summary: "Finish a login with an external provider", Description: "The provider redirects here with code and state query parameters."})
+	endpoint(authRouter, "/password/reset", http.MethodPost, h.passwordResetRequestHandler,
+		server.Doc{Tags: tagAuth, Summary: "Email a password reset token", Status: http.StatusAccepted})
+	endpoint(authRouter, "/password/reset/confirm", http.MethodPost, h.passwordResetHandler,
+		server.Doc{Tags: tagAuth, Summary: "Set a new password with a reset token"})
+
+	listEndpoint(apiRouter, "/domain", h.domainListHandler,
+		server.Doc{Tags: tagDomains, Summary: "List domains"})
+	endpoint(apiRouter, "/domain/{id}", http.MethodGet, h.domainGetHandler,
+		server.Doc{Tags: tagDomains, Summary: "Get a domain"})
+	requestEndpoint(apiRouter, "/domain/{id}/link", http.MethodGet, h.domainLinkResolveHandler,
+		server.Doc{Tags: tagDomainLinks, Summary: "Get the link of a domain for the caller's country", Description: "The country comes from the country query parameter, otherwise from the Accept-Language header."})
+	listEndpoint(apiRouter, "/domain_link", h.domainLinkListHandler,
+		server.Doc{Tags: tagDomainLinks, Summary: "List domain links"})
+	endpoint(apiRouter, "/domain_link/{id}", http.MethodGet, h.domainLinkGetHandler,
+		server.Doc{Tags: tagDomainLinks, Summary: "Get a domain link"})
+	listEndpoint(apiRouter.Subrouter(server.Config[GenericHandlerFunc]{RateLimit: h.rateLimit(lookupRate, lookupBurst)}), "/user", h.userListHandler,
+		server.Doc{Tags: tagUsers, Summary: "List users"})
+	listEndpoint(apiRouter, "/group", h.groupListHandler,
+		server.Doc{Tags: tagGroups, Summary: "List groups"})
+	endpoint(apiRouter, "/group/{id}", http.MethodGet, h.groupGetHandler,
+		server.Doc{Tags: tagGroups, Summary: "Get a group"})
+	listEndpoint(apiRouter, "/social", h.socialListHandler,
+		server.Doc{Tags: tagSocials, Summary: "List socials"})
+	endpoint(apiRouter, "/social/{id}", http.MethodGet, h.socialGetHandler,
+		server.Doc{Tags: tagSocials, Summary: "Get a social"})
 
 	jwtMiddleware := JWTMiddleware(db)
 	protectedapiRouter := apiRouter.Subrouter(server.Config[GenericHandlerFunc]{
 		PathPrefix: "/protected",
 		Middleware: []server.MiddlewareFunc{jwtMiddleware, JWTSubjectMiddleware},
+		Audience:   jwt.AudienceAPI,
+	})
+	// Narrow tokens for integrations only get the scopes they need
+	scoped := func(scopes ...string) server.Router[GenericHandlerFunc] {
+		return protectedapiRouter.Subrouter(server.Config[GenericHandlerFunc]{Scopes: scopes})
+	}
+
+	// Domains are curated so only moderators change them
+	domainRouter := protectedapiRouter.Subrouter(server.Config[GenericHandlerFunc]{
+		Middleware: []server.MiddlewareFunc{RequireRole(types.RoleModerator)},
+		Scopes:     []string{jwt.ScopeDomainWrite},
+	})
+	endpoint(domainRouter, "/domain", http.MethodPost, h.domainCreateHandler,
+		server.Doc{Tags: tagDomains, Summary: "Create a domain", Status: http.StatusCreated})
+	endpoint(domainRouter, "/domain/{id}", http.MethodPatch, updateHandler(h.db.UpdateDomain),
+		server.Doc{Tags: tagDomains, Summary: "Change a domain", Description: "Only the fields that are sent are changed."})
+	endpoint(domainRouter, "/domain/{id}", http.MethodDelete, idHandler(h.db.DeleteDomain),
+		server.Doc{Tags: tagDomains, Summary: "Delete a domain"})
+	endpoint(domainRouter, "/domain/{id}/restore", http.MethodPost, idHandler(h.db.RestoreDomain),
+		server.Doc{Tags: tagDomains, Summary: "Restore a deleted domain"})
+
+	domainLinkRouter := scoped(jwt.ScopeDomainLinkWrite)
+	endpoint(domainLinkRouter, "/domain_link", http.MethodPost, h.domainLinkCreateHandler,
+		server.Doc{Tags: tagDomainLinks, Summary: "Create a domain link", Status: http.StatusCreated})
+	endpoint(domainLinkRouter, "/domain_link/{id}", http.MethodPatch, updateHandler(h.db.UpdateDomainLink),
+		server.Doc{Tags: tagDomainLinks, Summary: "Change a domain link", Description: "Only the fields that are sent are changed."})
+	endpoint(domainLinkRouter, "/domain_link/{id}", http.MethodDelete, idHandler(h.db.DeleteDomainLink),
+		server.Doc{Tags: tagDomainLinks, Summary: "Delete a domain link"})
+	endpoint(domainLinkRouter, "/domain_link/{id}/restore", http.MethodPost, idHandler(h.db.RestoreDomainLink),
+		server.Doc{Tags: tagDomainLinks, Summary: "Restore a deleted domain link"})
+
+	userRouter := scoped(jwt.ScopeUserWrite)
+	endpoint(userRouter, "/user", http.MethodPost, h.userCreateHandler,
+		server.Doc{Tags: tagUsers, Summary: "Create a user", Status: http.StatusCreated})
+	endpoint(userRouter, "/user/{id}", http.MethodPatch, updateHandler(h.db.UpdateUser),
+		server.Doc{Tags: tagUsers, Summary: "Change a user", Description: "Only the fields that are sent are changed."})
+	endpoint(userRouter, "/user/{id}", http.MethodDelete, idHandler(h.db.DeleteUser),
+		server.Doc{Tags: tagUsers, Summary: "Delete a user"})
+	endpoint(userRouter, "/user/{id}/restore", http.MethodPost, idHandler(h.db.RestoreUser),
+		server.Doc{Tags: tagUsers, Summary: "Restore a deleted user"})
+
+	groupRouter := scoped(jwt.ScopeGroupWrite)
+	endpoint(groupRouter, "/group", http.MethodPost, h.groupCreateHandler,
+		server.Doc{Tags: tagGroups, Summary: "Create a group", Status: http.StatusCreated})
+	endpoint(groupRouter, "/group/{id}", http.MethodPatch, updateHandler(h.db.UpdateGroup),
+		server.Doc{Tags: tagGroups, Summary: "Change a group", Description: "Only the fields that are sent are changed."})
+	endpoint(groupRouter, "/group/{id}", http.MethodDelete, idHandler(h.db.DeleteGroup),
+		server.Doc{Tags: tagGroups, Summary: "Delete a group"})
+	endpoint(groupRouter, "/group/{id}/restore", http.MethodPost, idHandler(h.db.RestoreGroup),
+		server.Doc{Tags: tagGroups, Summary: "Restore a deleted group"})
+
+	socialRouter := scoped(jwt.ScopeSocialWrite)
+	endpoint(socialRouter, "/social", http.MethodPost, h.socialCreateHandler,
+		server.Doc{Tags: tagSocials, Summary: "Create a social", Status: http.StatusCreated})
+	endpoint(socialRouter, "/social/{id}", http.MethodPatch, updateHandler(h.db.UpdateSocial),
+		server.Doc{Tags: tagSocials, Summary: "Change a social", Description: "Only the fields that are sent are changed."})
+	endpoint(socialRouter, "/social/{id}", http.MethodDelete, idHandler(h.db.DeleteSocial),
+		server.Doc{Tags: tagSocials, Summary: "Delete a social"})
+	endpoint(socialRouter, "/social/{id}/restore", http.MethodPost, idHandler(h.db.RestoreSocial),
+		server.Doc{Tags: tagSocials, Summary: "Restore a deleted social"})
+
+	voteRouter := protectedapiRouter.Subrouter(server.Config[GenericHandlerFunc]{
+		Scopes:    []string{jwt.ScopeSocialVote},
+		RateLimit: h.rateLimit(voteRate, voteBurst),
+	})
+	endpoint(voteRouter, "/social/{id}/vote", http.MethodPut, h.socialVoteHandler,
+		server.Doc{Tags: tagSocials, Summary: "Vote on a social"})
+
+	accountRouter := scoped(jwt.ScopeAccount)
+	endpoint(accountRouter, "/password", http.MethodPut, h.passwordChangeHandler,
+		server.Doc{Tags: tagAccount, Summary: "Change your password"})
+	listEndpoint(accountRouter, "/sessions", h.sessionListHandler,
+		server.Doc{Tags: tagAccount, Summary: "List where you are logged in"})
+	endpoint(accountRouter, "/sessions", http.MethodDelete, h.sessionsDeleteHandler,
+		server.Doc{Tags: tagAccount, Summary: "Log out everywhere"})
+	endpoint(accountRouter, "/sessions/{id}", http.MethodDelete, idHandler(h.db.RevokeSession),
+		server.Doc{Tags: tagAccount, Summary: "Log out a session"})
+	listEndpoint(accountRouter, "/apikeys", h.apiKeyListHandler,
+		server.Doc{Tags: tagAccount, Summary: "List your API keys"})
+	endpoint(accountRouter, "/apikeys", http.MethodPost, h.apiKeyCreateHandler,
+		server.Doc{Tags: tagAccount, Summary: "Create an API key", Description: "The key is only returned once.", Status: http.StatusCreated})
+	endpoint(accountRouter, "/apikeys/{id}", http.MethodDelete, idHandler(h.db.DeleteAPIKey),
+		server.Doc{Tags: tagAccount, Summary: "Revoke an API key"})
+	listEndpoint(accountRouter, "/notifications", h.notificationListHandler,
+		server.Doc{Tags: tagAccount, Summary: "List your notifications"})
+	endpoint(accountRouter, "/notifications/{id}/read", http.MethodPost, idHandler(h.db.ReadNotification),
+		server.Doc{Tags: tagAccount, Summary: "Mark a notification read"})
+
+	moderationRouter := protectedapiRouter.Subrouter(server.Config[GenericHandlerFunc]{
+		PathPrefix: "/moderation",
+		Middleware: []server.MiddlewareFunc{RequireRole(types.RoleModerator)},
+		Scopes:     []string{jwt.ScopeModerate},
+	})
+	listEndpoint(moderationRouter, "/domain", h.pendingDomainListHandler,
+		server.Doc{Tags: tagModeration, Summary: "List domains waiting on moderation"})
+	endpoint(moderationRouter, "/domain/{id}/approve", http.MethodPost, idHandler(h.db.ApproveDomain),
+		server.Doc{Tags: tagModeration, Summary: "Approve a domain"})
+	endpoint(moderationRouter, "/domain/{id}/reject", http.MethodPost, updateHandler(h.db.RejectDomain),
+		server.Doc{Tags: tagModeration, Summary: "Reject a domain"})
+	listEndpoint(moderationRouter, "/domain_link", h.pendingDomainLinkListHandler,
+		server.Doc{Tags: tagModeration, Summary: "List domain links waiting on moderation"})
+	endpoint(moderationRouter, "/domain_link/{id}/approve", http.MethodPost, idHandler(h.db.ApproveDomainLink),
+		server.Doc{Tags: tagModeration, Summary: "Approve a domain link"})
+	endpoint(moderationRouter, "/domain_link/{id}/reject", http.MethodPost, updateHandler(h.db.RejectDomainLink),
+		server.Doc{Tags: tagModeration, Summary: "Reject a domain link"})
+
+	requestEndpoint(protectedapiRouter, "/logout", http.MethodPost, h.logoutHandler,
+		server.Doc{Tags: tagAuth, Summary: "Log out the token"})
+
+	adminRouter := protectedapiRouter.Subrouter(server.Config[GenericHandlerFunc]{
+		PathPrefix: "/admin",
+		Middleware: []server.MiddlewareFunc{RequireRole(types.RoleAdmin)},
+		Scopes:     []string{jwt.ScopeAdmin},
 	})
-	protectedapiRouter.Endpoint("/domain", http.MethodPost, h.domainCreateHandler, nil)
-	protectedapiRouter.Endpoint("/user", http.MethodPost, h.userCreateHandler, nil)
-	protectedapiRouter.Endpoint("/logout", http.MethodPost, h.logoutHandler, nil)
+	endpoint(adminRouter, "/user/{id}/role", http.MethodPut, h.roleSetHandler,
+		server.Doc{Tags: tagAdmin, Summary: "Change the role of a user"})
+	endpoint(adminRouter, "/user/{id}/role", http.MethodDelete, h.roleRevokeHandler,
+		server.Doc{Tags: tagAdmin, Summary: "Take away the role of a user", Description: "The reason is sent in the reason query parameter."})
+	listEndpoint(adminRouter, "/role_audits", h.roleAuditListHandler,
+		server.Doc{Tags: tagAdmin, Summary: "List role changes"})
+	endpoint(adminRouter, "/user/{id}/impersonate", http.MethodPost, h.impersonateHandler,
+		server.Doc{Tags: tagAdmin, Summary: "Get a short lived token to act as a user"})
+	listEndpoint(adminRouter, "/impersonations", h.impersonationListHandler,
+		server.Doc{Tags: tagAdmin, Summary: "List impersonation tokens"})
 
 	env := config.Get().Env
 	if env == "dev" {
@@ -83,19 +265,58 @@ func StartServer() error {
 		apiRouter.Subrouter(server.Config[GenericHandlerFunc]{
 			PathPrefix: "/test/auth",
 			Middleware: []server.MiddlewareFunc{jwtMiddleware},
-		}).Endpoint("", http.MethodGet, statusHandler, nil)
+		}).Endpoint("", http.MethodGet, func(r *http.Request) (data, meta any, status int, _ error) {
+			return nil, nil, http.StatusOK, nil
+		}, nil)
+
+	}
 
+	// Added last so the doc has every endpoint
+	if err := rootRouter.ServeDoc(ctx); err != nil {
+		return ctxerr.Wrap(ctx, err, "5be4ab3d-e1c6-44a0-8418-b9245f2b3cb1", "invalid openapi doc")
 	}
 
 	port := config.Get().Port()
-	s := rootRouter.NewServer(port, nil)
+	s := rootRouter.NewServer(port, &server.ServerConfig{AllowedOrigins: allowedOrigins(config.Get().AllowedOrigins)})
 	log.Printf("Starting '%s' server at http://localhost%s\n", env, port)
 	log.Fatal(s.ListenAndServe())
 	return nil
 }
 
-func statusHandler(r *http.Request) (data, meta any, status int, _ error) {
-	return nil, nil, http.StatusOK, nil
+// allowedOrigins reads the comma separated ALLOWED_ORIGINS
+func allowedOrigins(raw string) []string {
+	var origins []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSuffix(strings.TrimSpace(v), "/"); v != "" {
+			origins = append(origins, v)
+		}
+	}
+	return origins
+}
+
+func statusHandler(ctx context.Context, _ noBody) (noBody, any, error) {
+	return noBody{}, nil, nil
+}
+
+// jwksHandler publishes our public keys so other services can verify tokens.
+// It is not wrapped in Return because JWKS clients expect the bare key set.
+func jwksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	kr, err := jwt.DefaultKeyring()
+	if err != nil {
+		ctxerr.Handle(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := json.NewEncoder(w).Encode(kr.JWKS(time.Now())); err != nil {
+		ctxerr.Handle(ctxerr.Wrap(r.Context(), err, "60f1d133-a5ce-41e5-b5f7-a6326f5a969f", "writing jwks"))
+	}
 }
 
 func testErrorHandler(r *http.Request) (data, meta any, status int, _ error) {
@@ -118,58 +339,44 @@ func testCreateJWTHandler(r *http.Request) (data, meta any, status int, _ error)
 	return token, nil, http.StatusOK, nil
 }
 
-func (h *Handler) domainCreateHandler(r *http.Request) (data, meta any, status int, _ error) {
-	ctx := r.Context()
-	body := types.DomainCreate{}
-	err := validjson.UnmarshalReadCloser(ctx, r.Body, &body)
-	defer r.Body.Close()
-	if err != nil {
-		return nil, nil, http.StatusBadRequest, ctxerr.Wrap(ctx, err, "9ac2a9a9-a580-403d-8d27-c956664ea39b")
-	}
-
-	d, err := h.db.CreateDomain(ctx, body)
+func (h *Handler) domainCreateHandler(ctx context.Context, body types.DomainCreate) (uuid.UUID, any, error) {
+	id, err := h.db.CreateDomain(ctx, body)
 	if err != nil {
-		return nil, nil, http.StatusBadRequest, ctxerr.QuickWrap(ctx, err)
+		return uuid.Nil, nil, ctxerr.QuickWrap(ctx, err)
 	}
-
-	return d, nil, http.StatusOK, nil
+	setLocation(ctx, "/api/domain", id)
+	return id, nil, nil
 }
 
-func (h *Handler) userCreateHandler(r *http.Request) (data, meta any, status int, _ error) {
-	ctx := r.Context()
-	body := types.UserCreate{}
-	err := validjson.UnmarshalReadCloser(ctx, r.Body, &body)
-	defer r.Body.Close()
+func (h *Handler) userCreateHandler(ctx context.Context, body types.UserCreate) (uuid.UUID, any, error) {
+	id, err := h.db.CreateUser(ctx, body)
 	if err != nil {
-		return nil, nil, http.StatusBadRequest, ctxerr.Wrap(ctx, err, "36243519-91ef-470f-81e5-13173d29be87")
+		return uuid.Nil, nil, ctxerr.QuickWrap(ctx, err)
 	}
+	setLocation(ctx, "/api/user", id)
+	return id, nil, nil
+}
 
-	d, err := h.db.CreateUser(ctx, body)
+func (h *Handler) domainGetHandler(ctx context.Context, req idPath) (types.Domain, any, error) {
+	d, err := h.db.GetDomain(ctx, req.ID.String())
 	if err != nil {
-		return nil, nil, http.StatusBadRequest, ctxerr.QuickWrap(ctx, err)
+		return types.Domain{}, nil, ctxerr.QuickWrap(ctx, err)
 	}
-
-	return d, nil, http.StatusOK, nil
+	return d, nil, nil
 }
 
-func (h *Handler) domainListHandler(r *http.Request) (data, meta any, status int, _ error) {
-	ctx := r.Context()
-	list := types.DomainList{}
-	err := list.Fill(ctx, r.URL.Query())
+func (h *Handler) domainListHandler(ctx context.Context, list types.DomainList) ([]types.Domain, any, error) {
 	domains, pagination, err := h.db.ListDomains(ctx, list.Filters, list.Pagination)
 	if err != nil {
-		return nil, nil, http.StatusBadRequest, ctxerr.QuickWrap(ctx, err)
+		return nil, nil, ctxerr.QuickWrap(ctx, err)
 	}
-	return domains, pagination, http.StatusOK, nil
+	return domains, pagination, nil
 }
 
-func (h *Handler) userListHandler(r *http.Request) (data, meta any, status int, _ error) {
-	ctx := r.Context()
-	list := types.UserList{}
-	err := list.Fill(ctx, r.URL.Query())
+func (h *Handler) userListHandler(ctx context.Context, list types.UserList) ([]types.User, any, error) {
 	users, pagination, err := h.db.ListUsers(ctx, list.Filters, list.Pagination)
 	if err != nil {
-		return nil, nil, http.StatusBadRequest, ctxerr.QuickWrap(ctx, err)
+		return nil, nil, ctxerr.QuickWrap(ctx, err)
 	}
-	return users, pagination, http.StatusOK, nil
+	return users, pagination, nil
 }
@@ -0,0 +1,35 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/known-anywhere/internal/db"
+	"github.com/mvndaai/known-anywhere/internal/router/server"
+	"github.com/mvndaai/known-anywhere/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserCreateLocation(t *testing.T) {
+	if ok, _ := strconv.ParseBool(os.Getenv("DB_TESTS")); !ok {
+		t.Skip("DB_TESTS is not true")
+	}
+	ctx := context.Background()
+	d, err := db.New(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() { d.Close(ctx) })
+	require.NoError(t, d.MigrateUp(ctx))
+	h := &Handler{db: d}
+
+	header := http.Header{}
+	ctx = server.ContextWithResponseHeader(ctx, header)
+	username := "test" + uuid.NewString()[:8]
+	id, _, err := h.userCreateHandler(ctx, types.UserCreate{Username: username, DisplayName: username})
+	require.NoError(t, err)
+	assert.Equal(t, "/api/user/"+id.String(), header.Get("Location"))
+}
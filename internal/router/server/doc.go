@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"sync"
+
+	"github.com/oasdiff/yaml"
+)
+
+const (
+	DocJSONPath = "/openapi.json"
+	DocYAMLPath = "/openapi.yaml"
+	DocUIPath   = "/docs"
+)
+
+var docUI = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>{{.Title}}</title>
+	<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+	<script>
+		window.onload = () => {
+			window.ui = SwaggerUIBundle({url: {{.URL}}, dom_id: "#swagger-ui"});
+		};
+	</script>
+</body>
+</html>
+`))
+
+// ServeDoc validates the OpenAPI document and serves it as JSON and YAML with
+// a Swagger UI page. Call it after every endpoint is added so a broken doc
+// fails on start.
+func (rr *rootrouter[T]) ServeDoc(ctx context.Context) error {
+	if err := rr.doc.Validate(ctx); err != nil {
+		return fmt.Errorf("invalid openapi doc: %w", err)
+	}
+
+	docJSON := sync.OnceValues(func() ([]byte, error) { return json.Marshal(rr.doc) })
+	docYAML := sync.OnceValues(func() ([]byte, error) { return yaml.Marshal(rr.doc) })
+	rr.Handle(DocJSONPath, docHandler("application/json", docJSON))
+	rr.Handle(DocYAMLPath, docHandler("application/yaml", docYAML))
+
+	var ui bytes.Buffer
+	err := docUI.Execute(&ui, struct{ Title, URL string }{
+		Title: rr.doc.Info.Title,
+		URL:   path.Join(rr.pathPrefix, DocJSONPath),
+	})
+	if err != nil {
+		return fmt.Errorf("doc ui: %w", err)
+	}
+	rr.Handle(DocUIPath, docHandler("text/html; charset=utf-8", func() ([]byte, error) { return ui.Bytes(), nil }))
+	return nil
+}
+
+// docHandler marshals the doc on the first request, endpoints are all added by then
+func docHandler(contentType string, marshal func() ([]byte, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := marshal()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write(b)
+	})
+}
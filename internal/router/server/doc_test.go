@@ -0,0 +1,79 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/mvndaai/known-anywhere/internal/router/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeDoc(t *testing.T) {
+	rr, err := server.New(server.Config[GenericHandlerFunc]{
+		PathPrefix:    "/root",
+		GenericToHTTP: GenericToHTTP,
+	}, server.DocConfig{
+		ServiceName: "test",
+		Description: "test",
+		Version:     "v0.0.1",
+	})
+	require.NoError(t, err)
+
+	end := func(r *http.Request) (data, meta any, status int, _ error) { return }
+	rr.Endpoint("/item/{id}", http.MethodGet, end, func() (*openapi3.Operation, error) {
+		op := openapi3.NewOperation()
+		op.Summary = "get item"
+		op.AddResponse(http.StatusOK, openapi3.NewResponse().WithDescription("ok"))
+		return op, nil
+	})
+	require.NoError(t, rr.ServeDoc(context.Background()))
+	h := rr.NewServer(":0", nil).Handler
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, http.NoBody))
+		return w
+	}
+
+	w := get("/root/openapi.json")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var doc openapi3.T
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	if op := doc.Paths.Value("/root/item/{id}").Get; assert.NotNil(t, op) {
+		assert.Equal(t, "get item", op.Summary)
+	}
+
+	w = get("/root/openapi.yaml")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/yaml", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "openapi: 3.0.3")
+	assert.Contains(t, w.Body.String(), "summary: get item")
+
+	w = get("/root/docs")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), `url: "/root/openapi.json"`)
+}
+
+func TestServeDocInvalid(t *testing.T) {
+	rr, err := server.New(server.Config[GenericHandlerFunc]{
+		PathPrefix:    "/root",
+		GenericToHTTP: GenericToHTTP,
+	}, server.DocConfig{
+		ServiceName: "test",
+		Description: "test",
+		Version:     "v0.0.1",
+	})
+	require.NoError(t, err)
+
+	// Operations need responses
+	rr.Endpoint("/item", http.MethodGet, func(r *http.Request) (data, meta any, status int, _ error) { return },
+		func() (*openapi3.Operation, error) { return openapi3.NewOperation(), nil })
+	assert.Error(t, rr.ServeDoc(context.Background()))
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3gen"
+	"github.com/google/uuid"
+)
+
+// NoBody is used for Req or Resp when an endpoint has no request body or
+// response, fields of this type are left out of schemas
+type NoBody struct{}
+
+// Doc describes an endpoint, the schemas come from the types given to
+// BodyDoc or QueryDoc
+type Doc struct {
+	Summary     string
+	Description string
+	Tags        []string
+	// Status of a successful response, it defaults to 200
+	Status int
+}
+
+var (
+	noBodyType        = reflect.TypeOf(NoBody{})
+	uuidType          = reflect.TypeOf(uuid.UUID{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// BodyDoc documents an endpoint that reads Req, or its field tagged
+// `body:""`, from a JSON body and responds with Resp. An object without
+// fields, like a request of only path parameters, has no body.
+func BodyDoc[Req, Resp any](d Doc) DocFunc {
+	return func() (*openapi3.Operation, error) {
+		op, err := operation[Resp](d)
+		if err != nil {
+			return nil, err
+		}
+		req, err := Schema[Req]()
+		if f, ok := bodyField(reflect.TypeFor[Req]()); ok {
+			req, err = schemaOf(f.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("request schema: %w", err)
+		}
+		// Requests of only path parameters have nothing to send
+		empty := req != nil && len(req.Value.Properties) == 0 && (req.Value.Type == nil || req.Value.Type.Is(openapi3.TypeObject))
+		if req != nil && !empty {
+			op.RequestBody = &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().WithRequired(true).WithJSONSchemaRef(req)}
+		}
+		return op, nil
+	}
+}
+
+// QueryDoc documents an endpoint that reads the fields of Req from query
+// parameters and responds with Resp. Nested structs, like pagination and
+// filters, are flattened into their fields.
+func QueryDoc[Req, Resp any](d Doc) DocFunc {
+	return func() (*openapi3.Operation, error) {
+		op, err := operation[Resp](d)
+		if err != nil {
+			return nil, err
+		}
+		params, err := QueryParameters[Req]()
+		if err != nil {
+			return nil, err
+		}
+		op.Parameters = append(op.Parameters, params...)
+		return op, nil
+	}
+}
+
+func operation[Resp any](d Doc) (*openapi3.Operation, error) {
+	op := openapi3.NewOperation()
+	op.Summary = d.Summary
+	op.Description = d.Description
+	op.Tags = d.Tags
+
+	status := d.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	resp, err := Schema[Resp]()
+	if err != nil {
+		return nil, fmt.Errorf("response schema: %w", err)
+	}
+	r := openapi3.NewResponse().WithDescription(http.StatusText(status))
+	if resp != nil {
+		r = r.WithJSONSchemaRef(resp)
+	}
+	op.Responses = openapi3.NewResponsesWithCapacity(2)
+	op.AddResponse(status, r)
+	return op, nil
+}
+
+// Schema describes the JSON of T from its json tags. Fields tagged `doc:"-"`
+// are left out and a nil schema is returned for NoBody.
+func Schema[T any]() (*openapi3.SchemaRef, error) {
+	return schemaOf(reflect.TypeFor[T]())
+}
+
+func schemaOf(t reflect.Type) (*openapi3.SchemaRef, error) {
+	return openapi3gen.NewSchemaRefForValue(reflect.New(t).Interface(), nil, openapi3gen.SchemaCustomizer(customizeSchema))
+}
+
+// QueryParameters are the fields of T as query parameters
+func QueryParameters[T any]() (openapi3.Parameters, error) {
+	s, err := Schema[T]()
+	if err != nil {
+		return nil, fmt.Errorf("query schema: %w", err)
+	}
+	return queryParameters(s), nil
+}
+
+func queryParameters(s *openapi3.SchemaRef) openapi3.Parameters {
+	if s == nil || s.Value == nil {
+		return nil
+	}
+	var params openapi3.Parameters
+	for _, name := range slices.Sorted(maps.Keys(s.Value.Properties)) {
+		p := s.Value.Properties[name]
+		if p.Value.Type.Is(openapi3.TypeObject) {
+			params = append(params, queryParameters(p)...)
+			continue
+		}
+		params = append(params, &openapi3.ParameterRef{Value: openapi3.NewQueryParameter(name).WithSchema(p.Value)})
+	}
+	return params
+}
+
+// customizeSchema fixes types that marshal as strings and leaves out what
+// clients never send or get
+func customizeSchema(_ string, t reflect.Type, tag reflect.StructTag, schema *openapi3.Schema) error {
+	if t == noBodyType || tag.Get("doc") == "-" {
+		return &openapi3gen.ExcludeSchemaSentinel{}
+	}
+	switch {
+	case t == uuidType:
+		schema.Type = &openapi3.Types{openapi3.TypeString}
+		schema.Format = "uuid"
+	case schema.Type == nil && reflect.PointerTo(t).Implements(textMarshalerType):
+		schema.Type = &openapi3.Types{openapi3.TypeString}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/google/uuid"
+	"github.com/mvndaai/known-anywhere/internal/router/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	docCreate struct {
+		Name   string     `json:"name"`
+		Parent *uuid.UUID `json:"parent"`
+	}
+
+	docItem struct {
+		ID uuid.UUID `json:"id"`
+		docCreate
+		Created  time.Time `json:"created"`
+		internal string
+	}
+
+	docPagination struct {
+		Limit       int    `json:"limit"`
+		Cursor      string `json:"cursor"`
+		ShowDeleted bool   `json:"show_deleted" doc:"-"`
+	}
+
+	docList struct {
+		Pagination docPagination `json:"pagination"`
+		Filters    docCreate     `json:"filters"`
+		Sort       string        `json:"sort"`
+	}
+
+	docEnvelope[D any] struct {
+		Data D             `json:"data"`
+		Meta server.NoBody `json:"meta"`
+	}
+)
+
+func TestSchema(t *testing.T) {
+	s, err := server.Schema[docItem]()
+	require.NoError(t, err)
+	b, err := json.Marshal(s)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"id": {"type": "string", "format": "uuid"},
+			"name": {"type": "string"},
+			"parent": {"type": "string", "format": "uuid", "nullable": true},
+			"created": {"type": "string", "format": "date-time"}
+		}
+	}`, string(b))
+
+	s, err = server.Schema[server.NoBody]()
+	require.NoError(t, err)
+	assert.Nil(t, s)
+
+	s, err = server.Schema[docEnvelope[[]docItem]]()
+	require.NoError(t, err)
+	assert.Contains(t, s.Value.Properties, "data")
+	assert.NotContains(t, s.Value.Properties, "meta")
+	assert.True(t, s.Value.Properties["data"].Value.Type.Is(openapi3.TypeArray))
+}
+
+func TestQueryParameters(t *testing.T) {
+	params, err := server.QueryParameters[docList]()
+	require.NoError(t, err)
+	var names []string
+	for _, p := range params {
+		assert.Equal(t, openapi3.ParameterInQuery, p.Value.In)
+		names = append(names, p.Value.Name)
+	}
+	assert.Equal(t, []string{"name", "parent", "cursor", "limit", "sort"}, names)
+	assert.Equal(t, "uuid", params.GetByInAndName(openapi3.ParameterInQuery, "parent").Schema.Value.Format)
+}
+
+func TestBodyDoc(t *testing.T) {
+	op, err := server.BodyDoc[docCreate, docEnvelope[docItem]](server.Doc{Summary: "create", Status: http.StatusCreated})()
+	require.NoError(t, err)
+	assert.Equal(t, "create", op.Summary)
+	if assert.NotNil(t, op.RequestBody) {
+		assert.Contains(t, op.RequestBody.Value.Content.Get("application/json").Schema.Value.Properties, "name")
+	}
+	if r := op.Responses.Status(http.StatusCreated); assert.NotNil(t, r) {
+		assert.Contains(t, r.Value.Content.Get("application/json").Schema.Value.Properties, "data")
+	}
+	assert.Nil(t, op.Responses.Status(http.StatusOK))
+
+	op, err = server.BodyDoc[server.NoBody, server.NoBody](server.Doc{})()
+	require.NoError(t, err)
+	assert.Nil(t, op.RequestBody)
+	if r := op.Responses.Status(http.StatusOK); assert.NotNil(t, r) {
+		assert.Nil(t, r.Value.Content)
+	}
+
+	// Only path parameters is not a body
+	op, err = server.BodyDoc[struct {
+		ID string `path:"id" json:"-"`
+	}, server.NoBody](server.Doc{})()
+	require.NoError(t, err)
+	assert.Nil(t, op.RequestBody)
+}
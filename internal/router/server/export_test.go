@@ -0,0 +1,24 @@
+package server
+
+import "time"
+
+// RateLimitMiddleware is the rate limit middleware with a clock the test
+// controls
+func RateLimitMiddleware(rl RateLimit, now func() time.Time) MiddlewareFunc {
+	l := newLimiter(rl)
+	l.now = now
+	return l.middleware
+}
+
+// RateLimitMiddlewareMaxBuckets is RateLimitMiddleware with fewer buckets, it
+// also returns how many buckets there are
+func RateLimitMiddlewareMaxBuckets(rl RateLimit, now func() time.Time, maxBuckets int) (MiddlewareFunc, func() int) {
+	l := newLimiter(rl)
+	l.now = now
+	l.maxBuckets = maxBuckets
+	return l.middleware, func() int {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return len(l.buckets)
+	}
+}
@@ -61,6 +61,13 @@ func LogHeadersAndParams(l http.HandlerFunc) http.HandlerFunc {
 			clearDuplicates(headers)
 			ctx = ctxerr.SetField(ctx, "headers", headers)
 		}
+		if names, _ := pathParameters(req.Pattern); len(names) > 0 {
+			pathParams := map[string]string{}
+			for _, name := range names {
+				pathParams[name] = req.PathValue(name)
+			}
+			ctx = ctxerr.SetField(ctx, "path_parameters", pathParams)
+		}
 		if len(req.URL.Query()) > 0 {
 			q := req.URL.Query()
 			clearDuplicates(q)
@@ -2,15 +2,18 @@ package server
 
 import (
 	"net/http"
+	"slices"
 	"sync"
 )
 
 type methodHandler struct {
-	handlers map[string]http.HandlerFunc
-	mu       sync.RWMutex
+	handlers       map[string]http.HandlerFunc
+	allowedHeaders []string
+	mu             sync.RWMutex
 }
 
-// New type to encapsulate route handling
+// New type to encapsulate route handling. Routes are keyed by their pattern,
+// matching paths and path parameters is done by http.ServeMux in NewServer.
 type routeMux struct {
 	routes map[string]*methodHandler
 	mu     sync.RWMutex
@@ -35,7 +38,7 @@ func (rm *routeMux) getHandler(path, method string) (http.HandlerFunc, bool) {
 	return nil, false
 }
 
-func (rm *routeMux) addHandler(path, method string, handler http.HandlerFunc) {
+func (rm *routeMux) addHandler(path, method string, handler http.HandlerFunc, allowedHeaders ...string) {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 
@@ -45,9 +48,27 @@ func (rm *routeMux) addHandler(path, method string, handler http.HandlerFunc) {
 		}
 	}
 
-	rm.routes[path].mu.Lock()
-	rm.routes[path].handlers[method] = handler
-	rm.routes[path].mu.Unlock()
+	mh := rm.routes[path]
+	mh.mu.Lock()
+	mh.handlers[method] = handler
+	for _, h := range allowedHeaders {
+		if !slices.Contains(mh.allowedHeaders, h) {
+			mh.allowedHeaders = append(mh.allowedHeaders, h)
+		}
+	}
+	mh.mu.Unlock()
+}
+
+func (rm *routeMux) getAllowedHeaders(path string) []string {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	if mh, exists := rm.routes[path]; exists {
+		mh.mu.RLock()
+		defer mh.mu.RUnlock()
+		return slices.Clone(mh.allowedHeaders)
+	}
+	return nil
 }
 
 func (rm *routeMux) getMethods(path string) []string {
@@ -62,6 +83,7 @@ func (rm *routeMux) getMethods(path string) []string {
 		for method := range mh.handlers {
 			methods = append(methods, method)
 		}
+		slices.Sort(methods)
 		return methods
 	}
 	return nil
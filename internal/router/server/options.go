@@ -2,27 +2,48 @@ package server
 
 import (
 	"net/http"
+	"slices"
 	"strings"
 )
 
-func optionsHandler(methods []string, extraAllowedHeaders []string) http.HandlerFunc {
-	methodString := strings.Join(methods, ",") + ",OPTIONS"
+func optionsHandler(methods []string, extraAllowedHeaders []string, allowedOrigins []string) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setCORSHeaders(w, r, methods, extraAllowedHeaders, allowedOrigins)
+		w.Header().Add("Content-Type", "application/json")
+		w.Header().Add("Access-Control-Max-Age", "600")
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// setCORSHeaders adds the headers browsers need for both preflight and actual
+// requests. Credentials are allowed so only origins in allowedOrigins are
+// allowed, other origins are left to the same origin policy.
+func setCORSHeaders(w http.ResponseWriter, r *http.Request, methods []string, extraAllowedHeaders []string, allowedOrigins []string) {
 	accessControlAllowHeaders := "Content-Type,Cache-Control,Authorization,X-Amz-Date,X-Api-Key,X-Amz-Security-Token,X-Requested-With"
 	if len(extraAllowedHeaders) > 0 {
 		accessControlAllowHeaders += "," + strings.Join(extraAllowedHeaders, ",")
 	}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-		if origin == "" {
-			origin = "*"
+	w.Header().Add("Access-Control-Allow-Headers", accessControlAllowHeaders)
+	w.Header().Add("Access-Control-Allow-Methods", allowedMethods(methods))
+	w.Header().Add("Vary", "Origin")
+	origin := r.Header.Get("Origin")
+	if origin == "" || !slices.Contains(allowedOrigins, origin) {
+		return
+	}
+	w.Header().Add("Access-Control-Allow-Origin", origin)
+	w.Header().Add("Access-Control-Allow-Credentials", "true")
+}
+
+// allowedMethods lists the methods of a route including OPTIONS, leaving out
+// the empty method used for handlers that accept any method
+func allowedMethods(methods []string) string {
+	ms := []string{http.MethodOptions}
+	for _, m := range methods {
+		if m != "" && m != http.MethodOptions {
+			ms = append(ms, m)
 		}
-		w.Header().Add("Access-Control-Allow-Headers", accessControlAllowHeaders)
-		w.Header().Add("Access-Control-Allow-Methods", methodString)
-		w.Header().Add("Access-Control-Allow-Origin", origin)
-		w.Header().Add("Access-Control-Allow-Credentials", "true")
-		w.Header().Add("Content-Type", "application/json")
-		w.Header().Add("Access-Control-Max-Age", "600")
-		w.WriteHeader(http.StatusOK)
-	})
+	}
+	slices.Sort(ms)
+	return strings.Join(ms, ",")
 }
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"container/list"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token bucket per key. Each key can make Burst requests at
+// once and gets Rate more every second.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+	// Key picks the bucket of a request, it defaults to ClientKey
+	Key func(r *http.Request) string
+	// TrustedProxies are where X-Forwarded-For is believed from
+	TrustedProxies []netip.Prefix
+	// Limited writes the response when there are no tokens left, the rate
+	// limit headers are already set
+	Limited http.HandlerFunc
+}
+
+// bucketSweepInterval is how often refilled buckets are dropped, a full bucket
+// is the same as a new one
+const bucketSweepInterval = time.Minute
+
+// maxBuckets bounds memory when many keys are used at once, the least recently
+// used bucket is dropped for a new one
+const maxBuckets = 100_000
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+type limiter struct {
+	RateLimit
+	now        func() time.Time
+	maxBuckets int
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	// recent has the buckets from the most to the least recently used
+	recent    *list.List
+	lastSweep time.Time
+}
+
+func newLimiter(rl RateLimit) *limiter {
+	if rl.Key == nil {
+		trusted := rl.TrustedProxies
+		rl.Key = func(r *http.Request) string { return ClientKey(r, trusted) }
+	}
+	if rl.Limited == nil {
+		rl.Limited = func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		}
+	}
+	if rl.Burst < 1 {
+		rl.Burst = 1
+	}
+	return &limiter{RateLimit: rl, now: time.Now, maxBuckets: maxBuckets, buckets: map[string]*list.Element{}, recent: list.New()}
+}
+
+// take uses a token of the key. It returns the tokens left, how long until
+// the bucket is full and how long until the next token when it is empty.
+func (l *limiter) take(key string) (ok bool, remaining int, reset, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	burst := float64(l.Burst)
+	e, found := l.buckets[key]
+	if found {
+		l.recent.MoveToFront(e)
+	} else {
+		if len(l.buckets) >= l.maxBuckets {
+			l.remove(l.recent.Back())
+		}
+		e = l.recent.PushFront(&bucket{key: key, tokens: burst, last: now})
+		l.buckets[key] = e
+	}
+	b := e.Value.(*bucket)
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		ok = true
+	} else if l.Rate > 0 {
+		retryAfter = secondsToDuration((1 - b.tokens) / l.Rate)
+	} else {
+		retryAfter = time.Duration(math.MaxInt64)
+	}
+	if l.Rate > 0 {
+		reset = secondsToDuration((burst - b.tokens) / l.Rate)
+	}
+	return ok, int(b.tokens), reset, retryAfter
+}
+
+// sweep drops buckets that have refilled so memory follows active clients
+func (l *limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketSweepInterval || l.Rate <= 0 {
+		return
+	}
+	l.lastSweep = now
+	burst := float64(l.Burst)
+	for _, e := range l.buckets {
+		b := e.Value.(*bucket)
+		if b.tokens+now.Sub(b.last).Seconds()*l.Rate >= burst {
+			l.remove(e)
+		}
+	}
+}
+
+func (l *limiter) remove(e *list.Element) {
+	l.recent.Remove(e)
+	delete(l.buckets, e.Value.(*bucket).key)
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+// ceilSeconds rounds up so clients never retry too early
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+func (l *limiter) middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, remaining, reset, retryAfter := l.take(l.Key(r))
+
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(l.Burst))
+		h.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		h.Set("RateLimit-Reset", ceilSeconds(reset))
+		if !ok {
+			h.Set("Retry-After", ceilSeconds(retryAfter))
+			l.Limited(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// ClientIP is the address of the client. X-Forwarded-For is only used when
+// the request came from a trusted proxy, it is read from the right skipping
+// trusted proxies so clients cannot pick their own address.
+func ClientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !trusted(addr, trustedProxies) {
+		return host
+	}
+
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !trusted(addr, trustedProxies) {
+			break
+		}
+	}
+	return addr.String()
+}
+
+// ClientKey is ClientIP for rate limits. IPv6 clients are limited by their /64
+// since they usually get a whole /64 to pick addresses from.
+func ClientKey(r *http.Request, trustedProxies []netip.Prefix) string {
+	ip := ClientIP(r, trustedProxies)
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	if addr = addr.Unmap(); addr.Is4() {
+		return addr.String()
+	}
+	return netip.PrefixFrom(addr.WithZone(""), 64).Masked().String()
+}
+
+func trusted(addr netip.Addr, prefixes []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
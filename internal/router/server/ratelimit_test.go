@@ -0,0 +1,199 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/mvndaai/known-anywhere/internal/router/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := server.RateLimitMiddleware(server.RateLimit{Rate: 0.5, Burst: 2}, func() time.Time { return now })
+	h := m(func(w http.ResponseWriter, r *http.Request) {})
+
+	do := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("10.0.0.1:1000")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Reset"))
+
+	w = do("10.0.0.1:1001")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "4", w.Header().Get("RateLimit-Reset"))
+
+	w = do("10.0.0.1:1002")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	// Other clients have their own bucket
+	w = do("10.0.0.2:1000")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	now = now.Add(time.Second)
+	w = do("10.0.0.1:1000")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	now = now.Add(time.Second)
+	w = do("10.0.0.1:1000")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	// Buckets that refilled are swept and start full again
+	now = now.Add(time.Hour)
+	w = do("10.0.0.1:1000")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+}
+
+func TestRateLimitKeyAndLimited(t *testing.T) {
+	now := time.Now()
+	rl := server.RateLimit{
+		Burst: 1,
+		Key:   func(r *http.Request) string { return r.Header.Get("User") },
+		Limited: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+	}
+	h := server.RateLimitMiddleware(rl, func() time.Time { return now })(func(w http.ResponseWriter, r *http.Request) {})
+
+	do := func(user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		req.Header.Set("User", user)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusOK, do("a").Code)
+	assert.Equal(t, http.StatusOK, do("b").Code)
+	w := do("a")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
+
+func TestRateLimitSubrouter(t *testing.T) {
+	rr, err := server.New(server.Config[GenericHandlerFunc]{
+		PathPrefix:    "/root",
+		GenericToHTTP: GenericToHTTP,
+	}, server.DocConfig{
+		ServiceName: "test",
+		Description: "test",
+		Version:     "v0.0.1",
+	})
+	require.NoError(t, err)
+
+	end := func(r *http.Request) (data, meta any, status int, _ error) { return }
+	rr.Endpoint("/open", http.MethodGet, end, nil)
+	limited := rr.Subrouter(server.Config[GenericHandlerFunc]{PathPrefix: "/limited", RateLimit: &server.RateLimit{Burst: 1}})
+	limited.Endpoint("/a", http.MethodGet, end, nil)
+	limited.Endpoint("/b", http.MethodGet, end, nil)
+	h := rr.NewServer(":0", nil).Handler
+
+	do := func(path string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, http.NoBody))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, do("/root/limited/a"))
+	// Endpoints of a router share the bucket
+	assert.Equal(t, http.StatusTooManyRequests, do("/root/limited/b"))
+	assert.Equal(t, http.StatusOK, do("/root/open"))
+	assert.Equal(t, http.StatusOK, do("/root/open"))
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("fd00::/8")}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		{name: "direct", remoteAddr: "1.2.3.4:5678", expected: "1.2.3.4"},
+		{name: "untrusted proxy", remoteAddr: "1.2.3.4:5678", forwarded: []string{"5.6.7.8"}, expected: "1.2.3.4"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.1:5678", forwarded: []string{"5.6.7.8"}, expected: "5.6.7.8"},
+		{name: "spoofed left", remoteAddr: "10.0.0.1:5678", forwarded: []string{"9.9.9.9, 5.6.7.8"}, expected: "5.6.7.8"},
+		{name: "proxy chain", remoteAddr: "10.0.0.1:5678", forwarded: []string{"5.6.7.8, 10.0.0.2", "10.0.0.3"}, expected: "5.6.7.8"},
+		{name: "only proxies", remoteAddr: "10.0.0.1:5678", forwarded: []string{"10.0.0.2"}, expected: "10.0.0.2"},
+		{name: "invalid hop", remoteAddr: "10.0.0.1:5678", forwarded: []string{"5.6.7.8, nope"}, expected: "10.0.0.1"},
+		{name: "no header", remoteAddr: "10.0.0.1:5678", expected: "10.0.0.1"},
+		{name: "ipv6", remoteAddr: "[fd00::1]:5678", forwarded: []string{"2001:db8::1"}, expected: "2001:db8::1"},
+		{name: "mapped ipv4", remoteAddr: "[::ffff:10.0.0.1]:5678", forwarded: []string{"5.6.7.8"}, expected: "5.6.7.8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			assert.Equal(t, tt.expected, server.ClientIP(req, trusted))
+		})
+	}
+}
+
+func TestRateLimitMaxBuckets(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m, buckets := server.RateLimitMiddlewareMaxBuckets(server.RateLimit{Rate: 0.5, Burst: 1}, func() time.Time { return now }, 2)
+	h := m(func(w http.ResponseWriter, r *http.Request) {})
+
+	do := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, do("10.0.0.1:1000"))
+	assert.Equal(t, http.StatusOK, do("10.0.0.2:1000"))
+	// 10.0.0.1 is used again so 10.0.0.2 is the least recent
+	assert.Equal(t, http.StatusTooManyRequests, do("10.0.0.1:1000"))
+	assert.Equal(t, http.StatusOK, do("10.0.0.3:1000"))
+	assert.Equal(t, 2, buckets())
+
+	assert.Equal(t, http.StatusTooManyRequests, do("10.0.0.1:1000"), "recently used bucket was dropped")
+	assert.Equal(t, http.StatusOK, do("10.0.0.2:1000"), "dropped bucket did not start full")
+	assert.Equal(t, 2, buckets())
+}
+
+func TestClientKey(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		{name: "ipv4", remoteAddr: "1.2.3.4:5678", expected: "1.2.3.4"},
+		{name: "ipv6", remoteAddr: "[2001:db8:1:2:3:4:5:6]:5678", expected: "2001:db8:1:2::/64"},
+		{name: "same ipv6 /64", remoteAddr: "[2001:db8:1:2:ffff::1]:5678", expected: "2001:db8:1:2::/64"},
+		{name: "forwarded ipv6", remoteAddr: "10.0.0.1:5678", forwarded: []string{"2001:db8::1"}, expected: "2001:db8::/64"},
+		{name: "mapped ipv4", remoteAddr: "[::ffff:1.2.3.4]:5678", expected: "1.2.3.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			assert.Equal(t, tt.expected, server.ClientKey(req, trusted))
+		})
+	}
+}
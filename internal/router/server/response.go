@@ -0,0 +1,22 @@
+package server
+
+import (
+	"context"
+	"net/http"
+)
+
+type responseHeaderContextKey struct{}
+
+// ContextWithResponseHeader lets handlers that only get the request set
+// headers of the response with SetResponseHeader
+func ContextWithResponseHeader(ctx context.Context, h http.Header) context.Context {
+	return context.WithValue(ctx, responseHeaderContextKey{}, h)
+}
+
+// SetResponseHeader sets a header of the response, like Location on a create
+// or Retry-After. It does nothing when the context has no response headers.
+func SetResponseHeader(ctx context.Context, key, value string) {
+	if h, ok := ctx.Value(responseHeaderContextKey{}).(http.Header); ok {
+		h.Set(key, value)
+	}
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"context"
+	"net/http"
+)
+
+type routeInfoContextKey struct{}
+
+// RouteInfo describes the endpoint that matched a request so middleware can
+// check things like the audience and scopes it requires
+type RouteInfo struct {
+	Pattern  string
+	Method   string
+	Audience string
+	Scopes   []string
+}
+
+func contextWithRouteInfo(ctx context.Context, ri RouteInfo) context.Context {
+	return context.WithValue(ctx, routeInfoContextKey{}, ri)
+}
+
+// RouteInfoFromContext gets the info of the endpoint handling the request
+func RouteInfoFromContext(ctx context.Context) (RouteInfo, bool) {
+	ri, ok := ctx.Value(routeInfoContextKey{}).(RouteInfo)
+	return ri, ok
+}
+
+func withRouteInfo(ri RouteInfo, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(contextWithRouteInfo(r.Context(), ri)))
+	}
+}
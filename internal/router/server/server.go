@@ -1,9 +1,12 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"path"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
@@ -27,6 +30,8 @@ type RootRouter[T any] interface {
 	Router[T]
 	NewServer(port string, sc *ServerConfig) *http.Server
 	ListRoutes() map[string][]string
+	Doc() *openapi3.T
+	ServeDoc(ctx context.Context) error
 }
 
 type router[T any] struct {
@@ -39,6 +44,9 @@ type router[T any] struct {
 	defaultParameters     openapi3.Parameters
 	allowedOptionsHeaders []string
 	genericToHTTP         func(T) http.HandlerFunc
+	audience              string
+	scopes                []string
+	requestValidation     *RequestValidation
 }
 
 type rootrouter[T any] struct {
@@ -52,6 +60,17 @@ type Config[T any] struct {
 	DefaultParameters     openapi3.Parameters
 	AllowedOptionsHeaders []string
 	GenericToHTTP         func(T) http.HandlerFunc
+	// Audience that tokens must be issued for, subrouters inherit it unless
+	// they set their own
+	Audience string
+	// Scopes a token needs, subrouters add to the scopes of their parent
+	Scopes []string
+	// RateLimit runs after Middleware so it can key on what they set. Every
+	// endpoint of the router shares the buckets.
+	RateLimit *RateLimit
+	// RequestValidation runs right before the handler, subrouters inherit it
+	// unless they set their own
+	RequestValidation *RequestValidation
 }
 
 type DocConfig struct {
@@ -78,6 +97,9 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
+	// AllowedOrigins are the origins, like https://example.com, that get CORS
+	// headers. Without any only same origin requests work from browsers.
+	AllowedOrigins []string
 }
 
 func New[T any](rc Config[T], dc DocConfig) (RootRouter[T], error) {
@@ -92,7 +114,8 @@ func New[T any](rc Config[T], dc DocConfig) (RootRouter[T], error) {
 			Description: dc.Description,
 			Version:     dc.Version,
 		},
-		Tags: dc.Tags,
+		Tags:  dc.Tags,
+		Paths: openapi3.NewPaths(),
 	}
 
 	if rc.GenericToHTTP == nil {
@@ -105,11 +128,14 @@ func New[T any](rc Config[T], dc DocConfig) (RootRouter[T], error) {
 				routeMux:              newRouteMux(),
 				doc:                   docBase,
 				pathPrefix:            rc.PathPrefix,
-				middleware:            append(defaultMiddleware, rc.Middleware...),
+				middleware:            withRateLimit(slices.Concat(defaultMiddleware, rc.Middleware), rc.RateLimit),
 				genericMiddleware:     rc.GenericMiddleware,
 				defaultParameters:     rc.DefaultParameters,
 				allowedOptionsHeaders: rc.AllowedOptionsHeaders,
 				genericToHTTP:         rc.GenericToHTTP,
+				audience:              rc.Audience,
+				scopes:                rc.Scopes,
+				requestValidation:     rc.RequestValidation,
 			},
 		}, nil
 	}
@@ -121,11 +147,20 @@ func (r *router[T]) Subrouter(rc Config[T]) Router[T] {
 		routeMux:              r.routeMux, // Share the same routeMux
 		doc:                   r.doc,
 		pathPrefix:            path.Join(r.pathPrefix, rc.PathPrefix),
-		middleware:            append(r.middleware, rc.Middleware...),
+		middleware:            withRateLimit(slices.Concat(r.middleware, rc.Middleware), rc.RateLimit),
 		defaultParameters:     append(r.defaultParameters, rc.DefaultParameters...),
 		allowedOptionsHeaders: append(r.allowedOptionsHeaders, rc.AllowedOptionsHeaders...),
 		genericMiddleware:     append(r.genericMiddleware, rc.GenericMiddleware...),
 		genericToHTTP:         r.genericToHTTP,
+		audience:              r.audience,
+		scopes:                slices.Concat(r.scopes, rc.Scopes),
+		requestValidation:     r.requestValidation,
+	}
+	if rc.Audience != "" {
+		subRouter.audience = rc.Audience
+	}
+	if rc.RequestValidation != nil {
+		subRouter.requestValidation = rc.RequestValidation
 	}
 
 	if subRouter.genericToHTTP == nil {
@@ -135,8 +170,31 @@ func (r *router[T]) Subrouter(rc Config[T]) Router[T] {
 	return subRouter
 }
 
+func withRateLimit(middleware []MiddlewareFunc, rl *RateLimit) []MiddlewareFunc {
+	if rl == nil {
+		return middleware
+	}
+	return append(middleware, newLimiter(*rl).middleware)
+}
+
 func (r *router[T]) Endpoint(endpointPath, method string, handler T, doc DocFunc) {
 	fullPath := path.Join(r.pathPrefix, endpointPath)
+	params, err := pathParameters(fullPath)
+	if err != nil {
+		panic(err)
+	}
+
+	// Add swagger docs
+	var op *openapi3.Operation
+	if doc != nil {
+		op, err = doc()
+		if err != nil {
+			panic(err)
+		}
+		op.Parameters = append(op.Parameters, r.defaultParameters...)
+		addPathParameters(op, params)
+		addDocPath(docPath(fullPath), method, r.doc, op)
+	}
 
 	// Apply generic middleware in reverse order
 	for i := len(r.genericMiddleware) - 1; i >= 0; i-- {
@@ -149,6 +207,10 @@ func (r *router[T]) Endpoint(endpointPath, method string, handler T, doc DocFunc
 	// Convert to HTTP handler
 	httpHandler := r.genericToHTTP(handler)
 
+	if r.requestValidation != nil && op != nil {
+		httpHandler = r.requestValidation.middleware(r.doc, fullPath, method, op, params)(httpHandler)
+	}
+
 	// Apply HTTP middleware in reverse order
 	for i := len(r.middleware) - 1; i >= 0; i-- {
 		httpHandler = r.middleware[i](httpHandler)
@@ -158,23 +220,26 @@ func (r *router[T]) Endpoint(endpointPath, method string, handler T, doc DocFunc
 		httpHandler = r.statsHandler(httpHandler, method, fullPath)
 	}
 
-	// Replace route addition with routeMux
-	r.routeMux.addHandler(fullPath, method, httpHandler)
+	httpHandler = withRouteInfo(RouteInfo{
+		Pattern:  fullPath,
+		Method:   method,
+		Audience: r.audience,
+		Scopes:   slices.Clone(r.scopes),
+	}, httpHandler)
 
-	// Add swagger docs
-	if doc != nil {
-		op, err := doc()
-		if err != nil {
-			panic(err)
-		}
-		op.Parameters = append(op.Parameters, r.defaultParameters...)
-		addDocPath(fullPath, method, r.doc, op)
-	}
+	// Replace route addition with routeMux
+	r.routeMux.addHandler(fullPath, method, httpHandler, r.allowedOptionsHeaders...)
 }
 
-// Add new method to router type
-func (r *router[T]) Handle(path string, handler http.Handler) {
-	fullPath := r.pathPrefix + path
+// Handle adds a handler for every method, a trailing slash matches all paths under it
+func (r *router[T]) Handle(handlePath string, handler http.Handler) {
+	fullPath := path.Join(r.pathPrefix, handlePath)
+	if strings.HasSuffix(handlePath, "/") && fullPath != "/" {
+		fullPath += "/"
+	}
+	if _, err := pathParameters(fullPath); err != nil {
+		panic(err)
+	}
 	r.routeMux.addHandler(fullPath, "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handler.ServeHTTP(w, r)
 	}))
@@ -183,29 +248,34 @@ func (r *router[T]) Handle(path string, handler http.Handler) {
 func (rr *rootrouter[T]) NewServer(port string, sc *ServerConfig) *http.Server {
 	mux := http.NewServeMux()
 
+	if sc == nil {
+		sc = &ServerConfig{}
+	}
+
 	paths := rr.routeMux.getAllPaths()
 	for _, path := range paths {
 		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			methods := rr.routeMux.getMethods(path)
+			allowedHeaders := rr.routeMux.getAllowedHeaders(path)
 			handler, exists := rr.routeMux.getHandler(path, r.Method)
-			if !exists {
+			if exists {
+				setCORSHeaders(w, r, methods, allowedHeaders, sc.AllowedOrigins)
+			} else {
 				// For non-method specific handlers (like FileServer)
 				handler, exists = rr.routeMux.getHandler(path, "")
 				if !exists {
 					if r.Method != http.MethodOptions {
+						w.Header().Set("Allow", allowedMethods(methods))
 						w.WriteHeader(http.StatusMethodNotAllowed)
 						return
 					}
-					methods := rr.routeMux.getMethods(path)
-					handler = optionsHandler(methods, rr.allowedOptionsHeaders)
+					handler = optionsHandler(methods, allowedHeaders, sc.AllowedOrigins)
 				}
 			}
 			handler(w, r)
 		})
 	}
 
-	if sc == nil {
-		sc = &ServerConfig{}
-	}
 	if sc.ReadTimeout == 0 {
 		sc.ReadTimeout = 5 * time.Second
 	}
@@ -235,7 +305,86 @@ func (rr *rootrouter[T]) ListRoutes() map[string][]string {
 	return ret
 }
 
+// pathParameters gets the names of the wildcards in a pattern like
+// /domain/{id} and makes sure they can be registered with http.ServeMux
+func pathParameters(pattern string) ([]string, error) {
+	var names []string
+	segments := strings.Split(pattern, "/")
+	for i, seg := range segments {
+		if !strings.ContainsAny(seg, "{}") {
+			continue
+		}
+		if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+			return nil, fmt.Errorf("path %q: wildcard must be a full segment %q", pattern, seg)
+		}
+		name := seg[1 : len(seg)-1]
+		last := i == len(segments)-1
+		if name == "$" {
+			if !last {
+				return nil, fmt.Errorf("path %q: {$} must be at the end", pattern)
+			}
+			continue
+		}
+		if n, ok := strings.CutSuffix(name, "..."); ok {
+			if !last {
+				return nil, fmt.Errorf("path %q: {%s} must be at the end", pattern, name)
+			}
+			name = n
+		}
+		if !validParameterName(name) {
+			return nil, fmt.Errorf("path %q: invalid wildcard name %q", pattern, name)
+		}
+		for _, existing := range names {
+			if existing == name {
+				return nil, fmt.Errorf("path %q: duplicate wildcard %q", pattern, name)
+			}
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func validParameterName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		isLetter := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		isDigit := r >= '0' && r <= '9'
+		if !isLetter && (i == 0 || !isDigit) {
+			return false
+		}
+	}
+	return true
+}
+
+// docPath converts a http.ServeMux pattern into an OpenAPI path
+func docPath(pattern string) string {
+	pattern = strings.TrimSuffix(pattern, "{$}")
+	return strings.ReplaceAll(pattern, "...}", "}")
+}
+
+// addPathParameters documents the path wildcards that are not already described
+func addPathParameters(op *openapi3.Operation, names []string) {
+	for _, name := range names {
+		if op.Parameters.GetByInAndName(openapi3.ParameterInPath, name) != nil {
+			continue
+		}
+		op.Parameters = append(op.Parameters, &openapi3.ParameterRef{
+			Value: openapi3.NewPathParameter(name).WithSchema(openapi3.NewStringSchema()),
+		})
+	}
+}
+
+// Doc is the OpenAPI document built from the endpoints' DocFuncs
+func (rr *rootrouter[T]) Doc() *openapi3.T {
+	return rr.doc
+}
+
 func addDocPath(path, method string, s *openapi3.T, op *openapi3.Operation) {
+	if s.Paths == nil {
+		s.Paths = openapi3.NewPaths()
+	}
 	p := s.Paths.Value(path)
 	if p == nil {
 		p = &openapi3.PathItem{}
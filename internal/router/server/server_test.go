@@ -8,8 +8,11 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/mvndaai/known-anywhere/internal/router/server"
 	"github.com/stretchr/testify/assert"
 )
@@ -33,10 +36,10 @@ func GenericToHTTP(ghf GenericHandlerFunc) http.HandlerFunc {
 			res.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		_, err = res.Write(b)
-		if status == 0 {
+		if status != 0 {
 			res.WriteHeader(status)
 		}
+		_, _ = res.Write(b)
 	}
 }
 func GenericHandle(ghf GenericHandlerFunc) GenericHandlerFunc {
@@ -62,6 +65,18 @@ func findOpenPort(t *testing.T) string {
 	return port
 }
 
+func waitForServer(t *testing.T, port string) {
+	for range 50 {
+		conn, err := net.Dial("tcp", "localhost"+port)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("server did not start on port", port)
+}
+
 func TestRouter(t *testing.T) {
 	// Create middleware
 	var calledRootMiddleware bool
@@ -145,6 +160,7 @@ func TestRouter(t *testing.T) {
 		}
 		close(blockUntilServerStopped)
 	}()
+	waitForServer(t, port)
 
 	// Make http call to enpoint
 	path := fmt.Sprintf("http://localhost%s%s%s%s%s", port, basePath, sub1Path, sub2Path, endpointPath)
@@ -179,6 +195,183 @@ func TestRouter(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 }
 
+func TestPathParameters(t *testing.T) {
+	rr, err := server.New(server.Config[GenericHandlerFunc]{
+		PathPrefix:    "/root",
+		GenericToHTTP: GenericToHTTP,
+	}, server.DocConfig{
+		ServiceName: "test",
+		Description: "test",
+		Version:     "v0.0.1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotID, gotRest string
+	rr.Endpoint("/item/{id}", http.MethodGet, func(r *http.Request) (data, meta any, status int, _ error) {
+		gotID = r.PathValue("id")
+		return
+	}, func() (*openapi3.Operation, error) { return openapi3.NewOperation(), nil })
+	rr.Endpoint("/item/{id}/file/{rest...}", http.MethodGet, func(r *http.Request) (data, meta any, status int, _ error) {
+		gotID = r.PathValue("id")
+		gotRest = r.PathValue("rest")
+		return
+	}, func() (*openapi3.Operation, error) { return openapi3.NewOperation(), nil })
+	h := rr.NewServer(":0", nil).Handler
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/root/item/abc", http.NoBody))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "abc", gotID)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/root/item/def/file/a/b.txt", http.NoBody))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "def", gotID)
+	assert.Equal(t, "a/b.txt", gotRest)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/root/item/abc", http.NoBody))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET,OPTIONS", w.Header().Get("Allow"))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/root/item/abc", http.NoBody))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "GET,OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
+
+	doc := rr.Doc()
+	op := doc.Paths.Value("/root/item/{id}").Get
+	if assert.NotNil(t, op) {
+		p := op.Parameters.GetByInAndName(openapi3.ParameterInPath, "id")
+		if assert.NotNil(t, p) {
+			assert.True(t, p.Required)
+		}
+	}
+	op = doc.Paths.Value("/root/item/{id}/file/{rest}").Get
+	if assert.NotNil(t, op) {
+		assert.Len(t, op.Parameters, 2)
+	}
+}
+
+func TestRouteInfo(t *testing.T) {
+	rr, err := server.New(server.Config[GenericHandlerFunc]{
+		PathPrefix:    "/root",
+		GenericToHTTP: GenericToHTTP,
+	}, server.DocConfig{
+		ServiceName: "test",
+		Description: "test",
+		Version:     "v0.0.1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got server.RouteInfo
+	var found bool
+	end := func(r *http.Request) (data, meta any, status int, _ error) {
+		got, found = server.RouteInfoFromContext(r.Context())
+		return
+	}
+
+	api := rr.Subrouter(server.Config[GenericHandlerFunc]{PathPrefix: "/api", Audience: "api", Scopes: []string{"read"}})
+	api.Endpoint("/item", http.MethodGet, end, nil)
+	write := api.Subrouter(server.Config[GenericHandlerFunc]{Scopes: []string{"write"}})
+	write.Endpoint("/item/{id}", http.MethodPatch, end, nil)
+	api.Subrouter(server.Config[GenericHandlerFunc]{PathPrefix: "/other", Audience: "other"}).Endpoint("", http.MethodGet, end, nil)
+	rr.Endpoint("/open", http.MethodGet, end, nil)
+	h := rr.NewServer(":0", nil).Handler
+
+	tests := []struct {
+		method   string
+		path     string
+		expected server.RouteInfo
+	}{
+		{method: http.MethodGet, path: "/root/api/item", expected: server.RouteInfo{Pattern: "/root/api/item", Method: http.MethodGet, Audience: "api", Scopes: []string{"read"}}},
+		{method: http.MethodPatch, path: "/root/api/item/1", expected: server.RouteInfo{Pattern: "/root/api/item/{id}", Method: http.MethodPatch, Audience: "api", Scopes: []string{"read", "write"}}},
+		{method: http.MethodGet, path: "/root/api/other", expected: server.RouteInfo{Pattern: "/root/api/other", Method: http.MethodGet, Audience: "other", Scopes: []string{"read"}}},
+		{method: http.MethodGet, path: "/root/open", expected: server.RouteInfo{Pattern: "/root/open", Method: http.MethodGet}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			got, found = server.RouteInfo{}, false
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, http.NoBody))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.True(t, found)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestInvalidPathParameters(t *testing.T) {
+	rr, err := server.New(server.Config[GenericHandlerFunc]{
+		PathPrefix:    "/root",
+		GenericToHTTP: GenericToHTTP,
+	}, server.DocConfig{
+		ServiceName: "test",
+		Description: "test",
+		Version:     "v0.0.1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := func(r *http.Request) (data, meta any, status int, _ error) { return }
+
+	for _, p := range []string{"/item/a{id}", "/item/{id", "/item/{rest...}/more", "/item/{id}/{id}", "/item/{1d}"} {
+		assert.Panics(t, func() { rr.Endpoint(p, http.MethodGet, end, nil) }, p)
+	}
+}
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	rr, err := server.New(server.Config[GenericHandlerFunc]{
+		PathPrefix:    "/root",
+		GenericToHTTP: GenericToHTTP,
+	}, server.DocConfig{
+		ServiceName: "test",
+		Description: "test",
+		Version:     "v0.0.1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr.Endpoint("/item", http.MethodGet, func(r *http.Request) (data, meta any, status int, _ error) { return }, nil)
+	h := rr.NewServer(":0", &server.ServerConfig{AllowedOrigins: []string{"https://allowed.example"}}).Handler
+
+	tests := []struct {
+		name    string
+		method  string
+		origin  string
+		allowed bool
+	}{
+		{name: "preflight allowed", method: http.MethodOptions, origin: "https://allowed.example", allowed: true},
+		{name: "request allowed", method: http.MethodGet, origin: "https://allowed.example", allowed: true},
+		{name: "preflight other origin", method: http.MethodOptions, origin: "https://evil.example"},
+		{name: "request other origin", method: http.MethodGet, origin: "https://evil.example"},
+		{name: "no origin", method: http.MethodGet},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/root/item", http.NoBody)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "Origin", w.Header().Get("Vary"))
+			if tt.allowed {
+				assert.Equal(t, tt.origin, w.Header().Get("Access-Control-Allow-Origin"))
+				assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+				return
+			}
+			assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+		})
+	}
+}
+
 //func TestHealthCheck(t *testing.T) {
 //	// Create router
 //	rr, err := server.New(server.Config{
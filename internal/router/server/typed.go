@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"encoding"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/validjson"
+)
+
+// GenericHandlerFunc is the handler of routers that typed endpoints can be
+// added to
+type GenericHandlerFunc interface {
+	~func(r *http.Request) (data, meta any, status int, _ error)
+}
+
+// TypedHandlerFunc gets the decoded request and returns the data and meta of
+// the response
+type TypedHandlerFunc[Req, Data any] func(ctx context.Context, req Req) (data Data, meta any, _ error)
+
+// RequestHandlerFunc is a TypedHandlerFunc that also gets the request, for
+// handlers that need headers, cookies or the client address
+type RequestHandlerFunc[Req, Data any] func(r *http.Request, req Req) (data Data, meta any, _ error)
+
+// Filler reads query parameters, list types use it for pagination and filters
+type Filler interface {
+	Fill(ctx context.Context, q url.Values) error
+}
+
+// Endpoint adds a typed handler. The request is decoded with Decode and the
+// status of a success is the first 2xx response of the doc. A nil doc is made
+// from Req and Data with BodyDoc, for methods with a body, or QueryDoc.
+// Handlers with NoBody as Data respond without data.
+func Endpoint[T GenericHandlerFunc, Req, Data any](rt Router[T], endpointPath, method string, handler TypedHandlerFunc[Req, Data], doc DocFunc) {
+	RequestEndpoint(rt, endpointPath, method, func(r *http.Request, req Req) (Data, any, error) {
+		return handler(r.Context(), req)
+	}, doc)
+}
+
+// RequestEndpoint is Endpoint for handlers that also need the request
+func RequestEndpoint[T GenericHandlerFunc, Req, Data any](rt Router[T], endpointPath, method string, handler RequestHandlerFunc[Req, Data], doc DocFunc) {
+	if doc == nil {
+		doc = RequestDoc[Req, Data](method, Doc{})
+	}
+	op, err := doc()
+	if err != nil {
+		panic(err)
+	}
+	status := successStatus(op)
+	noData := reflect.TypeFor[Data]() == noBodyType
+
+	rt.Endpoint(endpointPath, method, T(func(r *http.Request) (data, meta any, _ int, _ error) {
+		ctx := r.Context()
+		req, err := Decode[Req](r)
+		if err != nil {
+			return nil, nil, http.StatusBadRequest, ctxerr.QuickWrap(ctx, err)
+		}
+		d, meta, err := handler(r, req)
+		if err != nil {
+			return nil, nil, http.StatusInternalServerError, ctxerr.QuickWrap(ctx, err)
+		}
+		if noData {
+			return nil, meta, status, nil
+		}
+		return d, meta, status, nil
+	}), func() (*openapi3.Operation, error) { return op, nil })
+}
+
+// RequestDoc is BodyDoc for methods with a body and QueryDoc for the rest
+func RequestDoc[Req, Resp any](method string, d Doc) DocFunc {
+	if hasBody(method) {
+		return BodyDoc[Req, Resp](d)
+	}
+	return QueryDoc[Req, Resp](d)
+}
+
+func hasBody(method string) bool {
+	return slices.Contains([]string{http.MethodPost, http.MethodPut, http.MethodPatch}, method)
+}
+
+func successStatus(op *openapi3.Operation) int {
+	for status := http.StatusOK; status < http.StatusMultipleChoices; status++ {
+		if op.Responses.Status(status) != nil {
+			return status
+		}
+	}
+	return http.StatusOK
+}
+
+// Decode reads Req from a request. Fields tagged `path:"name"` get the path
+// parameter, query parameters are given to Fill and JSON bodies of POST, PUT
+// and PATCH are unmarshaled. The body goes to the field tagged `body:""` when
+// Req has one, so a body can have path parameters with it. Normalize and
+// Validate of the body run last, like with validjson.
+func Decode[Req any](r *http.Request) (Req, error) {
+	ctx := r.Context()
+	var req Req
+
+	err := decodePath(r, reflect.ValueOf(&req).Elem())
+	if err != nil {
+		return req, ctxerr.QuickWrap(ctx, err)
+	}
+	if f, ok := any(&req).(Filler); ok {
+		if err := f.Fill(ctx, r.URL.Query()); err != nil {
+			return req, ctxerr.QuickWrap(ctx, err)
+		}
+	}
+
+	body := any(&req)
+	if f, ok := bodyField(reflect.TypeFor[Req]()); ok {
+		body = reflect.ValueOf(&req).Elem().FieldByIndex(f.Index).Addr().Interface()
+	}
+	if hasBody(r.Method) && r.ContentLength != 0 && reflect.TypeOf(body).Elem() != noBodyType {
+		// validjson normalizes and validates after unmarshaling
+		err := validjson.UnmarshalReadCloser(ctx, r.Body, body)
+		defer r.Body.Close()
+		if err != nil {
+			return req, ctxerr.WrapHTTP(ctx, err, "22d95a5f-ae1b-4430-90bf-1813f4ed8e32", "decoding body", http.StatusBadRequest, "invalid request body")
+		}
+		return req, nil
+	}
+
+	switch v := body.(type) {
+	case validjson.ContextNormalizer:
+		v.Normalize(ctx)
+	case validjson.Normalizer:
+		v.Normalize()
+	}
+	switch v := body.(type) {
+	case validjson.ContextValidator:
+		err = v.Validate(ctx)
+	case validjson.Validator:
+		err = v.Validate()
+	}
+	if err != nil {
+		return req, ctxerr.WrapHTTP(ctx, err, "fedd6f7a-4ae0-4d43-aea4-32e9ae5390c2", "invalid request", http.StatusBadRequest, "invalid request")
+	}
+	return req, nil
+}
+
+// bodyField is the field of t tagged `body:""`
+func bodyField(t reflect.Type) (reflect.StructField, bool) {
+	if t.Kind() != reflect.Struct {
+		return reflect.StructField{}, false
+	}
+	for i := range t.NumField() {
+		if _, ok := t.Field(i).Tag.Lookup("body"); ok {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// decodePath sets the fields of v tagged with a path parameter, they can be
+// strings or types like uuid.UUID that unmarshal from text
+func decodePath(r *http.Request, v reflect.Value) error {
+	ctx := r.Context()
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := range v.NumField() {
+		name := v.Type().Field(i).Tag.Get("path")
+		if name == "" {
+			continue
+		}
+		value := r.PathValue(name)
+		field := v.Field(i)
+		if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			if err := u.UnmarshalText([]byte(value)); err != nil {
+				ctx = ctxerr.SetField(ctx, name, value)
+				return ctxerr.WrapHTTP(ctx, err, "9d308c67-fa1c-4b33-a4f5-334b9a6cfd2f", "invalid path parameter", http.StatusBadRequest, "invalid "+name)
+			}
+			continue
+		}
+		if field.Kind() != reflect.String {
+			return ctxerr.NewHTTP(ctx, "f50f05e1-84d0-4e5f-b457-5ad36a8a4995", "path parameter field is not a string", http.StatusInternalServerError, "path field type "+field.Type().String())
+		}
+		field.SetString(value)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/known-anywhere/internal/router/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	typedCreate struct {
+		ID   uuid.UUID `path:"id" json:"-"`
+		Name string    `json:"name"`
+	}
+
+	typedList struct {
+		Limit int `json:"limit"`
+	}
+
+	typedName struct {
+		Name string `json:"name"`
+	}
+
+	typedRename struct {
+		ID   uuid.UUID `path:"id" json:"-"`
+		Body typedName `body:"" json:"-"`
+	}
+)
+
+func (v *typedCreate) Normalize() { v.Name = strings.ToLower(v.Name) }
+
+func (v typedCreate) Validate(context.Context) error {
+	if v.Name == "" {
+		return errors.New("missing name")
+	}
+	return nil
+}
+
+func (v typedName) Validate(context.Context) error {
+	if v.Name == "" {
+		return errors.New("missing name")
+	}
+	return nil
+}
+
+func (v *typedList) Fill(_ context.Context, q url.Values) error {
+	if l := q.Get("limit"); l != "" {
+		var err error
+		v.Limit, err = strconv.Atoi(l)
+		return err
+	}
+	return nil
+}
+
+func TestEndpoint(t *testing.T) {
+	rr, err := server.New(server.Config[GenericHandlerFunc]{
+		PathPrefix:    "/root",
+		GenericToHTTP: GenericToHTTP,
+	}, server.DocConfig{
+		ServiceName: "test",
+		Description: "test",
+		Version:     "v0.0.1",
+	})
+	require.NoError(t, err)
+
+	server.Endpoint(rr, "/item/{id}", http.MethodPost, func(ctx context.Context, req typedCreate) (typedCreate, any, error) {
+		if req.Name == "fail" {
+			return req, nil, errors.New("failed")
+		}
+		return req, nil, nil
+	}, server.BodyDoc[typedCreate, typedCreate](server.Doc{Status: http.StatusCreated}))
+	server.Endpoint(rr, "/item", http.MethodGet, func(ctx context.Context, req typedList) ([]int, any, error) {
+		return make([]int, req.Limit), req.Limit, nil
+	}, nil)
+	var renamed typedRename
+	server.Endpoint(rr, "/item/{id}", http.MethodPatch, func(ctx context.Context, req typedRename) (server.NoBody, any, error) {
+		renamed = req
+		return server.NoBody{}, nil, nil
+	}, nil)
+	h := rr.NewServer(":0", nil).Handler
+
+	id := uuid.New()
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		resp   string
+	}{
+		{name: "body and path", method: http.MethodPost, path: "/root/item/" + id.String(), body: `{"name":"A"}`, status: http.StatusCreated, resp: `{"data":{"name":"a"},"meta":null}`},
+		{name: "invalid path", method: http.MethodPost, path: "/root/item/1", body: `{"name":"a"}`, status: http.StatusBadRequest},
+		{name: "invalid body", method: http.MethodPost, path: "/root/item/" + id.String(), body: `{"name":`, status: http.StatusBadRequest},
+		{name: "validated body", method: http.MethodPost, path: "/root/item/" + id.String(), body: `{"name":""}`, status: http.StatusBadRequest},
+		{name: "missing body is validated", method: http.MethodPost, path: "/root/item/" + id.String(), status: http.StatusBadRequest},
+		{name: "handler error", method: http.MethodPost, path: "/root/item/" + id.String(), body: `{"name":"fail"}`, status: http.StatusInternalServerError},
+		{name: "query", method: http.MethodGet, path: "/root/item?limit=2", status: http.StatusOK, resp: `{"data":[0,0],"meta":2}`},
+		{name: "fill error", method: http.MethodGet, path: "/root/item?limit=two", status: http.StatusBadRequest},
+		{name: "body field", method: http.MethodPatch, path: "/root/item/" + id.String(), body: `{"name":"b"}`, status: http.StatusOK, resp: `{"data":null,"meta":null}`},
+		{name: "validated body field", method: http.MethodPatch, path: "/root/item/" + id.String(), body: `{"name":""}`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code)
+			if tt.resp != "" {
+				assert.JSONEq(t, tt.resp, w.Body.String())
+			}
+		})
+	}
+
+	assert.Equal(t, typedRename{ID: id, Body: typedName{Name: "b"}}, renamed)
+
+	op := rr.Doc().Paths.Find("/root/item").Get
+	require.NotNil(t, op)
+	assert.Equal(t, "limit", op.Parameters[0].Value.Name)
+
+	op = rr.Doc().Paths.Find("/root/item/{id}").Patch
+	require.NotNil(t, op)
+	body := op.RequestBody.Value.Content.Get("application/json").Schema.Value
+	assert.Contains(t, body.Properties, "name")
+	assert.NotContains(t, body.Properties, "Body")
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/mvndaai/ctxerr"
+)
+
+// FieldViolations is the error field with every way a request did not match
+// the doc
+const FieldViolations = "violations"
+
+// RequestValidation checks query parameters, headers and JSON bodies against
+// the doc of the endpoint before its handler runs. Endpoints without a doc
+// are not checked.
+type RequestValidation struct {
+	// Invalid writes the response for a request that does not match. The error
+	// is a 400 with the violations in FieldViolations.
+	Invalid func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// Violation is one way a request did not match the doc
+type Violation struct {
+	// In is body, query, header or path
+	In string `json:"in"`
+	// Pointer is a JSON pointer to the value in the body, for parameters it
+	// starts with the name of the parameter
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+func (rv RequestValidation) middleware(doc *openapi3.T, path, method string, op *openapi3.Operation, params []string) MiddlewareFunc {
+	route := &routers.Route{
+		Spec:      doc,
+		Path:      docPath(path),
+		PathItem:  doc.Paths.Value(docPath(path)),
+		Method:    method,
+		Operation: op,
+	}
+	options := &openapi3filter.Options{
+		MultiError:         true,
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+	invalid := rv.Invalid
+	if invalid == nil {
+		invalid = func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if r.Header.Get("Content-Type") == "" {
+				// Handlers decode bodies as JSON whatever the content type
+				r = r.Clone(ctx)
+				r.Header.Set("Content-Type", "application/json")
+			}
+			pathParams := make(map[string]string, len(params))
+			for _, name := range params {
+				pathParams[name] = r.PathValue(name)
+			}
+			err := openapi3filter.ValidateRequest(ctx, &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    options,
+			})
+			if err != nil {
+				ctx = ctxerr.SetField(ctx, FieldViolations, violations(err, Violation{}))
+				invalid(w, r, ctxerr.WrapHTTP(ctx, err, "debd5bd4-89c5-425e-8f90-922ec49a06f8", "request does not match the api doc", http.StatusBadRequest, "invalid request"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+	}
+}
+
+// violations flattens the errors of openapi3filter, v has what is known from
+// the errors around err
+func violations(err error, v Violation) []Violation {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		var vs []Violation
+		for _, sub := range e {
+			vs = append(vs, violations(sub, v)...)
+		}
+		return vs
+	case *openapi3filter.RequestError:
+		switch {
+		case e.Parameter != nil:
+			v.In = e.Parameter.In
+			v.Pointer = jsonPointer(e.Parameter.Name)
+		case e.RequestBody != nil:
+			v.In = "body"
+		}
+		if e.Err == nil {
+			v.Message = e.Reason
+			return []Violation{v}
+		}
+		return violations(e.Err, v)
+	case *openapi3.SchemaError:
+		v.Pointer += jsonPointer(e.JSONPointer()...)
+		v.Message = e.Reason
+	case *openapi3filter.ParseError:
+		var path []string
+		for _, p := range e.Path() {
+			path = append(path, fmt.Sprint(p))
+		}
+		v.Pointer += jsonPointer(path...)
+		v.Message = e.Error()
+	default:
+		v.Message = err.Error()
+	}
+	return []Violation{v}
+}
+
+// jsonPointer escapes the tokens of a JSON pointer, RFC 6901
+func jsonPointer(tokens ...string) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		b.WriteString("/")
+		b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(t))
+	}
+	return b.String()
+}
@@ -0,0 +1,104 @@
+package server_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/router/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type validateBody struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	Tags  []struct {
+		Value string `json:"value"`
+	} `json:"tags"`
+}
+
+func TestRequestValidation(t *testing.T) {
+	rr, err := server.New(server.Config[GenericHandlerFunc]{
+		PathPrefix:    "/root",
+		GenericToHTTP: GenericToHTTP,
+	}, server.DocConfig{
+		ServiceName: "test",
+		Description: "test",
+		Version:     "v0.0.1",
+	})
+	require.NoError(t, err)
+
+	var gotErr error
+	var body string
+	validated := rr.Subrouter(server.Config[GenericHandlerFunc]{
+		RequestValidation: &server.RequestValidation{
+			Invalid: func(w http.ResponseWriter, r *http.Request, err error) {
+				gotErr = err
+				w.WriteHeader(http.StatusBadRequest)
+			},
+		},
+	})
+	end := func(r *http.Request) (data, meta any, status int, _ error) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		return
+	}
+	validated.Endpoint("/item", http.MethodGet, end, server.QueryDoc[docList, server.NoBody](server.Doc{}))
+	validated.Endpoint("/item/{id}", http.MethodPost, end, server.BodyDoc[validateBody, server.NoBody](server.Doc{}))
+	validated.Endpoint("/nodoc", http.MethodPost, end, nil)
+	rr.Endpoint("/open", http.MethodPost, end, server.BodyDoc[validateBody, server.NoBody](server.Doc{}))
+	h := rr.NewServer(":0", nil).Handler
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		noType     bool
+		violations []server.Violation
+	}{
+		{name: "valid query", method: http.MethodGet, path: "/root/item?limit=5&name=a"},
+		{name: "invalid query", method: http.MethodGet, path: "/root/item?limit=five", violations: []server.Violation{
+			{In: "query", Pointer: "/limit", Message: `value five: an invalid integer: invalid syntax`},
+		}},
+		{name: "valid body", method: http.MethodPost, path: "/root/item/1", body: `{"name":"a","count":1,"tags":[{"value":"b"}]}`},
+		{name: "invalid body", method: http.MethodPost, path: "/root/item/1", body: `{"name":1,"count":"x","tags":[{"value":2}]}`, violations: []server.Violation{
+			{In: "body", Pointer: "/count", Message: "value must be an integer"},
+			{In: "body", Pointer: "/name", Message: "value must be a string"},
+			{In: "body", Pointer: "/tags/0/value", Message: "value must be a string"},
+		}},
+		{name: "no content type", method: http.MethodPost, path: "/root/item/1", body: `{"name":"a"}`, noType: true},
+		{name: "missing body", method: http.MethodPost, path: "/root/item/1", violations: []server.Violation{
+			{In: "body", Message: "value is required but missing"},
+		}},
+		{name: "no doc", method: http.MethodPost, path: "/root/nodoc", body: `{"name":1}`},
+		{name: "not validated", method: http.MethodPost, path: "/root/open", body: `{"name":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotErr, body = nil, ""
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if !tt.noType {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if tt.violations == nil {
+				assert.NoError(t, gotErr)
+				// The handler can still read the body
+				assert.Equal(t, tt.body, body)
+				return
+			}
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			require.Error(t, gotErr)
+			fields := ctxerr.AllFields(gotErr)
+			assert.Equal(t, http.StatusBadRequest, fields[ctxerr.FieldKeyStatusCode])
+			assert.ElementsMatch(t, tt.violations, fields[server.FieldViolations])
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package router
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/types"
+)
+
+func (h *Handler) socialCreateHandler(ctx context.Context, body types.SocialCreate) (uuid.UUID, any, error) {
+	s, err := h.db.CreateSocial(ctx, body)
+	if err != nil {
+		return uuid.Nil, nil, ctxerr.QuickWrap(ctx, err)
+	}
+
+	setLocation(ctx, "/api/social", s)
+	return s, nil, nil
+}
+
+func (h *Handler) socialGetHandler(ctx context.Context, req idPath) (types.Social, any, error) {
+	s, err := h.db.GetSocial(ctx, req.ID.String())
+	if err != nil {
+		return types.Social{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return s, nil, nil
+}
+
+func (h *Handler) socialListHandler(ctx context.Context, list types.SocialList) ([]types.Social, any, error) {
+	socials, pagination, err := h.db.ListSocials(ctx, list.Filters, list.Pagination, list.Sort)
+	if err != nil {
+		return nil, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return socials, pagination, nil
+}
+
+func (h *Handler) socialVoteHandler(ctx context.Context, req idBody[types.VoteCreate]) (types.Votes, any, error) {
+	id := req.ID.String()
+	err := h.db.VoteSocial(ctx, id, req.Body)
+	if err != nil {
+		return types.Votes{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+
+	s, err := h.db.GetSocial(ctx, id)
+	if err != nil {
+		return types.Votes{}, nil, ctxerr.QuickWrap(ctx, err)
+	}
+	return s.Votes, nil, nil
+}
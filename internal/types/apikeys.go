@@ -0,0 +1,70 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+)
+
+type (
+	APIKeyCreate struct {
+		Name       string     `json:"name"`
+		Scopes     []string   `json:"scopes"`
+		Expiration *time.Time `json:"expiration"`
+	}
+
+	APIKey struct {
+		ID         uuid.UUID  `json:"id"`
+		Name       string     `json:"name"`
+		Prefix     string     `json:"prefix"`
+		Scopes     []string   `json:"scopes"`
+		LastUsed   *time.Time `json:"last_used"`
+		Expiration *time.Time `json:"expiration"`
+		Created    time.Time  `json:"created"`
+	}
+
+	// APIKeyCreated is the only time the key is shown
+	APIKeyCreated struct {
+		APIKey
+		Key string `json:"key"`
+	}
+
+	APIKeyFilters struct {
+		UserID uuid.UUID `json:"user_id"`
+	}
+)
+
+func (v APIKey) GetID() uuid.UUID { return v.ID }
+
+func (v *APIKeyCreate) Normalize() {
+	v.Name = strings.TrimSpace(v.Name)
+	var scopes []string
+	for _, s := range v.Scopes {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s != "" && !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	v.Scopes = scopes
+}
+
+// Validate does not know which scopes exist, the db checks them
+func (v APIKeyCreate) Validate(ctx context.Context) error {
+	var err error
+	if v.Name == "" || len(v.Name) > 100 {
+		err = errors.Join(err, ctxerr.NewHTTP(ctx, "6f7340e3-e379-4dfe-8e34-702eedc9ee5c", "name must be 1 to 100 characters", http.StatusBadRequest, "invalid name"))
+	}
+	if len(v.Scopes) == 0 {
+		err = errors.Join(err, ctxerr.NewHTTP(ctx, "9da85f29-9ca4-45e0-8b5f-05408dedf116", "at least one scope is required", http.StatusBadRequest, "missing scopes"))
+	}
+	if v.Expiration != nil && !v.Expiration.After(time.Now()) {
+		err = errors.Join(err, ctxerr.NewHTTP(ctx, "fedbe6d4-640e-4252-be94-78dc24abf906", "expiration must be in the future", http.StatusBadRequest, "invalid expiration"))
+	}
+	return err
+}
@@ -0,0 +1,219 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+)
+
+const (
+	PasswordMinLength = 10
+	PasswordMaxLength = 256
+)
+
+type (
+	Registration struct {
+		UserCreate
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	Login struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	PasswordChange struct {
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+	}
+
+	PasswordResetRequest struct {
+		Email string `json:"email"`
+	}
+
+	PasswordReset struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	Token struct {
+		AccessToken      string    `json:"access_token"`
+		TokenType        string    `json:"token_type"`
+		ExpiresAt        time.Time `json:"expires_at"`
+		RefreshToken     string    `json:"refresh_token"`
+		RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	}
+
+	RefreshRequest struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	// SessionCreate describes the device a login came from
+	SessionCreate struct {
+		UserID    uuid.UUID `json:"user_id"`
+		UserAgent string    `json:"user_agent"`
+		IPAddress string    `json:"ip_address"`
+	}
+
+	Session struct {
+		ID         uuid.UUID `json:"id"`
+		UserAgent  string    `json:"user_agent"`
+		IPAddress  string    `json:"ip_address"`
+		LastUsed   time.Time `json:"last_used"`
+		Expiration time.Time `json:"expiration"`
+		Created    time.Time `json:"created"`
+		Current    bool      `json:"current" db:"-"`
+	}
+
+	SessionFilters struct {
+		UserID uuid.UUID `json:"user_id"`
+	}
+
+	// OIDCState is kept between starting a provider login and its callback
+	OIDCState struct {
+		Provider     string `json:"provider"`
+		State        string `json:"state"`
+		Nonce        string `json:"nonce"`
+		CodeVerifier string `json:"code_verifier"`
+	}
+
+	OIDCLogin struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+
+	// Identity is a user at an external provider
+	Identity struct {
+		Provider          string `json:"provider"`
+		Subject           string `json:"subject"`
+		Email             string `json:"email"`
+		Name              string `json:"-"`
+		PreferredUsername string `json:"-"`
+	}
+)
+
+func (v Session) GetID() uuid.UUID { return v.ID }
+
+// validatePassword only checks length, long passphrases are better than rules
+func validatePassword(ctx context.Context, field, password string) error {
+	ctx = ctxerr.SetField(ctx, "field", field)
+	if l := utf8.RuneCountInString(password); l < PasswordMinLength || l > PasswordMaxLength {
+		return ctxerr.NewHTTP(ctx, "d30fdf71-b6e0-4976-beb8-bac7e747d594", field+" must be between 10 and 256 characters", http.StatusBadRequest, "invalid "+field+" length")
+	}
+	return nil
+}
+
+func validateEmail(ctx context.Context, email string) error {
+	a, err := mail.ParseAddress(email)
+	if err != nil || a.Address != email {
+		return ctxerr.NewHTTP(ctx, "36af34cb-c123-400c-ab05-3e90702811ae", "invalid email", http.StatusBadRequest, "invalid email")
+	}
+	return nil
+}
+
+func (v *Registration) Normalize() {
+	v.Username = strings.TrimSpace(v.Username)
+	v.DisplayName = strings.TrimSpace(v.DisplayName)
+	v.Email = strings.TrimSpace(v.Email)
+}
+
+func (v Registration) Validate(ctx context.Context) error {
+	var err error
+	if v.Username == "" {
+		err = errors.Join(err, ctxerr.NewHTTP(ctx, "0e26e496-eca4-4a84-b4bc-86d50e579be6", "missing username", http.StatusBadRequest, "missing username"))
+	}
+	err = errors.Join(err, validateEmail(ctx, v.Email))
+	err = errors.Join(err, validatePassword(ctx, "password", v.Password))
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+func (v *Login) Normalize() {
+	v.Username = strings.TrimSpace(v.Username)
+}
+
+func (v Login) Validate(ctx context.Context) error {
+	if v.Username == "" || v.Password == "" {
+		return ctxerr.NewHTTP(ctx, "c7fbfee5-206c-4240-9b1f-3c10715d374d", "missing username or password", http.StatusBadRequest, "missing username or password")
+	}
+	return nil
+}
+
+func (v PasswordChange) Validate(ctx context.Context) error {
+	var err error
+	if v.OldPassword == "" {
+		err = errors.Join(err, ctxerr.NewHTTP(ctx, "3041e53c-9c5b-4171-8195-5c834ac01032", "missing old_password", http.StatusBadRequest, "missing old_password"))
+	}
+	err = errors.Join(err, validatePassword(ctx, "new_password", v.NewPassword))
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+func (v *PasswordResetRequest) Normalize() {
+	v.Email = strings.TrimSpace(v.Email)
+}
+
+func (v PasswordResetRequest) Validate(ctx context.Context) error {
+	return ctxerr.QuickWrap(ctx, validateEmail(ctx, v.Email))
+}
+
+func (v *PasswordReset) Normalize() {
+	v.Token = strings.TrimSpace(v.Token)
+}
+
+func (v PasswordReset) Validate(ctx context.Context) error {
+	var err error
+	if v.Token == "" {
+		err = errors.Join(err, ctxerr.NewHTTP(ctx, "a95251ec-095c-4099-b3b0-cba967f45658", "missing token", http.StatusBadRequest, "missing token"))
+	}
+	err = errors.Join(err, validatePassword(ctx, "password", v.Password))
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+func (v *RefreshRequest) Normalize() {
+	v.RefreshToken = strings.TrimSpace(v.RefreshToken)
+}
+
+func (v RefreshRequest) Validate(ctx context.Context) error {
+	if v.RefreshToken == "" {
+		return ctxerr.NewHTTP(ctx, "8dfa96a1-b3d0-4494-bcbc-0e9feda41b3a", "missing refresh_token", http.StatusBadRequest, "missing refresh_token")
+	}
+	return nil
+}
+
+// MaxUsernameLength is the longest username made from a provider profile
+const MaxUsernameLength = 30
+
+// Username suggests a username from the provider profile. It can be taken so
+// callers need to check it is available.
+func (v Identity) Username() string {
+	candidates := []string{v.PreferredUsername}
+	if local, _, ok := strings.Cut(v.Email, "@"); ok {
+		candidates = append(candidates, local)
+	}
+	candidates = append(candidates, v.Name)
+
+	for _, c := range candidates {
+		var b strings.Builder
+		for _, r := range strings.ToLower(strings.TrimSpace(c)) {
+			switch {
+			case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+				b.WriteRune(r)
+			case r == ' ':
+				b.WriteRune('_')
+			}
+			if b.Len() == MaxUsernameLength {
+				break
+			}
+		}
+		if u := strings.Trim(b.String(), "._-"); u != "" {
+			return u
+		}
+	}
+	return "user"
+}
@@ -0,0 +1,69 @@
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+)
+
+type (
+	// ImpersonationRequest is why an admin needs to act as a user
+	ImpersonationRequest struct {
+		Reason string `json:"reason"`
+	}
+
+	ImpersonationCreate struct {
+		UserID     uuid.UUID `json:"user_id"`
+		Reason     string    `json:"reason"`
+		JWTID      uuid.UUID `json:"jwt_id"`
+		Expiration time.Time `json:"expiration"`
+	}
+
+	Impersonation struct {
+		ID uuid.UUID `json:"id"`
+		ImpersonationCreate
+		Creator uuid.UUID `json:"creator"`
+		Created time.Time `json:"created"`
+	}
+
+	ImpersonationFilters struct {
+		UserID  uuid.UUID `json:"user_id"`
+		Creator uuid.UUID `json:"creator"`
+	}
+
+	ImpersonationList struct {
+		Pagination Pagination           `json:"pagination"`
+		Filters    ImpersonationFilters `json:"filters"`
+	}
+)
+
+func (v Impersonation) GetID() uuid.UUID { return v.ID }
+
+func (v *ImpersonationRequest) Normalize() {
+	v.Reason = strings.TrimSpace(v.Reason)
+}
+
+func (v ImpersonationRequest) Validate(ctx context.Context) error {
+	if v.Reason == "" {
+		return ctxerr.NewHTTP(ctx, "b1edbf18-86d1-430d-97fb-0053ddc5425f", "a reason is required to act as a user", http.StatusBadRequest, "missing reason")
+	}
+	return nil
+}
+
+func (v *ImpersonationList) Fill(ctx context.Context, q url.Values) error {
+	var err error
+	v.Filters.UserID, err = parseUUIDParam(ctx, q, JSONTag(v.Filters, "UserID"))
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	v.Filters.Creator, err = parseUUIDParam(ctx, q, JSONTag(v.Filters, "Creator"))
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	return ctxerr.QuickWrap(ctx, v.Pagination.Fill(ctx, q))
+}
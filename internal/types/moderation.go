@@ -0,0 +1,73 @@
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+)
+
+const (
+	NotificationApproved = "approved"
+	NotificationRejected = "rejected"
+)
+
+type (
+	// Rejection is why a moderator did not approve an item, it is sent to the
+	// creator
+	Rejection struct {
+		Reason string `json:"reason"`
+	}
+
+	Notification struct {
+		ID       uuid.UUID `json:"id"`
+		Type     string    `json:"type"`
+		ItemType string    `json:"item_type"`
+		ItemID   uuid.UUID `json:"item_id"`
+		Message  string    `json:"message"`
+		Read     bool      `json:"read"`
+		Created  time.Time `json:"created"`
+	}
+
+	NotificationFilters struct {
+		// UserID is always the subject
+		UserID uuid.UUID `json:"user_id" doc:"-"`
+		Read   *bool     `json:"read"`
+	}
+
+	NotificationList struct {
+		Pagination Pagination          `json:"pagination"`
+		Filters    NotificationFilters `json:"filters"`
+	}
+)
+
+func (v Notification) GetID() uuid.UUID { return v.ID }
+
+func (v *Rejection) Normalize() {
+	v.Reason = strings.TrimSpace(v.Reason)
+}
+
+func (v Rejection) Validate(ctx context.Context) error {
+	if v.Reason == "" {
+		return ctxerr.NewHTTP(ctx, "58607c0b-f928-48be-908b-660350e79ff6", "a reason is required to reject", http.StatusBadRequest, "missing reason")
+	}
+	return nil
+}
+
+func (v *NotificationList) Fill(ctx context.Context, q url.Values) error {
+	key := JSONTag(v.Filters, "Read")
+	if s := strings.TrimSpace(q.Get(key)); s != "" {
+		read, err := strconv.ParseBool(s)
+		if err != nil {
+			ctx = ctxerr.SetField(ctx, key, s)
+			return ctxerr.NewHTTP(ctx, "7df00db0-e0ee-4dfe-bc12-a7692e179dd4", "read must be true or false", http.StatusBadRequest, "invalid read")
+		}
+		v.Filters.Read = &read
+	}
+	return ctxerr.QuickWrap(ctx, v.Pagination.Fill(ctx, q))
+}
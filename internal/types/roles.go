@@ -0,0 +1,91 @@
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+)
+
+// Role is what a user is allowed to do, each role can do everything the
+// roles before it can
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var roleRanks = map[Role]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+func (r Role) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// AtLeast checks if the role includes the other role, an empty role is a user
+func (r Role) AtLeast(other Role) bool {
+	if r == "" {
+		r = RoleUser
+	}
+	return roleRanks[r] >= roleRanks[other]
+}
+
+type (
+	RoleChange struct {
+		Role   Role   `json:"role"`
+		Reason string `json:"reason"`
+	}
+
+	RoleAudit struct {
+		ID      uuid.UUID  `json:"id"`
+		UserID  uuid.UUID  `json:"user_id"`
+		OldRole Role       `json:"old_role"`
+		NewRole Role       `json:"new_role"`
+		Reason  string     `json:"reason"`
+		Creator *uuid.UUID `json:"creator"`
+		Created time.Time  `json:"created"`
+	}
+
+	RoleAuditFilters struct {
+		UserID uuid.UUID `json:"user_id"`
+	}
+
+	RoleAuditList struct {
+		Pagination Pagination       `json:"pagination"`
+		Filters    RoleAuditFilters `json:"filters"`
+	}
+)
+
+func (v RoleAudit) GetID() uuid.UUID { return v.ID }
+
+func (v *RoleChange) Normalize() {
+	v.Role = Role(strings.ToLower(strings.TrimSpace(string(v.Role))))
+	v.Reason = strings.TrimSpace(v.Reason)
+}
+
+func (v RoleChange) Validate(ctx context.Context) error {
+	if !v.Role.Valid() {
+		ctx = ctxerr.SetField(ctx, "role", v.Role)
+		return ctxerr.NewHTTP(ctx, "4c2e9674-ad13-4a0a-80fa-53ed0d403f91", "role must be user, moderator or admin", http.StatusBadRequest, "invalid role")
+	}
+	return nil
+}
+
+func (v *RoleAuditList) Fill(ctx context.Context, q url.Values) error {
+	var err error
+	v.Filters.UserID, err = parseUUIDParam(ctx, q, JSONTag(v.Filters, "UserID"))
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	return ctxerr.QuickWrap(ctx, v.Pagination.Fill(ctx, q))
+}
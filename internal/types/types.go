@@ -30,10 +30,11 @@ func JSONTag(a any, name string) string {
 
 type (
 	Pagination struct {
-		Limit       int    `json:"limit"`
-		Cursor      string `json:"cursor"`
-		ShowDeleted bool   `json:"show_deleted,omitempty"`
-		ShowPending bool   `json:"show_pending,omitempty"`
+		Limit  int    `json:"limit"`
+		Cursor string `json:"cursor"`
+		// Show are set by the server, not read from requests
+		ShowDeleted bool `json:"show_deleted,omitempty" doc:"-"`
+		ShowPending bool `json:"show_pending,omitempty" doc:"-"`
 	}
 
 	PaginationResponse struct {
@@ -76,16 +77,31 @@ type (
 		DomainCreate
 	}
 
-	DomainLink struct {
+	DomainList struct {
+		Pagination Pagination   `json:"pagination"`
+		Filters    DomainCreate `json:"filters"`
+	}
+)
+
+type (
+	DomainLinkCreate struct {
 		DomainID    uuid.UUID `json:"domain_id"`
 		Link        string    `json:"link"`
 		CountryCode string    `json:"country_code"`
 	}
 
-	DomainList struct {
-		Pagination Pagination   `json:"pagination"`
-		Filters    DomainCreate `json:"filters"`
+	DomainLink struct {
+		ID uuid.UUID `json:"id"`
+		DomainLinkCreate
+	}
+
+	DomainLinkList struct {
+		Pagination Pagination       `json:"pagination"`
+		Filters    DomainLinkCreate `json:"filters"`
 	}
+
+	// DomainLinks are the links of a single domain
+	DomainLinks []DomainLink
 )
 
 type (
@@ -97,6 +113,7 @@ type (
 	User struct {
 		ID uuid.UUID `json:"id"`
 		UserCreate
+		Role Role `json:"role"`
 	}
 
 	UserList struct {
@@ -105,6 +122,68 @@ type (
 	}
 )
 
+type (
+	GroupCreate struct {
+		Description    string     `json:"description"`
+		PersonalUserID *uuid.UUID `json:"personal_user_id"`
+	}
+
+	Group struct {
+		ID uuid.UUID `json:"id"`
+		GroupCreate
+	}
+
+	GroupList struct {
+		Pagination Pagination  `json:"pagination"`
+		Filters    GroupCreate `json:"filters"`
+	}
+)
+
+type (
+	SocialCreate struct {
+		DomainID uuid.UUID `json:"domain_id"`
+		Username *string   `json:"username"`
+		UserID   *string   `json:"user_id"`
+		GroupID  uuid.UUID `json:"group_id"`
+	}
+
+	Social struct {
+		ID uuid.UUID `json:"id"`
+		SocialCreate
+		Votes Votes `json:"votes" db:"-"`
+	}
+
+	SocialFilters struct {
+		DomainID uuid.UUID `json:"domain_id"`
+		GroupID  uuid.UUID `json:"group_id"`
+		Username string    `json:"username"`
+	}
+
+	SocialList struct {
+		Pagination Pagination    `json:"pagination"`
+		Filters    SocialFilters `json:"filters"`
+		Sort       string        `json:"sort"`
+	}
+
+	Votes struct {
+		Up    int `json:"up"`
+		Down  int `json:"down"`
+		Score int `json:"score"`
+	}
+
+	VoteCreate struct {
+		Vote string `json:"vote"`
+	}
+)
+
+const (
+	SocialSortScore = "score"
+
+	VoteUp    = "up"
+	VoteDown  = "down"
+	VoteClear = "clear"
+)
+
 type (
 	Logout struct {
 		JWTID      uuid.UUID `json:"jwt_id"`
@@ -121,14 +200,53 @@ func (v DomainCreate) Validate(ctx context.Context) error {
 	return ctxerr.QuickWrap(ctx, err)
 }
 
-func (v DomainLink) Validate(ctx context.Context) error {
+func (v DomainLinkCreate) Validate(ctx context.Context) error {
 	var err error
+	if v.DomainID == uuid.Nil {
+		err = errors.Join(err, ctxerr.NewHTTP(ctx, "bec00986-a862-4e48-9eb7-71c336ebdea0", "missing domain_id", http.StatusBadRequest, "missing domain_id"))
+	}
+	if v.CountryCode != "" && !isCountryCode(v.CountryCode) {
+		ctx = ctxerr.SetField(ctx, "country_code", v.CountryCode)
+		err = errors.Join(err, ctxerr.NewHTTP(ctx, "6d0faeb2-90d8-4608-895e-158a5937f8fe", "country_code must be a two letter ISO 3166-1 code", http.StatusBadRequest, "invalid country_code"))
+	}
 	if v.Link == "" {
 		err = errors.Join(err, ctxerr.NewHTTP(ctx, "c4173215-7a81-467f-ac8b-0dc525074bd0", "missing link", http.StatusBadRequest, "missing link"))
 	}
 	return ctxerr.QuickWrap(ctx, err)
 }
 
+func (v GroupCreate) Validate(ctx context.Context) error {
+	var err error
+	if v.Description == "" {
+		err = errors.Join(err, ctxerr.NewHTTP(ctx, "3cf065b2-988f-4787-b4e7-32f37f4e76a1", "missing description", http.StatusBadRequest, "missing description"))
+	}
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+func (v SocialCreate) Validate(ctx context.Context) error {
+	var err error
+	if v.DomainID == uuid.Nil {
+		err = errors.Join(err, ctxerr.NewHTTP(ctx, "6f20cc2e-cbc7-40cc-8bde-8b9825a37526", "missing domain_id", http.StatusBadRequest, "missing domain_id"))
+	}
+	if v.Username == nil && v.UserID == nil {
+		err = errors.Join(err, ctxerr.NewHTTP(ctx, "c6d9f1ee-64ee-4c8e-9136-9c1a7a9b91fd", "missing username or user_id", http.StatusBadRequest, "missing username or user_id"))
+	}
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+func (v VoteCreate) Validate(ctx context.Context) error {
+	switch v.Vote {
+	case VoteUp, VoteDown, VoteClear:
+		return nil
+	}
+	ctx = ctxerr.SetField(ctx, "vote", v.Vote)
+	return ctxerr.NewHTTP(ctx, "f8aa7307-bc63-49d9-9a0b-43bbec97581a", "vote must be up, down, or clear", http.StatusBadRequest, "invalid vote")
+}
+
+func (v *VoteCreate) Normalize() {
+	v.Vote = strings.ToLower(strings.TrimSpace(v.Vote))
+}
+
 func (v *DomainList) Normalize() {
 	v.Filters.DisplayName = strings.TrimSpace(v.Filters.DisplayName)
 	v.Filters.Description = strings.TrimSpace(v.Filters.Description)
@@ -165,5 +283,222 @@ func (v *UserList) Fill(ctx context.Context, q url.Values) error {
 	return nil
 }
 
-func (d Domain) GetID() uuid.UUID { return d.ID }
-func (u User) GetID() uuid.UUID   { return u.ID }
+func (v *GroupCreate) Normalize() {
+	v.Description = strings.TrimSpace(v.Description)
+}
+
+func (v *GroupList) Normalize() {
+	v.Filters.Normalize()
+	v.Pagination.Normalize()
+}
+
+func (v *GroupList) Fill(ctx context.Context, q url.Values) error {
+	v.Filters.Description = q.Get(JSONTag(v.Filters, "Description"))
+	id, err := parseUUIDParam(ctx, q, JSONTag(v.Filters, "PersonalUserID"))
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	if id != uuid.Nil {
+		v.Filters.PersonalUserID = &id
+	}
+	err = v.Pagination.Fill(ctx, q)
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	v.Normalize()
+	return nil
+}
+
+// trimOrNil trims a string pointer and turns empty strings into nil
+func trimOrNil(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	t := strings.TrimSpace(*s)
+	if t == "" {
+		return nil
+	}
+	return &t
+}
+
+// parseUUIDParam parses an optional uuid query parameter
+func parseUUIDParam(ctx context.Context, q url.Values, key string) (uuid.UUID, error) {
+	s := strings.TrimSpace(q.Get(key))
+	if s == "" {
+		return uuid.UUID{}, nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		ctx = ctxerr.SetField(ctx, key, s)
+		return uuid.UUID{}, ctxerr.WrapHTTP(ctx, err, "98068579-f46d-4e49-8213-972f121e79f7", "invalid "+key, http.StatusBadRequest, "invalid "+key)
+	}
+	return id, nil
+}
+
+func (v *SocialCreate) Normalize() {
+	v.Username = trimOrNil(v.Username)
+	v.UserID = trimOrNil(v.UserID)
+}
+
+func (v *SocialList) Normalize() {
+	v.Filters.Username = strings.TrimSpace(v.Filters.Username)
+	v.Sort = strings.ToLower(strings.TrimSpace(v.Sort))
+	v.Pagination.Normalize()
+}
+
+func (v SocialList) Validate(ctx context.Context) error {
+	switch v.Sort {
+	case "":
+	case SocialSortScore:
+		if v.Filters.GroupID == uuid.Nil {
+			return ctxerr.NewHTTP(ctx, "a1cbdfd4-3104-432c-b998-6a9cf6872837", "sorting by score requires group_id", http.StatusBadRequest, "sort by score without group_id")
+		}
+	default:
+		ctx = ctxerr.SetField(ctx, "sort", v.Sort)
+		return ctxerr.NewHTTP(ctx, "d8d4482a-a653-48b9-8607-753e354067e3", "invalid sort", http.StatusBadRequest, "invalid sort")
+	}
+	return nil
+}
+
+func (v *SocialList) Fill(ctx context.Context, q url.Values) error {
+	var err error
+	v.Filters.DomainID, err = parseUUIDParam(ctx, q, JSONTag(v.Filters, "DomainID"))
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	v.Filters.GroupID, err = parseUUIDParam(ctx, q, JSONTag(v.Filters, "GroupID"))
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	v.Filters.Username = q.Get(JSONTag(v.Filters, "Username"))
+	v.Sort = q.Get(JSONTag(*v, "Sort"))
+	err = v.Pagination.Fill(ctx, q)
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	v.Normalize()
+	return ctxerr.QuickWrap(ctx, v.Validate(ctx))
+}
+
+func (v *DomainLinkCreate) Normalize() {
+	v.Link = strings.TrimSpace(v.Link)
+	v.CountryCode = strings.ToUpper(strings.TrimSpace(v.CountryCode))
+}
+
+func (v *DomainLinkList) Normalize() {
+	v.Filters.Normalize()
+	v.Pagination.Normalize()
+}
+
+func (v *DomainLinkList) Fill(ctx context.Context, q url.Values) error {
+	var err error
+	v.Filters.DomainID, err = parseUUIDParam(ctx, q, JSONTag(v.Filters, "DomainID"))
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	v.Filters.Link = q.Get(JSONTag(v.Filters, "Link"))
+	v.Filters.CountryCode = q.Get(JSONTag(v.Filters, "CountryCode"))
+	err = v.Pagination.Fill(ctx, q)
+	if err != nil {
+		return ctxerr.QuickWrap(ctx, err)
+	}
+	v.Normalize()
+	return nil
+}
+
+// Resolve picks the link for the country, falling back to the link without a
+// country code. Links are expected in creation order so the oldest match wins.
+func (l DomainLinks) Resolve(country string) (DomainLink, bool) {
+	country = strings.ToUpper(country)
+	var fallback *DomainLink
+	for i := range l {
+		switch l[i].CountryCode {
+		case "":
+			if fallback == nil {
+				fallback = &l[i]
+			}
+		case country:
+			if country != "" {
+				return l[i], true
+			}
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return DomainLink{}, false
+}
+
+// RequestCountry gets the caller's country from the country query param,
+// otherwise from the region of the preferred Accept-Language tag
+func RequestCountry(ctx context.Context, q url.Values, acceptLanguage string) (string, error) {
+	if c := strings.TrimSpace(q.Get("country")); c != "" {
+		if !isCountryCode(c) {
+			ctx = ctxerr.SetField(ctx, "country", c)
+			return "", ctxerr.NewHTTP(ctx, "5cdc1aa7-17d1-459f-b0e2-9f75fdafff31", "country must be a two letter ISO 3166-1 code", http.StatusBadRequest, "invalid country")
+		}
+		return strings.ToUpper(c), nil
+	}
+	return acceptLanguageRegion(acceptLanguage), nil
+}
+
+// acceptLanguageRegion returns the region of the highest weighted language tag
+// that has one, e.g. "fr-CH, fr;q=0.9, en-US;q=0.8" returns "CH"
+func acceptLanguageRegion(header string) string {
+	type tag struct {
+		region string
+		q      float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		if q <= 0 {
+			continue
+		}
+		subtags := strings.Split(strings.TrimSpace(lang), "-")
+		for _, st := range subtags[1:] {
+			if isCountryCode(st) {
+				tags = append(tags, tag{region: strings.ToUpper(st), q: q})
+				break
+			}
+		}
+	}
+	best := tag{}
+	for _, t := range tags {
+		if t.q > best.q {
+			best = t
+		}
+	}
+	return best.region
+}
+
+func isCountryCode(s string) bool {
+	if len(s) != 2 {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func (d Domain) GetID() uuid.UUID     { return d.ID }
+func (u User) GetID() uuid.UUID       { return u.ID }
+func (g Group) GetID() uuid.UUID      { return g.ID }
+func (s Social) GetID() uuid.UUID     { return s.ID }
+func (l DomainLink) GetID() uuid.UUID { return l.ID }
+
+// NewVotes totals up and down votes into a score
+func NewVotes(up, down int) Votes {
+	return Votes{Up: up, Down: down, Score: up - down}
+}
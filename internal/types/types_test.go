@@ -4,7 +4,9 @@ import (
 	"context"
 	"net/url"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/mvndaai/known-anywhere/internal/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -70,3 +72,299 @@ func TestDomainListFill(t *testing.T) {
 		})
 	}
 }
+
+func TestSocialListFill(t *testing.T) {
+	domainID := uuid.Must(uuid.NewV7())
+	tests := []struct {
+		name          string
+		q             url.Values
+		expected      types.SocialList
+		errorContains string
+	}{
+		{
+			name: "everything",
+			q: url.Values{
+				"domain_id": {" " + domainID.String() + " "},
+				"username":  {" u "},
+				"limit":     {"5"},
+			},
+			expected: types.SocialList{
+				Filters: types.SocialFilters{
+					DomainID: domainID,
+					Username: "u",
+				},
+				Pagination: types.Pagination{
+					Limit: 5,
+				},
+			},
+		},
+		{
+			name:          "sort by score without group",
+			q:             url.Values{"sort": {"score"}},
+			errorContains: "sort by score without group_id",
+		},
+		{
+			name:          "invalid group_id",
+			q:             url.Values{"group_id": {"nope"}},
+			errorContains: "invalid group_id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := types.SocialList{}
+			err := l.Fill(context.Background(), tt.q)
+			require.Equal(t, tt.errorContains == "", err == nil)
+			if err != nil {
+				assert.Contains(t, err.Error(), tt.errorContains)
+				return
+			}
+			assert.Equal(t, tt.expected, l)
+		})
+	}
+}
+
+func TestDomainLinksResolve(t *testing.T) {
+	link := func(link, country string) types.DomainLink {
+		return types.DomainLink{DomainLinkCreate: types.DomainLinkCreate{Link: link, CountryCode: country}}
+	}
+	links := types.DomainLinks{
+		link("https://example.com", ""),
+		link("https://example.de", "DE"),
+		link("https://example.com/other", ""),
+	}
+
+	tests := []struct {
+		name     string
+		links    types.DomainLinks
+		country  string
+		expected string
+		found    bool
+	}{
+		{name: "country match", links: links, country: "de", expected: "https://example.de", found: true},
+		{name: "fallback to first without country", links: links, country: "US", expected: "https://example.com", found: true},
+		{name: "no country", links: links, country: "", expected: "https://example.com", found: true},
+		{name: "no fallback", links: types.DomainLinks{link("https://example.de", "DE")}, country: "US", found: false},
+		{name: "empty", links: nil, country: "US", found: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, ok := tt.links.Resolve(tt.country)
+			assert.Equal(t, tt.found, ok)
+			assert.Equal(t, tt.expected, l.Link)
+		})
+	}
+}
+
+func TestRequestCountry(t *testing.T) {
+	tests := []struct {
+		name           string
+		q              url.Values
+		acceptLanguage string
+		expected       string
+		errorContains  string
+	}{
+		{name: "param wins", q: url.Values{"country": {" ch "}}, acceptLanguage: "en-US", expected: "CH"},
+		{name: "invalid param", q: url.Values{"country": {"usa"}}, errorContains: "invalid country"},
+		{name: "accept language", acceptLanguage: "en-GB,en;q=0.8", expected: "GB"},
+		{name: "highest weight", acceptLanguage: "en-US;q=0.5, fr-CA;q=0.9, *;q=0.1", expected: "CA"},
+		{name: "script subtag", acceptLanguage: "zh-Hant-TW", expected: "TW"},
+		{name: "skip numeric region", acceptLanguage: "es-419, es-MX;q=0.5", expected: "MX"},
+		{name: "zero weight ignored", acceptLanguage: "de-DE;q=0, en", expected: ""},
+		{name: "no region", acceptLanguage: "en", expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := types.RequestCountry(context.Background(), tt.q, tt.acceptLanguage)
+			require.Equal(t, tt.errorContains == "", err == nil)
+			if err != nil {
+				assert.Contains(t, err.Error(), tt.errorContains)
+				return
+			}
+			assert.Equal(t, tt.expected, c)
+		})
+	}
+}
+
+func TestRegistrationValidate(t *testing.T) {
+	tests := []struct {
+		name          string
+		r             types.Registration
+		errorContains []string
+	}{
+		{
+			name: "valid",
+			r:    types.Registration{UserCreate: types.UserCreate{Username: " me "}, Email: " me@example.com ", Password: "0123456789"},
+		},
+		{
+			name:          "everything missing",
+			r:             types.Registration{},
+			errorContains: []string{"missing username", "invalid email", "invalid password length"},
+		},
+		{
+			name:          "named email",
+			r:             types.Registration{UserCreate: types.UserCreate{Username: "me"}, Email: "Me <me@example.com>", Password: "0123456789"},
+			errorContains: []string{"invalid email"},
+		},
+		{
+			name:          "short password",
+			r:             types.Registration{UserCreate: types.UserCreate{Username: "me"}, Email: "me@example.com", Password: "012345678"},
+			errorContains: []string{"invalid password length"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.r.Normalize()
+			err := tt.r.Validate(context.Background())
+			if len(tt.errorContains) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			for _, s := range tt.errorContains {
+				assert.Contains(t, err.Error(), s)
+			}
+		})
+	}
+}
+
+func TestIdentityUsername(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity types.Identity
+		expected string
+	}{
+		{name: "preferred username", identity: types.Identity{PreferredUsername: "Octo.Cat", Email: "other@example.com"}, expected: "octo.cat"},
+		{name: "email", identity: types.Identity{Email: "jane.doe+tag@example.com", Name: "Jane"}, expected: "jane.doetag"},
+		{name: "name", identity: types.Identity{Name: " Jane Doe "}, expected: "jane_doe"},
+		{name: "only symbols", identity: types.Identity{PreferredUsername: "__", Name: "日本"}, expected: "user"},
+		{name: "too long", identity: types.Identity{PreferredUsername: "abcdefghijklmnopqrstuvwxyz0123456789"}, expected: "abcdefghijklmnopqrstuvwxyz0123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.identity.Username())
+		})
+	}
+}
+
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		role     types.Role
+		other    types.Role
+		expected bool
+	}{
+		{role: "", other: types.RoleUser, expected: true},
+		{role: "", other: types.RoleModerator, expected: false},
+		{role: types.RoleModerator, other: types.RoleUser, expected: true},
+		{role: types.RoleModerator, other: types.RoleAdmin, expected: false},
+		{role: types.RoleAdmin, other: types.RoleModerator, expected: true},
+		{role: "owner", other: types.RoleUser, expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.role)+">="+string(tt.other), func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.role.AtLeast(tt.other))
+		})
+	}
+}
+
+func TestRoleChangeValidate(t *testing.T) {
+	rc := types.RoleChange{Role: " Moderator ", Reason: " helps out "}
+	rc.Normalize()
+	require.NoError(t, rc.Validate(context.Background()))
+	assert.Equal(t, types.RoleModerator, rc.Role)
+	assert.Equal(t, "helps out", rc.Reason)
+
+	rc = types.RoleChange{Role: "owner"}
+	rc.Normalize()
+	assert.ErrorContains(t, rc.Validate(context.Background()), "invalid role")
+}
+
+func TestNotificationListFill(t *testing.T) {
+	read := false
+	tests := []struct {
+		name          string
+		q             url.Values
+		expected      types.NotificationList
+		errorContains string
+	}{
+		{
+			name:     "empty",
+			q:        url.Values{},
+			expected: types.NotificationList{Pagination: types.Pagination{Limit: 10}},
+		},
+		{
+			name:     "unread",
+			q:        url.Values{"read": {" false "}},
+			expected: types.NotificationList{Pagination: types.Pagination{Limit: 10}, Filters: types.NotificationFilters{Read: &read}},
+		},
+		{
+			name:          "invalid read",
+			q:             url.Values{"read": {"maybe"}},
+			errorContains: "invalid read",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var list types.NotificationList
+			err := list.Fill(context.Background(), tt.q)
+			if tt.errorContains != "" {
+				assert.ErrorContains(t, err, tt.errorContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, list)
+		})
+	}
+}
+
+func TestRejectionValidate(t *testing.T) {
+	r := types.Rejection{Reason: "  "}
+	r.Normalize()
+	assert.ErrorContains(t, r.Validate(context.Background()), "missing reason")
+
+	r = types.Rejection{Reason: " duplicate of another domain "}
+	r.Normalize()
+	require.NoError(t, r.Validate(context.Background()))
+	assert.Equal(t, "duplicate of another domain", r.Reason)
+}
+
+func TestAPIKeyCreateValidate(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name          string
+		k             types.APIKeyCreate
+		expected      []string
+		errorContains []string
+	}{
+		{
+			name:     "valid",
+			k:        types.APIKeyCreate{Name: " ci ", Scopes: []string{" Domain:Write ", "domain:write", ""}},
+			expected: []string{"domain:write"},
+		},
+		{
+			name:          "everything missing",
+			k:             types.APIKeyCreate{},
+			errorContains: []string{"invalid name", "missing scopes"},
+		},
+		{
+			name:          "expired",
+			k:             types.APIKeyCreate{Name: "ci", Scopes: []string{"domain:write"}, Expiration: &past},
+			errorContains: []string{"invalid expiration"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.k.Normalize()
+			err := tt.k.Validate(context.Background())
+			if len(tt.errorContains) == 0 {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, tt.k.Scopes)
+				return
+			}
+			require.Error(t, err)
+			for _, s := range tt.errorContains {
+				assert.Contains(t, err.Error(), s)
+			}
+		})
+	}
+}
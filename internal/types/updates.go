@@ -0,0 +1,127 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mvndaai/ctxerr"
+)
+
+// Update types are used for partial updates, only fields that are not nil are changed
+
+type (
+	DomainUpdate struct {
+		DisplayName *string `json:"display_name"`
+		Description *string `json:"description"`
+		Notes       *string `json:"notes"`
+	}
+
+	DomainLinkUpdate struct {
+		Link        *string `json:"link"`
+		CountryCode *string `json:"country_code"`
+	}
+
+	UserUpdate struct {
+		Username    *string `json:"username"`
+		DisplayName *string `json:"display_name"`
+	}
+
+	GroupUpdate struct {
+		Description *string `json:"description"`
+	}
+
+	SocialUpdate struct {
+		Username *string    `json:"username"`
+		UserID   *string    `json:"user_id"`
+		GroupID  *uuid.UUID `json:"group_id"`
+	}
+)
+
+func trim(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	t := strings.TrimSpace(*s)
+	return &t
+}
+
+func missing(s *string) bool {
+	return s != nil && *s == ""
+}
+
+func (v *DomainUpdate) Normalize() {
+	v.DisplayName = trim(v.DisplayName)
+	v.Description = trim(v.Description)
+	v.Notes = trim(v.Notes)
+}
+
+func (v DomainUpdate) Validate(ctx context.Context) error {
+	var err error
+	if missing(v.DisplayName) {
+		err = errors.Join(err, ctxerr.NewHTTP(ctx, "629af287-d0ed-4686-8c40-5709b8c03d7f", "missing display_name", http.StatusBadRequest, "missing display_name"))
+	}
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+func (v *DomainLinkUpdate) Normalize() {
+	v.Link = trim(v.Link)
+	if v.CountryCode != nil {
+		c := strings.ToUpper(strings.TrimSpace(*v.CountryCode))
+		v.CountryCode = &c
+	}
+}
+
+func (v DomainLinkUpdate) Validate(ctx context.Context) error {
+	var err error
+	if missing(v.Link) {
+		err = errors.Join(err, ctxerr.NewHTTP(ctx, "636fdcb3-acb8-4ec3-bb5d-40e0d8276cb9", "missing link", http.StatusBadRequest, "missing link"))
+	}
+	if v.CountryCode != nil && *v.CountryCode != "" && !isCountryCode(*v.CountryCode) {
+		ctx = ctxerr.SetField(ctx, "country_code", *v.CountryCode)
+		err = errors.Join(err, ctxerr.NewHTTP(ctx, "22228a78-184e-48bf-a84f-ec4c51e081ce", "country_code must be a two letter ISO 3166-1 code", http.StatusBadRequest, "invalid country_code"))
+	}
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+func (v *UserUpdate) Normalize() {
+	v.Username = trim(v.Username)
+	v.DisplayName = trim(v.DisplayName)
+}
+
+func (v UserUpdate) Validate(ctx context.Context) error {
+	var err error
+	if missing(v.Username) {
+		err = errors.Join(err, ctxerr.NewHTTP(ctx, "0b070987-1e40-4a33-9c5b-6d5a7e8dc67f", "missing username", http.StatusBadRequest, "missing username"))
+	}
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+func (v *GroupUpdate) Normalize() {
+	v.Description = trim(v.Description)
+}
+
+func (v GroupUpdate) Validate(ctx context.Context) error {
+	var err error
+	if missing(v.Description) {
+		err = errors.Join(err, ctxerr.NewHTTP(ctx, "b39e031f-a288-41f2-88b9-2842206e9926", "missing description", http.StatusBadRequest, "missing description"))
+	}
+	return ctxerr.QuickWrap(ctx, err)
+}
+
+// Normalize trims the names, there is no way to clear one of them because
+// the database requires a username or user_id
+func (v *SocialUpdate) Normalize() {
+	v.Username = trimOrNil(v.Username)
+	v.UserID = trimOrNil(v.UserID)
+}
+
+func (v SocialUpdate) Validate(ctx context.Context) error {
+	var err error
+	if v.GroupID != nil && *v.GroupID == uuid.Nil {
+		err = errors.Join(err, ctxerr.NewHTTP(ctx, "a6076eaa-5933-4524-9261-fcd811e52c1d", "invalid group_id", http.StatusBadRequest, "invalid group_id"))
+	}
+	return ctxerr.QuickWrap(ctx, err)
+}
@@ -4,12 +4,23 @@
 package main
 
 import (
+	"context"
+	"os"
+
 	"github.com/mvndaai/ctxerr"
+	"github.com/mvndaai/known-anywhere/internal/db"
 	"github.com/mvndaai/known-anywhere/internal/router"
 )
 
 func main() {
-	err := router.StartServer()
+	var err error
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = db.MigrateCommand(context.Background(), os.Args[2:], os.Stdout)
+	} else if len(os.Args) > 1 && os.Args[1] == "role" {
+		err = db.RoleCommand(context.Background(), os.Args[2:], os.Stdout)
+	} else {
+		err = router.StartServer()
+	}
 	if err != nil {
 		ctxerr.Handle(err)
 		return